@@ -0,0 +1,118 @@
+package main
+
+import (
+	"unicode"
+)
+
+func (e *Editor) getAutoPairs() []string {
+	if e.lexer == nil || e.lexer.config == nil {
+		return nil
+	}
+
+	return e.lexer.config.AutoPairs
+}
+
+// Returns the closer for the opener if it is one of the auto pairs of the current highlighting
+func (e *Editor) getClosingPair(opener string) (string, bool) {
+	for _, pair := range e.getAutoPairs() {
+		if len(pair) != 2 {
+			continue
+		}
+
+		if pair[:1] == opener {
+			return pair[1:], true
+		}
+	}
+	return "", false
+}
+
+func (e *Editor) isClosingPair(closer string) bool {
+	for _, pair := range e.getAutoPairs() {
+		if len(pair) != 2 {
+			continue
+		}
+
+		if pair[1:] == closer {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the closer should be inserted along with the opener at the cursor.
+// Only pairs up if the cursor is at the end of a word, so typing in the middle of text does not leave closers around
+func (e *Editor) shouldAutoPair(opener string) (string, bool) {
+	closer, ok := e.getClosingPair(opener)
+	if !ok {
+		return "", false
+	}
+
+	line := e.lines[e.y]
+	if e.x < len(line) {
+		next := line[e.x : e.x+1]
+		if !unicode.IsSpace(rune(next[0])) && !e.isClosingPair(next) {
+			return "", false
+		}
+	}
+
+	// Quotes would otherwise pair up inside words, like don't
+	if opener == closer && e.x > 0 {
+		prev := rune(line[e.x-1])
+		if unicode.IsLetter(prev) || unicode.IsNumber(prev) || prev == '_' {
+			return "", false
+		}
+	}
+
+	return closer, true
+}
+
+// Moves over the closer instead of inserting a new one if it is already under the cursor
+func (e *Editor) typeOverClosingPair(closer string) bool {
+	if !e.isClosingPair(closer) {
+		return false
+	}
+
+	line := e.lines[e.y]
+	if e.x >= len(line) || line[e.x:e.x+1] != closer {
+		return false
+	}
+
+	e.moveX(1)
+	return true
+}
+
+// Removes both the opener and the closer if the cursor is between an empty pair
+func (e *Editor) removeAutoPair() bool {
+	line := e.lines[e.y]
+	if e.x <= 0 || e.x >= len(line) {
+		return false
+	}
+
+	closer, ok := e.getClosingPair(line[e.x-1 : e.x])
+	if !ok || line[e.x:e.x+1] != closer {
+		return false
+	}
+
+	e.remove(e.y, e.x+1, 2)
+	e.moveX(-1)
+	return true
+}
+
+// Surrounds the selection with the opener and closer and keeps the text selected
+func (e *Editor) wrapSelection(opener, closer string) {
+	startY, startX, endY, endX := e.getSelectionBounds()
+
+	e.insert(endY, endX, closer)
+	e.insert(startY, startX, opener)
+
+	startX++
+	if startY == endY {
+		endX++
+	}
+
+	e.moveYto(endY)
+	e.moveXto(endX)
+
+	e.selectedYStart, e.selectedXStart = startY, startX
+	e.selectedYEnd, e.selectedXEnd = endY, endX
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+var VERSION = "dev" // set when building with -ldflags "-X main.VERSION=..."
+
+const VIEW_MODE_COMMAND = "view" // gim view opens the files read-only and pages through them
+
+const STDIN_FILE_NAME = "stdin" // what the unnamed file of the text read from stdin is called
+
+const STDIN_CHUNKS = 64 // chunks of stdin read ahead of the loop adding them to the file
+
+// A path ending with the line and optionally the column, like main.go:12:5
+var fileLocationRegex = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?:?$`)
+
+// A path ending with only the line, for files with a colon and a number at the end of the name
+var fileLineRegex = regexp.MustCompile(`^(.+):(\d+):?$`)
+
+// Reads keys from the terminal when stdin was read as a file
+var terminalInput *os.File
+
+// FileArgument is a file given on the command line, line and col are 1 based and 0 when not given. -1 is the last line
+type FileArgument struct {
+	path  string
+	line  int
+	col   int
+	stdin bool // the text is read from stdin, given as "-"
+}
+
+type Arguments struct {
+	files    []FileArgument
+	readOnly bool
+	config   string
+	debug    bool
+	version  bool
+	restore  bool   // open the session of the working directory
+	session  string // open the named session
+}
+
+func printUsage(flags *flag.FlagSet) {
+	output := flags.Output()
+	fmt.Fprintln(output, "usage: gim [flags] [+line] file[:line[:col]] ...")
+	fmt.Fprintln(output, "       gim view [flags] [file ...], pages through the files or stdin read-only")
+	fmt.Fprintln(output, "files can be globs, - reads stdin")
+	flags.PrintDefaults()
+}
+
+// Parses the arguments of gim, flags can come before, between and after the files
+func parseArguments(args []string) (*Arguments, error) {
+	arguments := &Arguments{}
+
+	flags := flag.NewFlagSet("gim", flag.ContinueOnError)
+	flags.BoolVar(&arguments.readOnly, "readonly", false, "open the files read-only")
+	flags.StringVar(&arguments.config, "config", "", "read the config from this file instead of ~/.gim/config.config")
+	flags.BoolVar(&arguments.debug, "debug", false, "keep the gim folder in the working directory and show debug logs")
+	flags.BoolVar(&arguments.version, "version", false, "print the version and exit")
+	flags.BoolVar(&arguments.restore, "restore", false, "open the files of the session saved when gim was last closed in this directory")
+	flags.StringVar(&arguments.session, "session", "", "open the files of the session saved with this name")
+	flags.Usage = func() {}
+	flags.SetOutput(io.Discard) // errors are told by main
+
+	line := 0 // from a +line before the file
+	onlyFiles := false
+	for len(args) > 0 {
+		if !onlyFiles {
+			err := flags.Parse(args)
+			if errors.Is(err, flag.ErrHelp) {
+				flags.SetOutput(os.Stdout)
+				printUsage(flags)
+				return nil, err
+			} else if err != nil {
+				return nil, err
+			}
+
+			// Everything after -- is a file, even if it starts with -
+			consumed := len(args) - flags.NArg()
+			onlyFiles = consumed > 0 && args[consumed-1] == "--"
+			args = flags.Args()
+			if len(args) == 0 {
+				break
+			}
+		}
+
+		arg := args[0]
+		args = args[1:]
+
+		if strings.HasPrefix(arg, "+") && !onlyFiles {
+			if arg == "+" {
+				line = -1
+				continue
+			}
+
+			var err error
+			line, err = strconv.Atoi(arg[1:])
+			if err != nil || line <= 0 {
+				return nil, fmt.Errorf("invalid line %s", arg)
+			}
+			continue
+		}
+
+		files, err := parseFileArgument(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range files {
+			if line != 0 && files[i].line == 0 {
+				files[i].line = line
+			}
+		}
+		line = 0
+		arguments.files = append(arguments.files, files...)
+	}
+
+	return arguments, nil
+}
+
+// Returns the files of an argument, a glob gives every file matching it
+func parseFileArgument(arg string) ([]FileArgument, error) {
+	if arg == "-" {
+		return []FileArgument{{path: arg}}, nil
+	}
+
+	file := FileArgument{path: arg}
+	if _, err := os.Stat(arg); err != nil {
+		// Files with a colon in the name are opened as they are, or at the line given after them
+		if match := fileLineRegex.FindStringSubmatch(arg); match != nil && pathExists(match[1]) {
+			file.path = match[1]
+			file.line, _ = strconv.Atoi(match[2])
+		} else if match := fileLocationRegex.FindStringSubmatch(arg); match != nil {
+			file.path = match[1]
+			file.line, _ = strconv.Atoi(match[2])
+			file.col, _ = strconv.Atoi(match[3])
+		}
+	}
+
+	if _, err := os.Stat(file.path); err != nil && strings.ContainsAny(file.path, "*?[") {
+		paths, err := filepath.Glob(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %w", file.path, err)
+		}
+
+		files := make([]FileArgument, 0, len(paths))
+		for _, path := range paths {
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				files = append(files, FileArgument{path: path, line: file.line, col: file.col})
+			}
+		}
+		if len(files) == 0 {
+			return nil, errors.New("no files match " + file.path)
+		}
+		return files, nil
+	}
+
+	return []FileArgument{file}, nil
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Checks the files can be opened, files that don't exist are made when saved
+func checkFileArgument(file FileArgument) error {
+	info, err := os.Stat(file.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return errors.New(file.path + " is a directory")
+	}
+
+	f, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Marks the file given as - to be read from stdin, keys are then read from the terminal instead
+func readStdinArguments(files []FileArgument) error {
+	read := false
+	for i := range files {
+		if files[i].path != "-" {
+			continue
+		}
+		if read {
+			return errors.New("- can only be given once")
+		}
+		read = true
+
+		files[i].stdin = true
+		files[i].path = getStdinPath()
+	}
+
+	if !read {
+		return nil
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return fmt.Errorf("failed to open the terminal: %w", err)
+	}
+	terminalInput = tty
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Returns a name for the text from stdin that no file has
+func getStdinPath() string {
+	path := STDIN_FILE_NAME
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = STDIN_FILE_NAME + "-" + strconv.Itoa(i)
+	}
+}
+
+// Starts ncurses, on the terminal if stdin has been read
+func initScreen() (*gc.Window, error) {
+	if terminalInput == nil {
+		return gc.Init()
+	}
+
+	_, err := gc.NewTerm("", os.Stdout, terminalInput)
+	if err != nil {
+		return nil, err
+	}
+	return gc.StdScr(), nil
+}
+
+// Opens an unnamed file that the text of stdin is added to while it is read, it has to be given a name to be saved
+func (e *Editor) addStdinFile(path string) {
+	e.unnamed[path] = true
+	e.modified[path] = true
+	e.buffers[path] = &Buffer{lines: []string{""}, transactions: NewTransactions()}
+	e.formats[path] = getFileFormat(nil)
+
+	e.stdinBuffer = e.buffers[path]
+	e.stdinChunks = make(chan []byte, STDIN_CHUNKS)
+	go e.readStdin(e.stdinChunks)
+}
+
+// Reads stdin until it ends, the text is added to its file by the loop reading keys as ncurses can only be used from there
+func (e *Editor) readStdin(chunks chan<- []byte) {
+	defer close(chunks)
+
+	buffer := make([]byte, PASTE_BUFFER_SIZE)
+	for {
+		n, err := os.Stdin.Read(buffer)
+		if n > 0 {
+			chunks <- append([]byte{}, buffer[:n]...)
+		}
+		if errors.Is(err, io.EOF) {
+			return
+		} else if err != nil {
+			e.debugLog("failed to read stdin:", err)
+			return
+		}
+	}
+}
+
+// Adds the text read from stdin since the last time to the end of its file
+func (e *Editor) addStdinText() {
+	text := ""
+read:
+	for i := 0; i < STDIN_CHUNKS; i++ {
+		select {
+		case data, ok := <-e.stdinChunks:
+			if !ok {
+				e.stdinChunks = nil // stdin ended
+				break read
+			}
+			text += string(data)
+		default:
+			break read
+		}
+	}
+	if text == "" {
+		return
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	buffer := e.stdinBuffer
+	buffer.lines[len(buffer.lines)-1] += lines[0]
+	buffer.lines = append(buffer.lines, lines[1:]...)
+
+	// The file can have been given a name by now
+	for path := range e.buffers {
+		if e.buffers[path] != buffer {
+			continue
+		}
+		e.modified[path] = true
+		if strings.Contains(text, "\r\n") {
+			format := e.formats[path]
+			format.lineEnding = "crlf"
+			e.formats[path] = format
+		}
+	}
+	e.draw()
+}
+
+// Opens the files given on the command line, the first one is shown
+func (e *Editor) openFileArguments(arguments *Arguments) {
+	for _, file := range arguments.files {
+		if file.stdin {
+			e.addStdinFile(file.path)
+		}
+
+		// Set before loading so the file is never shown as editable
+		if arguments.readOnly {
+			e.readOnly[file.path] = true
+		}
+
+		err := e.Load(file.path)
+		if err != nil {
+			e.debugLog(err)
+			delete(e.readOnly, file.path)
+			continue
+		}
+
+		if file.line != 0 {
+			// Positions past the end of the file go to its end
+			line := utils.Min(file.line-1, len(e.lines)-1)
+			if file.line == -1 {
+				line = len(e.lines) - 1
+			}
+			e.inlinePosition = 0
+			e.moveYto(line)
+			e.moveXto(utils.Min(utils.Max(file.col-1, 0), len(e.lines[e.y])))
+		}
+	}
+
+	if len(e.openedFiles) > 1 {
+		err := e.Load(e.openedFiles[0])
+		if err != nil {
+			e.debugLog(err)
+		}
+	}
+}
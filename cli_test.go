@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFileArgument(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt", "odd:1"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Directories matching a glob are left out
+	err := os.Mkdir(filepath.Join(dir, "d.go"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	missing := filepath.Join(dir, "missing.go")
+	odd := filepath.Join(dir, "odd:1")
+	glob := filepath.Join(dir, "*.go")
+
+	tests := []struct {
+		name  string
+		arg   string
+		files []FileArgument
+	}{
+		{"file", a, []FileArgument{{path: a}}},
+		{"missing file", missing, []FileArgument{{path: missing}}},
+		{"line", a + ":12", []FileArgument{{path: a, line: 12}}},
+		{"line and column", a + ":12:5", []FileArgument{{path: a, line: 12, col: 5}}},
+		{"trailing colon", a + ":12:5:", []FileArgument{{path: a, line: 12, col: 5}}},
+		{"missing file with line", missing + ":3", []FileArgument{{path: missing, line: 3}}},
+		{"colon in an existing name", odd, []FileArgument{{path: odd}}},
+		{"colon in an existing name with line", odd + ":2", []FileArgument{{path: odd, line: 2}}},
+		{"colon in an existing name with line and column", odd + ":2:3", []FileArgument{{path: odd, line: 2, col: 3}}},
+		{"stdin", "-", []FileArgument{{path: "-"}}},
+		{"glob", glob, []FileArgument{{path: a}, {path: b}}},
+		{"glob with line", glob + ":3:4", []FileArgument{{path: a, line: 3, col: 4}, {path: b, line: 3, col: 4}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := parseFileArgument(test.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(files, test.files) {
+				t.Errorf("got %+v, want %+v", files, test.files)
+			}
+		})
+	}
+
+	for _, arg := range []string{filepath.Join(dir, "*.rs"), filepath.Join(dir, "[")} {
+		_, err := parseFileArgument(arg)
+		if err == nil {
+			t.Errorf("%s: expected an error", arg)
+		}
+	}
+}
+
+func TestParseArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		arguments Arguments
+	}{
+		{"no arguments", nil, Arguments{}},
+		{"files", []string{"x.go", "y.go:2"}, Arguments{files: []FileArgument{{path: "x.go"}, {path: "y.go", line: 2}}}},
+		{"plus line", []string{"+5", "x.go", "y.go"}, Arguments{files: []FileArgument{{path: "x.go", line: 5}, {path: "y.go"}}}},
+		{"plus alone is the last line", []string{"+", "x.go"}, Arguments{files: []FileArgument{{path: "x.go", line: -1}}}},
+		{"line of the file wins", []string{"+5", "x.go:2:3"}, Arguments{files: []FileArgument{{path: "x.go", line: 2, col: 3}}}},
+		{"flags between files", []string{"-readonly", "x.go", "-debug", "y.go"},
+			Arguments{files: []FileArgument{{path: "x.go"}, {path: "y.go"}}, readOnly: true, debug: true}},
+		{"flag with value", []string{"-session", "work", "x.go"}, Arguments{files: []FileArgument{{path: "x.go"}}, session: "work"}},
+		{"double dash", []string{"-debug", "--", "-x.go", "+3"},
+			Arguments{files: []FileArgument{{path: "-x.go"}, {path: "+3"}}, debug: true}},
+		{"double dash after a file", []string{"x.go", "--", "-readonly"},
+			Arguments{files: []FileArgument{{path: "x.go"}, {path: "-readonly"}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			arguments, err := parseArguments(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*arguments, test.arguments) {
+				t.Errorf("got %+v, want %+v", *arguments, test.arguments)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"+0", "x.go"}, {"+x", "x.go"}, {"-nope"}, {"-session"}} {
+		_, err := parseArguments(args)
+		if err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
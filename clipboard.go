@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+
+	gc "github.com/rthornton128/goncurses"
+)
+
+const (
+	CLIPBOARD_SYSTEM   = "system"
+	CLIPBOARD_OSC52    = "osc52"
+	CLIPBOARD_INTERNAL = "internal"
+)
+
+// Returns the OSC 52 sequence that makes the terminal put text on its clipboard,
+// inside tmux it has to be wrapped to be passed on to the outer terminal
+func getOsc52Sequence(text string, tmux bool) string {
+	sequence := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\x07"
+	if !tmux {
+		return sequence
+	}
+
+	return "\x1bPtmux;" + strings.ReplaceAll(sequence, "\x1b", "\x1b\x1b") + "\x1b\\"
+}
+
+// Copies text to the clipboard of the terminal gim runs in, works over ssh where there is no system clipboard
+func writeOsc52(text string) error {
+	// ncurses buffers what it draws, it is flushed first so the sequence isn't written in the middle of its output
+	err := gc.Update()
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.WriteString(getOsc52Sequence(text, os.Getenv("TMUX") != ""))
+	return err
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"log"
+	"math"
+
 	"github.com/jonasfreyr/gim/utils"
 	gc "github.com/rthornton128/goncurses"
-	"log"
 )
 
 var colorIndex = 1
 var colorMap map[string]int
 
+// Pairs of palette colors used by the terminal, they are numbered down from the last pair so they don't meet the ones above
+var pairIndex int
+var pairMap map[[2]int16]int16
+
 var HAS_COLOR = false
 
 func InitColor() error {
@@ -28,6 +34,13 @@ func InitColor() error {
 
 	HAS_COLOR = true
 	colorMap = make(map[string]int)
+
+	// The first 16 colors are left as they are for programs in the terminal
+	if gc.Colors() > 16 {
+		colorIndex = 16
+	}
+	pairIndex = utils.Min(gc.ColorPairs(), math.MaxInt16+1)
+	pairMap = make(map[[2]int16]int16)
 	return nil
 }
 
@@ -89,3 +102,45 @@ func EnableColor(scr *gc.Window, color [3]int) {
 		log.Println(err)
 	}
 }
+
+// Returns the pair of the foreground and background palette colors, -1 is the default color
+func getColorPair(fg, bg int16) int16 {
+	if !HAS_COLOR || fg == -1 && bg == -1 {
+		return 0
+	}
+
+	// Colors the terminal doesn't have are shown as the basic ones or not at all
+	colors := int16(gc.Colors())
+	if fg >= colors {
+		fg = fallbackColor(fg, colors)
+	}
+	if bg >= colors {
+		bg = fallbackColor(bg, colors)
+	}
+
+	key := [2]int16{fg, bg}
+	if pair, ok := pairMap[key]; ok {
+		return pair
+	}
+
+	if pairIndex-1 <= colorIndex {
+		return 0
+	}
+
+	err := gc.InitPair(int16(pairIndex-1), fg, bg)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+
+	pairIndex--
+	pairMap[key] = int16(pairIndex)
+	return int16(pairIndex)
+}
+
+func fallbackColor(color, colors int16) int16 {
+	if color < 16 && color-8 < colors {
+		return color - 8
+	}
+	return -1
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const MAX_RECENT_COMMANDS = 20
+
+type CommandMenuWindow struct {
+	menuWindow *MenuWindow
+
+	recent []string // command names, the most recent first
+	loaded bool
+}
+
+func NewCommandMenuWindow(y, x, h, w int) (*CommandMenuWindow, error) {
+	menuWindow, err := NewMenuWindow(y, x, h, w)
+	if err != nil {
+		return nil, err
+	}
+
+	mw := &CommandMenuWindow{
+		menuWindow: menuWindow,
+		recent:     make([]string, 0),
+	}
+	return mw, nil
+}
+
+func getRecentCommandsPath() string {
+	return JoinPath(getHomePath(), RECENT_COMMANDS_PATH)
+}
+
+func (w *CommandMenuWindow) loadRecent() {
+	if w.loaded {
+		return
+	}
+	w.loaded = true
+
+	data, err := os.ReadFile(getRecentCommandsPath())
+	if err != nil {
+		return
+	}
+
+	recent := make([]string, 0)
+	err = json.Unmarshal(data, &recent)
+	if err != nil {
+		return
+	}
+
+	for _, name := range recent {
+		if _, ok := getCommand(name); ok {
+			w.recent = append(w.recent, name)
+		}
+	}
+}
+
+func (w *CommandMenuWindow) addRecent(name string) error {
+	index := utils.Index(w.recent, name)
+	if index != -1 {
+		w.recent = append(w.recent[:index], w.recent[index+1:]...)
+	}
+	w.recent = append([]string{name}, w.recent...)
+	if len(w.recent) > MAX_RECENT_COMMANDS {
+		w.recent = w.recent[:MAX_RECENT_COMMANDS]
+	}
+
+	data, err := json.Marshal(w.recent)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(getRecentCommandsPath(), data, 0666)
+}
+
+// Returns the commands matching the query, recently used ones first
+func (w *CommandMenuWindow) getCommands(query string) []string {
+	names := commandNames
+	if query != "" {
+		names = fuzzy.Find(strings.ToLower(query), commandNames)
+	}
+
+	recentIndex := func(name string) int {
+		index := utils.Index(w.recent, name)
+		if index == -1 {
+			return len(w.recent)
+		}
+		return index
+	}
+
+	sorted := append([]string{}, names...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if recentIndex(sorted[i]) != recentIndex(sorted[j]) {
+			return recentIndex(sorted[i]) < recentIndex(sorted[j])
+		}
+		return query != "" && len(sorted[i]) < len(sorted[j])
+	})
+	return sorted
+}
+
+func (w *CommandMenuWindow) getItems(query string, keymap *Keymap) []MenuItem {
+	config := GetEditorConfig()
+	_, width := w.menuWindow.subWindow.MaxYX()
+	width -= len(w.menuWindow.mark) + 3
+
+	names := w.getCommands(query)
+	items := make([]MenuItem, len(names))
+	for i, name := range names {
+		command, _ := getCommand(name)
+		keys := strings.Join(keymap.getKeys(name), ", ")
+
+		// Cut from the end as the menu would cut the name off otherwise
+		label := fmt.Sprintf("%-20s %-16s %s", name, keys, command.description)
+		label = label[:utils.Max(utils.Min(len(label), width), 0)]
+
+		items[i] = MenuItem{
+			label: label,
+			value: name,
+			color: config.FileColor.Color,
+		}
+	}
+	return items
+}
+
+// Returns the chosen command with the arguments typed after its name, like "goto 120"
+func (w *CommandMenuWindow) run(keymap *Keymap) string {
+	gc.Cursor(0)
+	defer gc.Cursor(1)
+
+	w.loadRecent()
+
+	searchString := ""
+	updateItems := true
+	for {
+		name, args, _ := strings.Cut(searchString, " ")
+
+		if updateItems {
+			w.menuWindow.setItems(w.getItems(name, keymap))
+			updateItems = false
+		}
+
+		title := searchString
+		if title == "" {
+			title = "command"
+		}
+		w.menuWindow.draw(title)
+
+		ch := getChar(w.menuWindow.stdscr)
+		switch ch {
+		case gc.KEY_RESIZE:
+			onScreenResize()
+		case gc.KEY_ESC:
+			return ""
+		case gc.KEY_DOWN, gc.KEY_UP:
+			w.menuWindow.run(ch)
+		case gc.KEY_ENTER, gc.KEY_RETURN:
+			selected := w.menuWindow.run(ch)
+			if selected == "" {
+				continue
+			}
+
+			err := w.addRecent(selected)
+			if err != nil {
+				log.Println("failed to save recent commands:", err)
+			}
+			return strings.TrimSpace(selected + " " + args)
+		case gc.KEY_TAB: // Completes the name of the selected command
+			if len(w.menuWindow.items) == 0 {
+				continue
+			}
+
+			searchString = w.menuWindow.items[w.menuWindow.selected].value + " " + args
+			updateItems = true
+		case gc.KEY_BACKSPACE:
+			if searchString == "" {
+				continue
+			}
+
+			searchString = searchString[:len(searchString)-1]
+			updateItems = true
+		default:
+			chr := gc.KeyString(ch)
+			if len(chr) > 1 {
+				continue
+			}
+
+			searchString += chr
+			updateItems = true
+		}
+	}
+}
+
+func (e *Editor) runCommandPalette(c *CommandContext) {
+	line := e.commandMenuWindow.run(e.keymap)
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	c.args = fields[1:]
+	e.runCommand(fields[0], c)
+}
+
+func init() {
+	registerCommand("command_palette", "search for a command and run it, arguments can be typed after the name", (*Editor).runCommandPalette)
+	registerCommand("set", "change an option of the config until the editor is closed, like set tab_width 2", func(e *Editor, c *CommandContext) {
+		fields := strings.Fields(e.getCommandInput(c, "set (option value)"))
+		if len(fields) < 2 {
+			return
+		}
+
+		err := SetEditorConfigOption(fields[0], strings.Join(fields[1:], " "))
+		if err != nil {
+			e.showMessage(err.Error())
+			return
+		}
+
+		gc.SetTabSize(GetEditorConfig().TabWidth)
+		e.resizeScreen() // Options like the status line change where windows go
+		c.resetSelected = false
+	})
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+)
+
+// CommandContext is how a command tells handleKey what to do once it has run
+type CommandContext struct {
+	args []string // given after the command name, like "120" in "goto 120"
+
+	updateLengthIndex bool // remember the new column for moving up and down
+	resetSelected     bool // clear the selection
+	exit              bool // close the editor
+
+	created string // the file or folder the command made
+}
+
+type Command struct {
+	name        string
+	description string
+	run         func(e *Editor, c *CommandContext)
+	edits       bool // changes the file, it isn't run in read-only files
+}
+
+var commands = make(map[string]*Command)
+var commandNames = make([]string, 0) // in the order they were registered
+
+func registerCommand(name, description string, run func(e *Editor, c *CommandContext)) {
+	if _, ok := commands[name]; !ok {
+		commandNames = append(commandNames, name)
+	}
+	commands[name] = &Command{name: name, description: description, run: run}
+}
+
+// Registers a command that changes the file
+func registerEditCommand(name, description string, run func(e *Editor, c *CommandContext)) {
+	registerCommand(name, description, run)
+	commands[name].edits = true
+}
+
+func getCommand(name string) (*Command, bool) {
+	command, ok := commands[name]
+	return command, ok
+}
+
+func newCommandContext(args []string) *CommandContext {
+	return &CommandContext{args: args, updateLengthIndex: true, resetSelected: true}
+}
+
+// Runs the command, returns false if there is no command with that name
+func (e *Editor) runCommand(name string, c *CommandContext) bool {
+	command, ok := getCommand(name)
+	if !ok {
+		e.debugLog("unknown command:", name)
+		return false
+	}
+
+	// Not run at all so the cursor doesn't move and the user is told once
+	if command.edits && !e.checkEditable() {
+		c.resetSelected = false
+		return true
+	}
+
+	command.run(e, c)
+	return true
+}
+
+// Extends the selection to where the cursor moved
+func (e *Editor) extendSelection(c *CommandContext) {
+	c.resetSelected = false
+	e.selectedYEnd = e.y
+	e.selectedXEnd = e.x
+}
+
+// Returns the arguments as one string, or what the user types in the mini window if there are none
+func (e *Editor) getCommandInput(c *CommandContext, label string) string {
+	if len(c.args) > 0 {
+		return strings.Join(c.args, " ")
+	}
+	return e.miniWindow.whileRun(true, label)
+}
+
+func init() {
+	registerCommand("quit", "close the editor", func(e *Editor, c *CommandContext) {
+		anyUnsaved := false
+		for _, modified := range e.modified {
+			if modified {
+				anyUnsaved = true
+				break
+			}
+		}
+		if anyUnsaved {
+			str := e.miniWindow.whileRun(true, "unsaved, are you sure? (y/n)")
+			if strings.ToLower(str) != "y" {
+				return
+			}
+		}
+
+		c.exit = true
+	})
+	registerCommand("save", "save the current file, a file without a name is saved with the one typed", func(e *Editor, c *CommandContext) {
+		path := e.path
+		if e.unnamed[e.path] && !e.readOnly[e.path] {
+			path = strings.TrimSpace(e.miniWindow.whileRun(true, "save as"))
+			if path == "" {
+				return
+			}
+
+			path = e.getOpenedPath(path)
+			if _, ok := e.openPathsToNames[path]; ok {
+				e.showMessage(path + " is open already")
+				return
+			}
+		}
+
+		err := e.Save(path)
+		if errors.Is(err, ErrReadOnly) {
+			e.showMessage(e.openPathsToNames[e.path] + " is read-only")
+		} else if err != nil {
+			log.Println(err)
+			e.popupWindow.pop("Failed to save!")
+		} else {
+			if path != e.path {
+				e.nameFile(path)
+			}
+			e.drawHeader()
+			e.showMessage("Saved " + e.openPathsToNames[e.path])
+		}
+	})
+	registerCommand("open", "open a file, the file menu is shown if no path is given", func(e *Editor, c *CommandContext) {
+		path := strings.Join(c.args, " ")
+		picked := path == ""
+		if picked {
+			var err error
+			path, err = e.menuWindow.run(e)
+			if err != nil {
+				e.debugLog(err)
+			}
+		}
+
+		if path == "" {
+			return
+		}
+
+		// A file can be picked by another path than it is open with, like a recent file outside the working directory
+		path = e.getOpenedPath(path)
+		_, opened := e.openPathsToNames[path]
+		err := e.Load(path)
+		if err != nil {
+			e.debugLog(err)
+			e.showMessage(err.Error())
+			return
+		}
+
+		// Load only counts files that weren't open, picking one in the menu is a visit too
+		if picked && opened {
+			e.addRecentFile(path)
+		}
+	})
+	registerCommand("close_file", "close the current file", func(e *Editor, c *CommandContext) {
+		if e.modified[e.path] {
+			str := e.miniWindow.whileRun(true, "unsaved, are you sure? (y/n)")
+			if strings.ToLower(str) != "y" {
+				return
+			}
+		}
+
+		if len(e.openedFiles) == 1 {
+			c.exit = true
+			return
+		}
+
+		e.exitFile(e.path)
+	})
+	registerCommand("next_file", "switch to the next open file", func(e *Editor, c *CommandContext) {
+		e.switchFile(1)
+	})
+	registerCommand("previous_file", "switch to the previous open file", func(e *Editor, c *CommandContext) {
+		e.switchFile(-1)
+	})
+	registerCommand("find", "find text in the file", (*Editor).findCommand)
+	registerEditCommand("replace", "find and replace text in the file", (*Editor).replaceCommand)
+	registerCommand("goto", "go to a line, -1 for the last one", func(e *Editor, c *CommandContext) {
+		lineNr, err := strconv.Atoi(e.getCommandInput(c, "goto"))
+		if err != nil {
+			return
+		}
+
+		if lineNr == -1 {
+			lineNr = len(e.lines)
+		}
+
+		e.moveXto(0)
+		e.inlinePosition = 0
+		e.moveYto(lineNr - 1)
+	})
+	registerEditCommand("undo", "undo the last change", func(e *Editor, c *CommandContext) {
+		e.undoTransaction()
+	})
+	registerEditCommand("redo", "redo the last undone change", func(e *Editor, c *CommandContext) {
+		e.redoTransaction()
+	})
+	registerCommand("copy", "copy the selection, or the current line, to the clipboard or the register given", func(e *Editor, c *CommandContext) {
+		name := ""
+		if len(c.args) > 0 {
+			name = c.args[0]
+		}
+		e.copyToRegister(name, false)
+	})
+	registerEditCommand("cut", "cut the selection, or the current line, to the clipboard or the register given", func(e *Editor, c *CommandContext) {
+		name := ""
+		if len(c.args) > 0 {
+			name = c.args[0]
+		}
+		e.copyToRegister(name, true)
+	})
+	registerCommand("select_all", "select the whole file", func(e *Editor, c *CommandContext) {
+		e.selectedYStart = 0
+		e.selectedXStart = 0
+		e.selectedXEnd = len(e.lines[len(e.lines)-1])
+		e.selectedYEnd = len(e.lines) - 1
+
+		e.moveYto(e.selectedYEnd)
+		e.moveXto(e.selectedXEnd)
+		c.resetSelected = false
+	})
+	registerEditCommand("delete_line", "delete the current line", func(e *Editor, c *CommandContext) {
+		e.deleteLines(e.y, 1)
+		e.moveY(0)
+	})
+	registerEditCommand("lines", "run a line operation: sort [-nir], unique, shuffle, reverse, join, duplicate", func(e *Editor, c *CommandContext) {
+		e.runLineOperation(e.getCommandInput(c, "lines (sort [-nir], unique, shuffle, reverse, join, duplicate)"))
+		c.resetSelected = false
+	})
+	registerEditCommand("move_lines_down", "move the selected lines down", func(e *Editor, c *CommandContext) {
+		e.moveLines(1)
+		c.resetSelected = false
+	})
+	registerEditCommand("move_lines_up", "move the selected lines up", func(e *Editor, c *CommandContext) {
+		e.moveLines(-1)
+		c.resetSelected = false
+	})
+	registerEditCommand("duplicate_lines", "duplicate the selected lines", func(e *Editor, c *CommandContext) {
+		e.duplicateLines()
+		c.resetSelected = false
+	})
+	registerEditCommand("toggle_comment", "comment or uncomment the selected lines", func(e *Editor, c *CommandContext) {
+		e.toggleComment()
+		c.resetSelected = false
+	})
+	registerCommand("toggle_soft_wrap", "wrap long lines of the current file", func(e *Editor, c *CommandContext) {
+		e.toggleSoftWrap()
+		c.resetSelected = false
+	})
+	registerCommand("toggle_fold", "fold or unfold the block at the cursor", func(e *Editor, c *CommandContext) {
+		e.toggleFold()
+	})
+	registerCommand("fold", "run a fold command: fold, unfold, toggle, all, none", func(e *Editor, c *CommandContext) {
+		e.runFoldCommand(e.getCommandInput(c, "fold (fold, unfold, toggle, all, none)"))
+	})
+	registerCommand("terminal", "open or close the terminal, keys go to it until Ctrl+T is pressed", func(e *Editor, c *CommandContext) {
+		if !e.terminalOpened {
+			e.resizeWindows()
+
+			e.runTerminal()
+		} else {
+			e.resizeWindows()
+		}
+	})
+	registerCommand("focus_terminal", "type in the terminal, it is opened if it is closed", func(e *Editor, c *CommandContext) {
+		if !e.terminalOpened {
+			e.resizeWindows()
+		}
+		e.runTerminal()
+	})
+	registerCommand("record_macro", "start or stop recording a macro", func(e *Editor, c *CommandContext) {
+		if !macros.replaying {
+			e.toggleMacroRecording()
+		}
+	})
+	registerCommand("replay_last_macro", "replay the last recorded or replayed macro", func(e *Editor, c *CommandContext) {
+		e.replayMacro("", 1)
+	})
+	registerCommand("replay_macro", "replay a macro: register [times|*]", func(e *Editor, c *CommandContext) {
+		str := e.getCommandInput(c, "replay macro (register [times|*])")
+		if str != "" {
+			e.runMacroCommand(str)
+		}
+	})
+
+	registerCommand("up", "move the cursor up", func(e *Editor, c *CommandContext) {
+		e.moveCursorY(-1)
+		c.updateLengthIndex = false
+	})
+	registerCommand("down", "move the cursor down", func(e *Editor, c *CommandContext) {
+		e.moveCursorY(1)
+		c.updateLengthIndex = false
+	})
+	registerCommand("left", "move the cursor left", func(e *Editor, c *CommandContext) {
+		e.moveX(-1)
+	})
+	registerCommand("right", "move the cursor right", func(e *Editor, c *CommandContext) {
+		e.moveX(1)
+	})
+	registerCommand("word_left", "move the cursor to the previous word", func(e *Editor, c *CommandContext) {
+		e.ctrlMoveLeft()
+	})
+	registerCommand("word_right", "move the cursor to the next word", func(e *Editor, c *CommandContext) {
+		e.ctrlMoveRight()
+	})
+	registerCommand("line_start", "move the cursor to the start of the line", func(e *Editor, c *CommandContext) {
+		e.moveXto(0)
+	})
+	registerCommand("line_end", "move the cursor to the end of the line", func(e *Editor, c *CommandContext) {
+		e.moveXto(len(e.lines[e.y]))
+	})
+	registerCommand("file_start", "move the cursor to the first line", func(e *Editor, c *CommandContext) {
+		e.moveY(-e.y)
+		c.updateLengthIndex = false
+	})
+	registerCommand("file_end", "move the cursor to the last line", func(e *Editor, c *CommandContext) {
+		e.moveY(len(e.lines) - e.y)
+		c.updateLengthIndex = false
+	})
+	registerCommand("page_up", "move a screen up", func(e *Editor, c *CommandContext) {
+		e.printLinesIndex = utils.Max(e.printLinesIndex-e.maxY, 0)
+		e.moveY(-e.maxY)
+	})
+	registerCommand("page_down", "move a screen down", func(e *Editor, c *CommandContext) {
+		e.printLinesIndex = utils.Min(e.printLinesIndex+e.maxY, len(e.lines))
+		e.moveY(e.maxY)
+	})
+	registerCommand("scroll_up", "scroll up a line without moving the cursor", func(e *Editor, c *CommandContext) {
+		e.printLinesIndex = utils.Max(e.printLinesIndex-1, 0)
+		c.resetSelected = false
+	})
+	registerCommand("scroll_down", "scroll down a line without moving the cursor", func(e *Editor, c *CommandContext) {
+		e.printLinesIndex = utils.Min(e.printLinesIndex+1, len(e.lines))
+		c.resetSelected = false
+	})
+
+	registerCommand("select_up", "extend the selection up", func(e *Editor, c *CommandContext) {
+		e.moveCursorY(-1)
+		c.updateLengthIndex = false
+		e.extendSelection(c)
+	})
+	registerCommand("select_down", "extend the selection down", func(e *Editor, c *CommandContext) {
+		e.moveCursorY(1)
+		c.updateLengthIndex = false
+		e.extendSelection(c)
+	})
+	registerCommand("select_left", "extend the selection left", func(e *Editor, c *CommandContext) {
+		e.moveX(-1)
+		e.extendSelection(c)
+	})
+	registerCommand("select_right", "extend the selection right", func(e *Editor, c *CommandContext) {
+		e.moveX(1)
+		e.extendSelection(c)
+	})
+	registerCommand("select_word_left", "extend the selection to the previous word", func(e *Editor, c *CommandContext) {
+		e.ctrlMoveLeft()
+		e.extendSelection(c)
+	})
+	registerCommand("select_word_right", "extend the selection to the next word", func(e *Editor, c *CommandContext) {
+		e.ctrlMoveRight()
+		e.extendSelection(c)
+	})
+	registerCommand("select_line_start", "extend the selection to the start of the line", func(e *Editor, c *CommandContext) {
+		e.moveXto(0)
+		c.resetSelected = false
+		e.selectedXEnd = e.x
+	})
+	registerCommand("select_line_end", "extend the selection to the end of the line", func(e *Editor, c *CommandContext) {
+		e.moveXto(len(e.lines[e.y]))
+		c.resetSelected = false
+		e.selectedXEnd = e.x
+	})
+
+	registerEditCommand("newline", "split the line at the cursor", func(e *Editor, c *CommandContext) {
+		if e.selected != "" {
+			e.removeSelection()
+		}
+
+		newLine := e.lines[e.y][e.x:]
+		e.remove(e.y, len(e.lines[e.y]), len(e.lines[e.y])-e.x)
+		e.addLines(e.y+1, []string{newLine})
+
+		e.moveY(1)
+		e.moveXto(0)
+	})
+	registerEditCommand("tab", "insert a tab", func(e *Editor, c *CommandContext) {
+		if e.selected != "" {
+			e.removeSelection()
+		}
+
+		e.insert(e.y, e.x, "\t")
+		e.moveX(1)
+	})
+	registerEditCommand("backspace", "delete the selection or the character before the cursor", func(e *Editor, c *CommandContext) {
+		if e.selected != "" {
+			e.removeSelection()
+			return
+		}
+
+		if e.removeAutoPair() {
+			return
+		}
+
+		x := e.x
+		y := e.y
+		e.moveX(-1)
+		e.remove(y, x, 1)
+	})
+}
+
+// Selects the matches of what is typed in the mini window, one at a time
+func (e *Editor) findCommand(c *CommandContext) {
+	for {
+		str := e.miniWindow.whileRun(false, "find")
+		if str == "" {
+			break
+		}
+
+		y, x := e.find(str)
+		if y == -1 || x == -1 {
+			continue
+		}
+
+		e.debugLog("y, x", y, x)
+		e.moveYto(y)
+		e.moveXto(x)
+
+		e.debugLog("after move y, x", e.y, e.x)
+
+		e.debugLog("x is:", e.x)
+		c.resetSelected = false
+		e.selectedXStart = e.x
+		e.selectedYStart = e.y
+		e.selectedXEnd = e.x + len(str)
+		e.selectedYEnd = e.y
+
+		e.draw()
+	}
+}
+
+func (e *Editor) replaceCommand(c *CommandContext) {
+	for {
+		str1 := e.miniWindow.whileRun(false, "replace(find)")
+		if str1 == "" {
+			break
+		}
+
+		y, x := e.find(str1)
+		if y == -1 || x == -1 {
+			continue
+		}
+
+		e.moveYto(y)
+		e.moveXto(x)
+
+		c.resetSelected = false
+		e.selectedXStart = e.x
+		e.selectedYStart = e.y
+		e.selectedXEnd = e.x + len(str1)
+		e.selectedYEnd = e.y
+
+		e.draw()
+
+		str2 := e.miniWindow.whileRun(false, "replace(overwrite)")
+		if str2 == "" {
+			break
+		}
+
+		e.removeSelection()
+		e.insert(e.selectedYStart, e.selectedXStart, str2)
+		e.selectedXEnd = e.x + len(str2)
+
+		e.draw()
+		e.transactions.submit(e.y, e.x)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+)
+
+// Returns the line comment token of the current highlighting, the first of the comment tokens
+func (e *Editor) getLineComment() string {
+	if e.lexer == nil || e.lexer.config == nil || len(e.lexer.config.Comment.Tokens) == 0 {
+		return ""
+	}
+
+	return e.lexer.config.Comment.Tokens[0]
+}
+
+func (e *Editor) getBlockComment() (string, string, bool) {
+	if e.lexer == nil || e.lexer.config == nil || len(e.lexer.config.BlockComment) != 2 {
+		return "", "", false
+	}
+
+	return e.lexer.config.BlockComment[0], e.lexer.config.BlockComment[1], true
+}
+
+// Returns the lines the selection covers, or the current line if nothing is selected.
+// A selection ending at the very start of a line does not include that line
+func (e *Editor) getSelectedLines() (int, int) {
+	if !e.hasSelection() {
+		return e.y, e.y
+	}
+
+	startY, _, endY, endX := e.getSelectionBounds()
+	if endX == 0 && endY > startY {
+		endY--
+	}
+	return startY, endY
+}
+
+func getIndentation(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// Moves the cursor and the selection along with text inserted (or removed if delta is negative) at col on line y
+func (e *Editor) shiftColumns(y, col, delta int) {
+	if e.selectedYStart == y && e.selectedXStart >= col {
+		e.selectedXStart = utils.Max(e.selectedXStart+delta, col)
+	}
+	if e.selectedYEnd == y && e.selectedXEnd >= col {
+		e.selectedXEnd = utils.Max(e.selectedXEnd+delta, col)
+	}
+	if e.y == y && e.x >= col {
+		e.x = utils.Max(e.x+delta, col)
+	}
+}
+
+func (e *Editor) toggleComment() {
+	startY, endY := e.getSelectedLines()
+
+	if e.getLineComment() != "" {
+		e.toggleLineComments(startY, endY)
+	} else if _, _, ok := e.getBlockComment(); ok {
+		e.toggleBlockComment(startY, endY)
+	}
+}
+
+// Comments out the lines, or uncomments them if every non-empty line already is a comment
+func (e *Editor) toggleLineComments(startY, endY int) {
+	token := e.getLineComment()
+
+	allCommented := true
+	indentation := -1
+	for _, line := range e.lines[startY : endY+1] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(trimmed, token) {
+			allCommented = false
+		}
+
+		if indent := len(line) - len(trimmed); indentation == -1 || indent < indentation {
+			indentation = indent
+		}
+	}
+
+	if indentation == -1 { // Only empty lines
+		return
+	}
+
+	for y := startY; y <= endY; y++ {
+		line := e.lines[y]
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+
+		if allCommented {
+			col := len(line) - len(trimmed)
+			length := len(token)
+			if strings.HasPrefix(trimmed[len(token):], " ") {
+				length++
+			}
+
+			e.remove(y, col+length, length)
+			e.shiftColumns(y, col, -length)
+		} else {
+			e.insert(y, indentation, token+" ")
+			e.shiftColumns(y, indentation, len(token)+1)
+		}
+	}
+}
+
+// Wraps the lines in a block comment, or unwraps them if they already are wrapped in one
+func (e *Editor) toggleBlockComment(startY, endY int) {
+	start, end, _ := e.getBlockComment()
+
+	first := e.lines[startY]
+	last := e.lines[endY]
+	firstCol := len(getIndentation(first))
+	trimmedLast := strings.TrimRight(last, " \t")
+
+	if strings.HasPrefix(first[firstCol:], start) && strings.HasSuffix(trimmedLast, end) &&
+		(startY != endY || len(trimmedLast)-firstCol >= len(start)+len(end)) {
+		length := len(end)
+		if strings.HasSuffix(trimmedLast[:len(trimmedLast)-len(end)], " ") {
+			length++
+		}
+		e.remove(endY, len(trimmedLast), length)
+		e.shiftColumns(endY, len(trimmedLast)-length, -length)
+
+		length = len(start)
+		if strings.HasPrefix(e.lines[startY][firstCol+len(start):], " ") {
+			length++
+		}
+		e.remove(startY, firstCol+length, length)
+		e.shiftColumns(startY, firstCol, -length)
+		return
+	}
+
+	if strings.TrimSpace(first) == "" && startY == endY {
+		return
+	}
+
+	e.insert(endY, len(last), " "+end)
+	e.insert(startY, firstCol, start+" ")
+	e.shiftColumns(startY, firstCol, len(start)+1)
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/jonasfreyr/gim/terminal"
 )
 
 func JoinPath(paths ...string) string {
@@ -16,9 +19,16 @@ const GIM_PATH = ".gim"
 
 var HIGHLIGHTING_PATH = JoinPath(GIM_PATH, "highlighting")
 var EDITOR_CONFIG_PATH = JoinPath(GIM_PATH, "config.config")
+var MACROS_PATH = JoinPath(GIM_PATH, "macros")
+var KEYMAP_PATH = JoinPath(GIM_PATH, "keymap.json")
+var RECENT_COMMANDS_PATH = JoinPath(GIM_PATH, "recent_commands.json")
+var RECENT_FILES_PATH = JoinPath(GIM_PATH, "recent_files.json")
+var UNSAVED_PATH = JoinPath(GIM_PATH, "unsaved")
 
 var config *EditorConfig
 
+var editorConfigPath string // set with --config, the config in the gim folder is read when it is empty
+
 type TokensConfig struct {
 	Tokens []string `json:"tokens"`
 	Color  [3]int   `json:"color"`
@@ -37,6 +47,9 @@ type HighlightingConfig struct {
 	Types    TokensConfig `json:"types"`
 	Keywords TokensConfig `json:"keywords"`
 	Comment  TokensConfig `json:"comment"`
+
+	BlockComment []string `json:"block_comment"` // start and end of a block comment, used when toggling comments
+	AutoPairs    []string `json:"auto_pairs"`    // two character strings, opener followed by closer
 }
 
 // EditorConfig TODO: don't know if this is the best way to go about this
@@ -47,6 +60,30 @@ type EditorConfig struct {
 	TabWidth        int         `json:"tab_width"`
 	FolderColor     ColorConfig `json:"folder_color"`
 	FileColor       ColorConfig `json:"file_color"`
+
+	FileIgnorePatterns []string `json:"file_ignore_patterns"` // left out of the file finder like lines of a .gitignore
+	FileFinderLimit    int      `json:"file_finder_limit"`    // files the file finder looks through at most, 0 for no limit
+
+	SoftWrap          bool     `json:"soft_wrap"`            // wrap long lines in every file
+	SoftWrapFileTypes []string `json:"soft_wrap_file_types"` // extensions of files that are wrapped
+	WrapAtWords       bool     `json:"wrap_at_words"`
+	WrapIndicator     string   `json:"wrap_indicator"` // shown in the line numbers for rows that continue a line
+
+	FoldMethod  string `json:"fold_method"` // "syntax" for brackets or "indent" for indentation
+	FoldMarker  string `json:"fold_marker"` // shown in the line numbers for folded lines
+	FoldSummary string `json:"fold_summary"`
+
+	VimMode bool `json:"vim_mode"` // start in vim style modal editing
+
+	Clipboard string `json:"clipboard"` // "system", "osc52" to copy through the terminal, or "internal"
+
+	StatusLineLeft  []string `json:"status_line_left"` // segments of the status line, it is hidden when both sides are empty
+	StatusLineRight []string `json:"status_line_right"`
+
+	Shell              string `json:"shell"`               // the command terminal tabs start, $SHELL when it is empty
+	TerminalScrollback int    `json:"terminal_scrollback"` // lines of output kept in each terminal tab
+
+	TerminalBracketedPaste string `json:"terminal_bracketed_paste"` // "auto", "always" or "never" mark text sent to the terminal as pasted
 }
 
 func InitHomeFolder() {
@@ -73,15 +110,15 @@ func ReadHighlightingConfig(path string) (*HighlightingConfig, error) {
 	}
 	defer f.Close()
 
-	var config HighlightingConfig
+	config := getDefaultHighlightingConfigValues()
 	decoder := json.NewDecoder(f)
-	err = decoder.Decode(&config)
+	err = decoder.Decode(config)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	return config, nil
 }
 
 func EnsureGimFolderExists() error {
@@ -106,6 +143,30 @@ func getDefaultEditorConfigValues() *EditorConfig {
 		TabWidth:        4,
 		FolderColor:     ColorConfig{Color: [3]int{104, 151, 187}},
 		FileColor:       ColorConfig{Color: [3]int{254, 254, 254}},
+
+		FileIgnorePatterns: []string{".git/", ".hg/", ".svn/", "node_modules/"},
+		FileFinderLimit:    50000,
+
+		SoftWrap:          false,
+		SoftWrapFileTypes: []string{"md", "txt"},
+		WrapAtWords:       true,
+		WrapIndicator:     "->",
+
+		FoldMethod:  "syntax",
+		FoldMarker:  "+",
+		FoldSummary: " ... ",
+
+		VimMode: false,
+
+		Clipboard: CLIPBOARD_SYSTEM,
+
+		StatusLineLeft:  []string{"file", "modified", "read_only", "git_branch"},
+		StatusLineRight: []string{"indentation", "encoding", "line_ending", "file_type", "position", "percent"},
+
+		Shell:              "",
+		TerminalScrollback: terminal.DEFAULT_SCROLLBACK,
+
+		TerminalBracketedPaste: BRACKETED_PASTE_AUTO,
 	}
 }
 
@@ -140,6 +201,8 @@ func getDefaultHighlightingConfigValues() *HighlightingConfig {
 		Types:    tokenConfig,
 		Keywords: tokenConfig,
 		Comment:  tokenConfig,
+
+		AutoPairs: []string{"()", "[]", "{}", "\"\"", "''"},
 	}
 }
 
@@ -183,18 +246,86 @@ func GetEditorConfig() *EditorConfig {
 	return config
 }
 
-func ReadEditorConfig() {
-	f, err := os.Open(JoinPath(getHomePath(), EDITOR_CONFIG_PATH))
+func getEditorConfigPath() string {
+	if editorConfigPath != "" {
+		return editorConfigPath
+	}
+	return JoinPath(getHomePath(), EDITOR_CONFIG_PATH)
+}
+
+// Reads the config from path instead of the gim folder, it is checked to be a valid config first
+func SetEditorConfigPath(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, getDefaultEditorConfigValues())
+	if err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	editorConfigPath = path
+	return nil
+}
+
+func ReadEditorConfig() {
+	f, err := os.Open(getEditorConfigPath())
+	if err != nil && editorConfigPath == "" {
 		config, err = createDefaultEditorConfig()
 	}
 	defer f.Close()
 
+	// Start from the defaults so options missing from older config files still get a value
+	config = getDefaultEditorConfigValues()
 	decoder := json.NewDecoder(f)
-	err = decoder.Decode(&config)
+	err = decoder.Decode(config)
 
 	if err != nil {
 		return
 	}
 
 }
+
+// Sets the option with the json name to value, the value is read as json or as a string if it isn't json
+func SetEditorConfigOption(name, value string) error {
+	if config == nil {
+		config = getDefaultEditorConfigValues()
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	options := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &options)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := options[name]; !ok {
+		return fmt.Errorf("unknown option %s", name)
+	}
+
+	raw := json.RawMessage(value)
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(value)
+	}
+	options[name] = raw
+
+	data, err = json.Marshal(options)
+	if err != nil {
+		return err
+	}
+
+	// Decoded into a copy so a bad value doesn't change anything
+	updated := *config
+	err = json.Unmarshal(data, &updated)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %s", name, value)
+	}
+
+	*config = updated
+	return nil
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jonasfreyr/gim/utils"
+)
+
+var TRASH_PATH = JoinPath(GIM_PATH, "trash")
+
+// The commands of the file menu run on the selected file, the others are given the folder it shows
+var selectedFileCommands = []string{"rename_file", "duplicate_file", "delete_file"}
+
+func getTrashPath() string {
+	return JoinPath(getHomePath(), TRASH_PATH)
+}
+
+// Returns whether the user answers y to the question
+func (e *Editor) confirm(question string) bool {
+	answer := e.miniWindow.whileRun(true, question+" (y/n)")
+	return strings.ToLower(answer) == "y"
+}
+
+// Asks for a path with text already typed in, returns an empty string when cancelled
+func (e *Editor) promptPath(label, text string) string {
+	e.miniWindow.texts[label] = text
+	e.miniWindow.x[label] = len(text)
+	return strings.TrimSpace(e.miniWindow.whileRun(false, label))
+}
+
+func checkNotExists(path string) error {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return errors.New(path + " already exists")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Makes an empty file, and the directories it is in if they are missing
+func createFile(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Copies a file, or a directory with everything in it. Symlinks are copied as links
+func copyPath(source, target string) error {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case info.IsDir():
+		err = os.Mkdir(target, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(source)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err = copyPath(filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Moves a file or directory, it is copied when it is moved to another file system
+func movePath(source, target string) error {
+	err := os.Rename(source, target)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	err = copyPath(source, target)
+	if err != nil {
+		_ = os.RemoveAll(target)
+		return err
+	}
+	return os.RemoveAll(source)
+}
+
+// Returns the open files that are path or in it, with their paths after it is moved to target
+func (e *Editor) getOpenFilesIn(path, target string) map[string]string {
+	absolute := getAbsolutePath(path)
+	absoluteTarget := getAbsolutePath(target)
+
+	moved := make(map[string]string)
+	for _, opened := range e.openedFiles {
+		relative, err := filepath.Rel(absolute, getAbsolutePath(opened))
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+		moved[opened] = e.getOpenedPath(filepath.Join(absoluteTarget, relative))
+	}
+	return moved
+}
+
+// Moves everything kept about an open file over to its new path, views showing it show the new path
+func (e *Editor) renameOpenFile(path, newPath string) {
+	e.openPathsToNames[newPath] = filepath.Base(newPath)
+	delete(e.openPathsToNames, path)
+
+	if modified, ok := e.modified[path]; ok {
+		e.modified[newPath] = modified
+		delete(e.modified, path)
+	}
+	if buffer, ok := e.buffers[path]; ok {
+		e.buffers[newPath] = buffer
+		delete(e.buffers, path)
+	}
+	if tempFilePath, ok := e.tempFilePaths[path]; ok {
+		e.tempFilePaths[newPath] = tempFilePath
+		delete(e.tempFilePaths, path)
+	}
+	if pos, ok := e.tempFilePos[path]; ok {
+		e.tempFilePos[newPath] = pos
+		delete(e.tempFilePos, path)
+	}
+	if softWrap, ok := e.softWrap[path]; ok {
+		e.softWrap[newPath] = softWrap
+		delete(e.softWrap, path)
+	}
+	if folds, ok := e.folds[path]; ok {
+		e.folds[newPath] = folds
+		delete(e.folds, path)
+	}
+	if format, ok := e.formats[path]; ok {
+		e.formats[newPath] = format
+		delete(e.formats, path)
+	}
+	if readOnly, ok := e.readOnly[path]; ok {
+		e.readOnly[newPath] = readOnly
+		delete(e.readOnly, path)
+	}
+
+	// Keeps its place among the tabs
+	e.openedFiles[utils.Index(e.openedFiles, path)] = newPath
+
+	for _, v := range e.views {
+		if v.path != path {
+			continue
+		}
+		v.path = newPath
+
+		// The file type can change with the name
+		fileExtension := strings.ReplaceAll(filepath.Ext(newPath), ".", "")
+		if fileExtension != "" {
+			err := v.lexer.SetHighlighting(fileExtension)
+			if err != nil {
+				e.debugLog(err)
+			}
+		}
+	}
+}
+
+// Gives the current unnamed file the name it was saved with, it is then like any file opened from there
+func (e *Editor) nameFile(path string) {
+	delete(e.unnamed, e.path)
+	e.renameOpenFile(e.path, path)
+	e.addRecentFile(path)
+	e.calculateHeaderOffset()
+}
+
+// Closes the open files that were deleted, ones with unsaved changes are kept open and saving them makes them again
+func (e *Editor) removeOpenFile(path string) {
+	if e.modified[path] {
+		return
+	}
+
+	if len(e.openedFiles) == 1 {
+		// The editor needs a file open, it is kept as an unsaved file
+		e.modified[path] = true
+		return
+	}
+	e.exitFile(path)
+}
+
+// Asks for a name and makes the file in dir, returns the path of the file
+func (e *Editor) newFile(dir string) (string, error) {
+	name := e.promptPath("new file", "")
+	if name == "" {
+		return "", nil
+	}
+
+	path := filepath.Join(dir, name)
+	err := checkNotExists(path)
+	if err != nil {
+		return "", err
+	}
+	return path, createFile(path)
+}
+
+// Asks for a name and makes the directory in dir, returns its path
+func (e *Editor) newFolder(dir string) (string, error) {
+	name := e.promptPath("new folder", "")
+	if name == "" {
+		return "", nil
+	}
+
+	path := filepath.Join(dir, name)
+	err := checkNotExists(path)
+	if err != nil {
+		return "", err
+	}
+	return path, os.MkdirAll(path, os.ModePerm)
+}
+
+// Returns where path goes when it is moved or copied to target, into target if it is a directory
+func getTargetPath(path, target string) (string, error) {
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		target = filepath.Join(target, filepath.Base(path))
+	}
+
+	if getAbsolutePath(target) == getAbsolutePath(path) {
+		return "", errors.New(path + " is already there")
+	}
+
+	err := checkNotExists(target)
+	if err != nil {
+		return "", err
+	}
+	return target, os.MkdirAll(filepath.Dir(target), os.ModePerm)
+}
+
+// Asks where to move the file or directory and moves it, the open files in it follow
+func (e *Editor) renamePath(path string) error {
+	target := e.promptPath("move to", path)
+	if target == "" || target == path {
+		return nil
+	}
+
+	target, err := getTargetPath(path, target)
+	if err != nil {
+		return err
+	}
+
+	// The paths are found before the files are gone
+	moved := e.getOpenFilesIn(path, target)
+	for _, newPath := range moved {
+		if _, ok := e.openPathsToNames[newPath]; ok {
+			return errors.New(newPath + " is open")
+		}
+	}
+
+	err = movePath(path, target)
+	if err != nil {
+		return err
+	}
+
+	for opened, newPath := range moved {
+		e.renameOpenFile(opened, newPath)
+	}
+	e.moveRecentFiles(path, target)
+	e.calculateHeaderOffset()
+	e.showMessage("Moved " + path + " to " + target)
+	return nil
+}
+
+// Asks for the name of the copy and copies the file or directory
+func (e *Editor) duplicatePath(path string) error {
+	target := e.promptPath("duplicate as", path)
+	if target == "" || target == path {
+		return nil
+	}
+
+	target, err := getTargetPath(path, target)
+	if err != nil {
+		return err
+	}
+
+	err = copyPath(path, target)
+	if err != nil {
+		return err
+	}
+	e.showMessage("Copied " + path + " to " + target)
+	return nil
+}
+
+// Moves the file or directory to the trash after asking, open files in it are closed
+func (e *Editor) deletePath(path string) error {
+	if !e.confirm("delete " + path + "?") {
+		return nil
+	}
+
+	err := os.MkdirAll(getTrashPath(), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Prefixed with the time so files with the same name don't replace each other
+	trashed := filepath.Join(getTrashPath(), time.Now().Format("20060102-150405.000")+"-"+filepath.Base(path))
+	deleted := e.getOpenFilesIn(path, trashed)
+
+	err = movePath(path, trashed)
+	if err != nil {
+		return err
+	}
+
+	for opened := range deleted {
+		e.removeOpenFile(opened)
+	}
+	e.moveRecentFiles(path, "")
+	e.calculateHeaderOffset()
+	e.showMessage("Moved " + path + " to the trash")
+	return nil
+}
+
+// Tells the user why changing a file failed
+func (e *Editor) showFileChangeError(err error) {
+	if err != nil {
+		e.debugLog(err)
+		e.showMessage(err.Error())
+	}
+}
+
+// Returns the file given to the command, the current file if none is
+func (e *Editor) getCommandFile(c *CommandContext) string {
+	if len(c.args) > 0 {
+		return strings.Join(c.args, " ")
+	}
+	return e.path
+}
+
+func init() {
+	registerCommand("new_file", "make a file in the folder given, or the one of the current file, and open it", func(e *Editor, c *CommandContext) {
+		dir := filepath.Dir(e.path)
+		if len(c.args) > 0 {
+			dir = strings.Join(c.args, " ")
+		}
+
+		path, err := e.newFile(dir)
+		if err != nil || path == "" {
+			e.showFileChangeError(err)
+			return
+		}
+		c.created = path
+		e.runCommand("open", newCommandContext([]string{path}))
+	})
+	registerCommand("new_folder", "make a folder in the folder given, or the one of the current file", func(e *Editor, c *CommandContext) {
+		dir := filepath.Dir(e.path)
+		if len(c.args) > 0 {
+			dir = strings.Join(c.args, " ")
+		}
+
+		path, err := e.newFolder(dir)
+		if err != nil || path == "" {
+			e.showFileChangeError(err)
+			return
+		}
+		c.created = path
+		e.showMessage("Made " + path)
+	})
+	registerCommand("rename_file", "move the file or folder given, or the current file, the open files in it follow", func(e *Editor, c *CommandContext) {
+		e.showFileChangeError(e.renamePath(e.getCommandFile(c)))
+	})
+	registerCommand("duplicate_file", "copy the file or folder given, or the current file", func(e *Editor, c *CommandContext) {
+		e.showFileChangeError(e.duplicatePath(e.getCommandFile(c)))
+	})
+	registerCommand("delete_file", "move the file or folder given, or the current file, to the trash", func(e *Editor, c *CommandContext) {
+		e.showFileChangeError(e.deletePath(e.getCommandFile(c)))
+	})
+}
@@ -1,21 +1,24 @@
 package main
 
 import (
+	"github.com/jonasfreyr/gim/utils"
 	"github.com/lithammer/fuzzysearch/fuzzy"
 	gc "github.com/rthornton128/goncurses"
-	"github.com/yireyun/go-queue"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
-	"time"
 )
 
 type FileMenuWindow struct {
 	menuWindow *MenuWindow
 
+	walker   *FileWalker
 	subFiles map[string][]string
+
+	recent       []RecentFile // the files opened before, the highest frecency first
+	recentLoaded bool
 }
 
 func NewFileMenuWindow(y, x, h, w int) (*FileMenuWindow, error) {
@@ -26,6 +29,7 @@ func NewFileMenuWindow(y, x, h, w int) (*FileMenuWindow, error) {
 
 	mw := &FileMenuWindow{
 		menuWindow: menuWindow,
+		walker:     NewFileWalker(),
 	}
 	return mw, nil
 }
@@ -72,37 +76,12 @@ func (w *FileMenuWindow) getFiles(currentPath string) ([]MenuItem, error) {
 }
 
 func (w *FileMenuWindow) updateAllSubFilesAndDirectories(path string) error {
-	before := time.Now()
-
-	w.subFiles = make(map[string][]string)
-
-	q := queue.NewQueue(1000)
-	q.Put(path)
-
-	for q.Quantity() > 0 {
-		c, _, _ := q.Get()
-
-		currentPath, _ := c.(string)
-		w.subFiles[currentPath] = make([]string, 0)
-
-		fi, err := os.ReadDir(currentPath)
-		if err != nil {
-			return err
-		}
-		for _, subFile := range fi {
-			name := filepath.Join(currentPath, subFile.Name())
-
-			// log.Println("you got mail:", name)
-
-			if subFile.IsDir() {
-				q.Put(name)
-				continue
-			}
-			w.subFiles[currentPath] = append(w.subFiles[currentPath], name)
-		}
+	subFiles, err := w.walker.getSubFiles(path)
+	if err != nil {
+		return err
 	}
 
-	log.Println("walk: ", time.Since(before))
+	w.subFiles = subFiles
 	return nil
 }
 
@@ -120,8 +99,10 @@ func (w *FileMenuWindow) fuzzyFind(searchString, path string) ([]MenuItem, error
 	subFiles := w.getAllSublists(path)
 	res := fuzzy.Find(searchString, subFiles)
 
+	frecencies := w.getFrecencies()
+	wd, _ := os.Getwd()
 	sort.Slice(res, func(i, j int) bool {
-		return len(res[i]) < len(res[j])
+		return getFileScore(res[i], frecencies, wd) < getFileScore(res[j], frecencies, wd)
 	})
 
 	config := GetEditorConfig()
@@ -138,7 +119,25 @@ func (w *FileMenuWindow) fuzzyFind(searchString, path string) ([]MenuItem, error
 	return menuItems, nil
 }
 
-func (w *FileMenuWindow) run() (string, error) {
+// Returns the path of the selected item, empty when nothing that can be changed is selected
+func (w *FileMenuWindow) getSelectedPath() string {
+	items := w.menuWindow.items
+	if len(items) == 0 || items[w.menuWindow.selected].label == ".." {
+		return ""
+	}
+	return items[w.menuWindow.selected].value
+}
+
+// Finds the files again after a command could have changed them
+func (w *FileMenuWindow) refreshFiles(e *Editor) {
+	w.walker.invalidate()
+	err := w.updateAllSubFilesAndDirectories(".")
+	if err != nil {
+		e.debugLog(err)
+	}
+}
+
+func (w *FileMenuWindow) run(e *Editor) (string, error) {
 	gc.Cursor(0)
 	defer gc.Cursor(1)
 	currentPath := "."
@@ -148,28 +147,35 @@ func (w *FileMenuWindow) run() (string, error) {
 	if err != nil {
 		return "", err
 	}
+
+	// Found once as every one of them is checked on the disk, and again when files are changed
+	recentItems := w.getRecentItems()
 	for {
-		var menuItems []MenuItem
-		if searchString == "" {
-			menuItems, err = w.getFiles(currentPath)
-		} else {
-			menuItems, err = w.fuzzyFind(searchString, currentPath)
-		}
+		path, err := filepath.Abs(currentPath)
+		path2, err2 := filepath.Abs(".")
 
-		if err != nil {
-			return "", err
+		if path == path2 && (err == nil && err2 == nil) {
+			currentPath = "."
 		}
 
 		if updateItems {
+			var menuItems []MenuItem
+			if searchString == "" {
+				menuItems, err = w.getFiles(currentPath)
+				if currentPath == "." {
+					menuItems = mergeRecentItems(recentItems, menuItems)
+				}
+			} else {
+				menuItems, err = w.fuzzyFind(searchString, currentPath)
+			}
+
+			if err != nil {
+				return "", err
+			}
+
 			w.menuWindow.setItems(menuItems)
 			updateItems = false
 		}
-		path, err := filepath.Abs(currentPath)
-		path2, err2 := filepath.Abs(".")
-
-		if path == path2 && (err == nil && err2 == nil) {
-			currentPath = "."
-		}
 
 		title := currentPath
 		if searchString != "" {
@@ -184,8 +190,10 @@ func (w *FileMenuWindow) run() (string, error) {
 
 		w.menuWindow.draw(title)
 
-		ch := w.menuWindow.stdscr.GetChar() // TODO: dirt
+		ch := getChar(w.menuWindow.stdscr) // TODO: dirt
 		switch ch {
+		case gc.KEY_RESIZE:
+			onScreenResize()
 		case gc.KEY_ESC:
 			if currentPath == "." {
 				return "", nil
@@ -217,6 +225,32 @@ func (w *FileMenuWindow) run() (string, error) {
 			searchString = searchString[:len(searchString)-1]
 			updateItems = true
 		default:
+			if command, ok := e.keymap.resolveFileMenuKey(ch); ok {
+				target := currentPath
+				if utils.Contains(selectedFileCommands, command) {
+					target = w.getSelectedPath()
+					if target == "" {
+						continue
+					}
+				}
+
+				c := newCommandContext([]string{target})
+				e.runCommand(command, c)
+				w.refreshFiles(e)
+				recentItems = w.getRecentItems()
+				updateItems = true
+
+				// A new file is open already, a new folder is gone into
+				if info, err := os.Stat(c.created); err == nil {
+					if !info.IsDir() {
+						return "", nil
+					}
+					currentPath = c.created
+					searchString = ""
+				}
+				continue
+			}
+
 			chr := gc.KeyString(ch)
 			if len(chr) > 1 {
 				continue
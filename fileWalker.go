@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const WALKER_WORKERS = 8 // directories read at the same time
+
+// Files in every directory that list what the fuzzy finder leaves out, like git does
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+// ignoreRule is a line of an ignore file or an ignore pattern of the config
+type ignoreRule struct {
+	base     string   // the directory the rule was given in, relative to the root of the walk
+	pattern  []string // split at /
+	negate   bool     // starts with !, the path is not ignored after all
+	dirOnly  bool     // ends with /, only matches directories
+	anchored bool     // has a / before the end, matches from base instead of any name
+}
+
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:] // escapes a leading # or !
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.pattern = strings.Split(line, "/")
+	return rule, true
+}
+
+// Reads the rules of an ignore file, a missing file has none
+func readIgnoreFile(path, base string) []ignoreRule {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	rules := make([]ignoreRule, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// Matches the parts of a path against the parts of a pattern, ** matches any number of directories
+func matchParts(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+	matched, err := filepath.Match(pattern[0], parts[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchParts(pattern[1:], parts[1:])
+}
+
+// Returns whether the rule matches the path, which is relative to the root of the walk
+func (r ignoreRule) matches(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.base != "." {
+		relative, err := filepath.Rel(r.base, path)
+		if err != nil || strings.HasPrefix(relative, "..") {
+			return false
+		}
+		path = relative
+	}
+
+	if !r.anchored {
+		return matchParts(r.pattern, []string{filepath.Base(path)})
+	}
+	return matchParts(r.pattern, strings.Split(filepath.ToSlash(path), "/"))
+}
+
+// Returns whether the path is ignored, the last rule matching it decides
+func isIgnored(rules []ignoreRule, path string, isDir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(path, isDir) {
+			return !rules[i].negate
+		}
+	}
+	return false
+}
+
+// FileWalker finds every file under a directory for the fuzzy finder. The result is kept
+// until a directory it walked changes, it is told by watching them
+type FileWalker struct {
+	lock sync.Mutex
+
+	root     string              // the directory walked, absolute
+	subFiles map[string][]string // the files in each directory, relative to the working directory
+	stale    bool
+
+	watcher *fsnotify.Watcher // nil when the directories can't be watched, then they are walked every time
+}
+
+func NewFileWalker() *FileWalker {
+	w := &FileWalker{stale: true}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("failed to watch files:", err)
+		return w
+	}
+	w.watcher = watcher
+	go w.watch()
+	return w
+}
+
+// Marks the files as stale when a file is added, removed or renamed, or an ignore file changes
+func (w *FileWalker) watch() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			changed := event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0
+			for _, name := range ignoreFileNames {
+				if filepath.Base(event.Name) == name {
+					changed = true
+				}
+			}
+			if changed {
+				w.lock.Lock()
+				w.stale = true
+				w.lock.Unlock()
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been missed
+			log.Println("file watcher:", err)
+			w.lock.Lock()
+			w.stale = true
+			w.lock.Unlock()
+		}
+	}
+}
+
+func (w *FileWalker) Close() error {
+	if w.watcher == nil {
+		return nil
+	}
+	return w.watcher.Close()
+}
+
+// Makes the next search walk the directories again, for changes made before the watcher tells of them
+func (w *FileWalker) invalidate() {
+	w.lock.Lock()
+	w.stale = true
+	w.lock.Unlock()
+}
+
+// Returns the files in each directory under path, they are only walked again when something changed
+func (w *FileWalker) getSubFiles(path string) (map[string][]string, error) {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w.lock.Lock()
+	if !w.stale && w.root == root && w.watcher != nil {
+		subFiles := w.subFiles
+		w.lock.Unlock()
+		return subFiles, nil
+	}
+	w.stale = false
+	w.lock.Unlock()
+
+	if w.watcher != nil {
+		for _, dir := range w.watcher.WatchList() {
+			_ = w.watcher.Remove(dir)
+		}
+	}
+
+	subFiles, err := w.walk(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w.lock.Lock()
+	w.root = root
+	w.subFiles = subFiles
+	w.lock.Unlock()
+	return subFiles, nil
+}
+
+// Walks the directories under path concurrently. Directories that can't be read are left out,
+// symlinks to directories are followed unless they lead to one already walked
+func (w *FileWalker) walk(path string) (map[string][]string, error) {
+	before := time.Now()
+	config := GetEditorConfig()
+
+	// Real paths are absolute so the ones of symlinks can be compared with them
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	realRoot, err := filepath.EvalSymlinks(absolute)
+	if err != nil {
+		return nil, err
+	}
+
+	rootRules := make([]ignoreRule, 0)
+	for _, line := range config.FileIgnorePatterns {
+		if rule, ok := parseIgnoreRule(line, "."); ok {
+			rootRules = append(rootRules, rule)
+		}
+	}
+
+	var lock sync.Mutex // guards the fields below
+	subFiles := make(map[string][]string)
+	visited := map[string]bool{realRoot: true} // the absolute real paths of the directories walked
+	count := 0
+	truncated := false // stopped at the limit of files
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, WALKER_WORKERS)
+
+	var walkDir func(dir, realDir string, rules []ignoreRule)
+	walkDir = func(dir, realDir string, rules []ignoreRule) {
+		defer wg.Done()
+
+		workers <- struct{}{}
+		entries, err := os.ReadDir(dir)
+		<-workers
+		if err != nil {
+			log.Println("skipping directory:", err)
+			return
+		}
+
+		if w.watcher != nil {
+			err = w.watcher.Add(dir)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				// Changes in it would be missed, so it is walked again next time
+				log.Println("failed to watch", dir, err)
+				w.lock.Lock()
+				w.stale = true
+				w.lock.Unlock()
+			}
+		}
+
+		relativeDir, err := filepath.Rel(path, dir)
+		if err != nil {
+			return
+		}
+
+		// Rules of this directory come after the ones of its parents so they win
+		rules = append([]ignoreRule{}, rules...)
+		for _, name := range ignoreFileNames {
+			rules = append(rules, readIgnoreFile(filepath.Join(dir, name), relativeDir)...)
+		}
+
+		files := make([]string, 0)
+		for _, entry := range entries {
+			name := filepath.Join(dir, entry.Name())
+			relative := filepath.Join(relativeDir, entry.Name())
+
+			isDir := entry.IsDir()
+			realPath := filepath.Join(realDir, entry.Name())
+			if entry.Type()&os.ModeSymlink != 0 {
+				info, err := os.Stat(name)
+				if err != nil {
+					continue // broken link
+				}
+				isDir = info.IsDir()
+				if isDir {
+					realPath, err = filepath.EvalSymlinks(realPath)
+					if err != nil {
+						continue
+					}
+				}
+			}
+
+			if isIgnored(rules, relative, isDir) {
+				continue
+			}
+
+			if isDir {
+				lock.Lock()
+				seen := visited[realPath] || truncated
+				visited[realPath] = true
+				lock.Unlock()
+				if seen {
+					continue
+				}
+
+				wg.Add(1)
+				go walkDir(name, realPath, rules)
+				continue
+			}
+			files = append(files, name)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		if config.FileFinderLimit > 0 && count+len(files) > config.FileFinderLimit {
+			files = files[:config.FileFinderLimit-count]
+			truncated = true
+		}
+		count += len(files)
+		subFiles[dir] = files
+	}
+
+	wg.Add(1)
+	walkDir(path, realRoot, rootRules)
+	wg.Wait()
+
+	if truncated {
+		log.Println("walk stopped at", config.FileFinderLimit, "files")
+	}
+	log.Println("walk: ", time.Since(before))
+	return subFiles, nil
+}
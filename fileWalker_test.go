@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		line string
+		rule ignoreRule
+		ok   bool
+	}{
+		{"", ignoreRule{}, false},
+		{"   ", ignoreRule{}, false},
+		{"# comment", ignoreRule{}, false},
+		{"/", ignoreRule{}, false},
+		{"*.log", ignoreRule{base: ".", pattern: []string{"*.log"}}, true},
+		{"*.log  ", ignoreRule{base: ".", pattern: []string{"*.log"}}, true},
+		{"!keep.log", ignoreRule{base: ".", pattern: []string{"keep.log"}, negate: true}, true},
+		{`\#name`, ignoreRule{base: ".", pattern: []string{"#name"}}, true},
+		{`\!name`, ignoreRule{base: ".", pattern: []string{"!name"}}, true},
+		{"build/", ignoreRule{base: ".", pattern: []string{"build"}, dirOnly: true}, true},
+		{"/top", ignoreRule{base: ".", pattern: []string{"top"}, anchored: true}, true},
+		{"doc/*.md", ignoreRule{base: ".", pattern: []string{"doc", "*.md"}, anchored: true}, true},
+		{"a/**/b/", ignoreRule{base: ".", pattern: []string{"a", "**", "b"}, dirOnly: true, anchored: true}, true},
+	}
+
+	for _, test := range tests {
+		rule, ok := parseIgnoreRule(test.line, ".")
+		if ok != test.ok || !reflect.DeepEqual(rule, test.rule) {
+			t.Errorf("%q: got %+v %v, want %+v %v", test.line, rule, ok, test.rule, test.ok)
+		}
+	}
+}
+
+func TestIsIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		lines   []string
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"name", ".", []string{"*.log"}, "x.log", false, true},
+		{"name in a directory", ".", []string{"*.log"}, "a/b/x.log", false, true},
+		{"no match", ".", []string{"*.log"}, "x.go", false, false},
+		{"anchored", ".", []string{"/top"}, "top", false, true},
+		{"anchored in a directory", ".", []string{"/top"}, "sub/top", false, false},
+		{"slash in the middle anchors", ".", []string{"doc/*.md"}, "x/doc/a.md", false, false},
+		{"slash in the middle", ".", []string{"doc/*.md"}, "doc/a.md", false, true},
+		{"star doesn't cross directories", ".", []string{"doc/*.md"}, "doc/sub/a.md", false, false},
+
+		{"leading double star", ".", []string{"**/tmp"}, "a/b/tmp", true, true},
+		{"leading double star at the root", ".", []string{"**/tmp"}, "tmp", true, true},
+		{"double star in the middle", ".", []string{"a/**/z"}, "a/b/c/z", false, true},
+		{"double star matches no directory", ".", []string{"a/**/z"}, "a/z", false, true},
+		{"double star keeps the start", ".", []string{"a/**/z"}, "b/z", false, false},
+		{"trailing double star", ".", []string{"a/**"}, "a/x/y", false, true},
+
+		{"directory only", ".", []string{"build/"}, "a/build", true, true},
+		{"directory only skips files", ".", []string{"build/"}, "build", false, false},
+
+		{"negation", ".", []string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{"negation leaves others", ".", []string{"*.log", "!keep.log"}, "x.log", false, true},
+		{"last rule wins", ".", []string{"!keep.log", "*.log"}, "keep.log", false, true},
+
+		{"nested base", "sub", []string{"*.go"}, "sub/x/a.go", false, true},
+		{"outside the nested base", "sub", []string{"*.go"}, "a.go", false, false},
+		{"outside a nested base with the same prefix", "sub", []string{"*.go"}, "subway/a.go", false, false},
+		{"anchored to the nested base", "sub", []string{"/gen"}, "sub/gen", true, true},
+		{"anchored below the nested base", "sub", []string{"/gen"}, "sub/x/gen", true, false},
+	}
+
+	for _, test := range tests {
+		rules := make([]ignoreRule, 0)
+		for _, line := range test.lines {
+			rule, ok := parseIgnoreRule(line, test.base)
+			if !ok {
+				t.Fatalf("%s: invalid rule %q", test.name, line)
+			}
+			rules = append(rules, rule)
+		}
+
+		if ignored := isIgnored(rules, test.path, test.isDir); ignored != test.ignored {
+			t.Errorf("%s: %s ignored %v, want %v", test.name, test.path, ignored, test.ignored)
+		}
+	}
+}
+
+func TestMatchParts(t *testing.T) {
+	tests := []struct {
+		pattern, parts []string
+		matched        bool
+	}{
+		{[]string{"a"}, []string{"a"}, true},
+		{[]string{"a"}, []string{"a", "b"}, false},
+		{[]string{"*"}, []string{}, false},
+		{[]string{"**"}, []string{}, true},
+		{[]string{"**"}, []string{"a", "b"}, true},
+		{[]string{"a", "**", "b", "**", "c"}, []string{"a", "x", "b", "y", "z", "c"}, true},
+		{[]string{"a", "**", "c"}, []string{"a", "b"}, false},
+		{[]string{"[a"}, []string{"[a"}, false}, // invalid patterns match nothing
+	}
+
+	for _, test := range tests {
+		if matched := matchParts(test.pattern, test.parts); matched != test.matched {
+			t.Errorf("%v %v: got %v, want %v", test.pattern, test.parts, matched, test.matched)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":     "*.log\n!keep.log\nbuild/\n/top.txt\n",
+		"a.go":           "",
+		"x.log":          "",
+		"keep.log":       "",
+		"top.txt":        "",
+		"build/out.go":   "",
+		"sub/.gitignore": "*.go\n",
+		"sub/c.go":       "",
+		"sub/d.txt":      "",
+		"sub/top.txt":    "",
+		"sub/build":      "",
+		"node_modules/m": "",
+		".git/HEAD":      "",
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(text), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Links back to a directory already walked are left out instead of walked forever
+	err := os.Symlink(dir, filepath.Join(dir, "loop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("..", filepath.Join(dir, "sub", "back"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("missing", filepath.Join(dir, "broken"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file menu walks the working directory as "."
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	w := &FileWalker{stale: true}
+	subFiles, err := w.walk(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walked := make([]string, 0)
+	for _, paths := range subFiles {
+		walked = append(walked, paths...)
+	}
+	sort.Strings(walked)
+
+	expected := []string{".gitignore", "a.go", "keep.log", "sub/.gitignore", "sub/build", "sub/d.txt", "sub/top.txt"}
+	if !reflect.DeepEqual(walked, expected) {
+		t.Errorf("got %v, want %v", walked, expected)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+// Fold hides the lines after start up to and including end, start is still drawn with a summary
+type Fold struct {
+	start, end int
+}
+
+var foldBrackets = map[string]string{"{": "}", "(": ")", "[": "]"}
+
+func (e *Editor) getFolds() []Fold {
+	return e.folds[e.path]
+}
+
+// Returns the outermost fold hiding line y
+func (e *Editor) getHidingFold(y int) (Fold, bool) {
+	found := false
+	var outer Fold
+	for _, fold := range e.getFolds() {
+		if fold.start < y && y <= fold.end && (!found || fold.start < outer.start) {
+			outer = fold
+			found = true
+		}
+	}
+	return outer, found
+}
+
+func (e *Editor) isHidden(y int) bool {
+	_, hidden := e.getHidingFold(y)
+	return hidden
+}
+
+func (e *Editor) isFolded(y int) bool {
+	for _, fold := range e.getFolds() {
+		if fold.start == y {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the first line after y that is not hidden by a fold, can be len(e.lines) if there is none
+func (e *Editor) nextVisibleLine(y int) int {
+	y++
+	for {
+		fold, hidden := e.getHidingFold(y)
+		if !hidden {
+			return y
+		}
+		y = fold.end + 1
+	}
+}
+
+// Returns the first line before y that is not hidden by a fold, can be -1 if there is none
+func (e *Editor) previousVisibleLine(y int) int {
+	y--
+	for y >= 0 {
+		fold, hidden := e.getHidingFold(y)
+		if !hidden {
+			return y
+		}
+		y = fold.start
+	}
+	return y
+}
+
+// Moves delta visible lines from y, stopping at the first and last line
+func (e *Editor) stepVisibleLines(y, delta int) int {
+	for ; delta > 0; delta-- {
+		next := e.nextVisibleLine(y)
+		if next >= len(e.lines) {
+			break
+		}
+		y = next
+	}
+	for ; delta < 0; delta++ {
+		previous := e.previousVisibleLine(y)
+		if previous < 0 {
+			break
+		}
+		y = previous
+	}
+	return y
+}
+
+// Returns how many visible lines there are from start until end, negative if end is before start
+func (e *Editor) countVisibleLines(start, end int) int {
+	if end < start {
+		return -e.countVisibleLines(end, start)
+	}
+
+	count := 0
+	for y := start; y < end; y = e.nextVisibleLine(y) {
+		count++
+	}
+	return count
+}
+
+// Moves y out of a fold, past it if moving down or onto its first line if moving up
+func (e *Editor) skipFold(y, delta int) int {
+	fold, hidden := e.getHidingFold(y)
+	if !hidden {
+		return y
+	}
+
+	if delta > 0 && fold.end+1 < len(e.lines) {
+		return fold.end + 1
+	}
+	return fold.start
+}
+
+func (e *Editor) addFold(fold Fold) {
+	if fold.end <= fold.start {
+		return
+	}
+
+	for _, f := range e.getFolds() {
+		if f == fold {
+			return
+		}
+	}
+	e.folds[e.path] = append(e.folds[e.path], fold)
+}
+
+// Removes the folds starting on line y
+func (e *Editor) unfold(y int) {
+	if len(e.getFolds()) == 0 {
+		return
+	}
+
+	folds := make([]Fold, 0)
+	for _, fold := range e.getFolds() {
+		if fold.start != y {
+			folds = append(folds, fold)
+		}
+	}
+	e.folds[e.path] = folds
+}
+
+// Removes every fold hiding line y so it can be shown
+func (e *Editor) unfoldLine(y int) {
+	if len(e.getFolds()) == 0 {
+		return
+	}
+
+	folds := make([]Fold, 0)
+	for _, fold := range e.getFolds() {
+		if !(fold.start < y && y <= fold.end) {
+			folds = append(folds, fold)
+		}
+	}
+	e.folds[e.path] = folds
+}
+
+func (e *Editor) unfoldAll() {
+	delete(e.folds, e.path)
+}
+
+// Keeps the folds on the same lines when lines are added or deleted, folds that the change is inside of are removed
+func (e *Editor) shiftFolds(y, delta int) {
+	if len(e.getFolds()) == 0 {
+		return
+	}
+
+	folds := make([]Fold, 0)
+	for _, fold := range e.getFolds() {
+		if delta > 0 {
+			if fold.start >= y {
+				fold.start += delta
+				fold.end += delta
+			} else if y <= fold.end {
+				continue
+			}
+		} else {
+			if fold.start >= y-delta {
+				fold.start += delta
+				fold.end += delta
+			} else if fold.end >= y {
+				continue
+			}
+		}
+		folds = append(folds, fold)
+	}
+	e.folds[e.path] = folds
+}
+
+// Returns the blocks between brackets spanning more than one line, the lines with the closing brackets are not part of the block.
+// Uses the lexer so brackets in strings and comments are skipped
+func (e *Editor) getSyntaxBlocks() []Fold {
+	type opener struct {
+		closer string
+		line   int
+	}
+
+	blocks := make([]Fold, 0)
+	stack := make([]opener, 0)
+
+	tokens := e.lexer.Tokenize(strings.Join(e.lines, "\n"))
+	for _, line := range tokens {
+		for _, token := range line {
+			if closer, ok := foldBrackets[token.lexeme]; ok {
+				stack = append(stack, opener{closer: closer, line: token.location.line})
+				continue
+			}
+
+			if len(stack) == 0 || stack[len(stack)-1].closer != token.lexeme {
+				continue
+			}
+
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if token.location.line-1 > open.line {
+				blocks = append(blocks, Fold{start: open.line, end: token.location.line - 1})
+			}
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].start < blocks[j].start
+	})
+	return blocks
+}
+
+func (e *Editor) getIndentationWidth(y int) int {
+	return e.accountForTabs(len(getIndentation(e.lines[y])), y)
+}
+
+// Returns the lines after y that are indented more than y, not counting trailing empty lines
+func (e *Editor) getIndentationBlock(y int) Fold {
+	indent := e.getIndentationWidth(y)
+	end := y
+	for i := y + 1; i < len(e.lines); i++ {
+		if strings.TrimSpace(e.lines[i]) == "" {
+			continue
+		}
+		if e.getIndentationWidth(i) <= indent {
+			break
+		}
+		end = i
+	}
+	return Fold{start: y, end: end}
+}
+
+func (e *Editor) getIndentationBlocks() []Fold {
+	blocks := make([]Fold, 0)
+	for y := range e.lines {
+		if strings.TrimSpace(e.lines[y]) == "" {
+			continue
+		}
+		if block := e.getIndentationBlock(y); block.end > block.start {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func (e *Editor) getFoldableBlocks() []Fold {
+	config := GetEditorConfig()
+	if config.FoldMethod == "indent" {
+		return e.getIndentationBlocks()
+	}
+	return e.getSyntaxBlocks()
+}
+
+// Returns the block to fold for line y, the biggest one starting on y or else the smallest one around it
+func (e *Editor) getFoldAt(y int) (Fold, bool) {
+	config := GetEditorConfig()
+
+	if config.FoldMethod != "indent" {
+		blocks := e.getSyntaxBlocks()
+
+		found := false
+		var best Fold
+		for _, block := range blocks {
+			if block.start == y && (!found || block.end > best.end) {
+				best = block
+				found = true
+			}
+		}
+		if found {
+			return best, true
+		}
+
+		// The innermost block around the line, counting the line with the closing bracket
+		for _, block := range blocks {
+			if block.start < y && y <= block.end+1 && (!found || block.start > best.start) {
+				best = block
+				found = true
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+
+	if block := e.getIndentationBlock(y); block.end > block.start {
+		return block, true
+	}
+
+	// Fold the block the line is inside of
+	indent := e.getIndentationWidth(y)
+	for i := y - 1; i >= 0; i-- {
+		if strings.TrimSpace(e.lines[i]) == "" {
+			continue
+		}
+		if e.getIndentationWidth(i) < indent {
+			block := e.getIndentationBlock(i)
+			return block, block.end >= y
+		}
+	}
+	return Fold{}, false
+}
+
+func (e *Editor) foldAtCursor() {
+	fold, ok := e.getFoldAt(e.y)
+	if !ok {
+		return
+	}
+
+	e.addFold(fold)
+	if e.y != fold.start {
+		e.moveYto(fold.start)
+	}
+}
+
+func (e *Editor) toggleFold() {
+	if e.isFolded(e.y) {
+		e.unfold(e.y)
+		return
+	}
+	e.foldAtCursor()
+}
+
+func (e *Editor) foldAll() {
+	for _, block := range e.getFoldableBlocks() {
+		e.addFold(block)
+	}
+	e.moveYto(e.skipFold(e.y, -1))
+}
+
+// Runs fold commands typed in the mini window
+func (e *Editor) runFoldCommand(command string) {
+	switch strings.TrimSpace(command) {
+	case "fold":
+		e.foldAtCursor()
+	case "unfold":
+		e.unfold(e.y)
+	case "toggle":
+		e.toggleFold()
+	case "all":
+		e.foldAll()
+	case "none":
+		e.unfoldAll()
+	case "":
+	default:
+		e.debugLog("unknown fold command:", command)
+	}
+}
+
+// Draws the summary at the end of a folded line
+func (e *Editor) drawFoldSummary(row, col, y int) {
+	config := GetEditorConfig()
+
+	for _, fold := range e.getFolds() {
+		if fold.start != y {
+			continue
+		}
+
+		summary := config.FoldSummary
+		if col < 0 || col >= e.maxX-1 {
+			return
+		}
+		summary = summary[:utils.Min(len(summary), e.maxX-1-col)]
+
+		EnableColor(e.stdscr, config.LineNumberColor.Color)
+		e.stdscr.AttrOn(gc.A_BOLD)
+		e.stdscr.MovePrint(row, col, summary)
+		e.stdscr.AttrOff(gc.A_BOLD)
+		DisableColor(e.stdscr, config.LineNumberColor.Color)
+		return
+	}
+}
+
+func (e *Editor) drawFoldMarker(row, y int) {
+	config := GetEditorConfig()
+
+	if e.isFolded(y) {
+		e.lineNrscr.MovePrint(row, config.LineNumberWidth-2, config.FoldMarker)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newFoldingEditor(text string) *Editor {
+	e := &Editor{View: &View{Buffer: &Buffer{lines: strings.Split(text, "\n")}}}
+	e.lexer = &Lexer{config: getDefaultHighlightingConfigValues()}
+	e.folds = make(map[string][]Fold)
+	return e
+}
+
+const foldingCode = `func a() {
+	if x {
+		y("{")
+	}
+	z(1,
+		2)
+}
+// {
+b := []int{1, 2}`
+
+func TestGetSyntaxBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		blocks []Fold
+	}{
+		{"nested", foldingCode, []Fold{{0, 5}, {1, 2}}},
+		{"nothing between the lines", "a(1,\n2)", []Fold{}},
+		{"one line", "a { b }", []Fold{}},
+		{"closer on the next line", "a {\n}", []Fold{}},
+		{"unclosed", "a {\nb\nc", []Fold{}},
+		{"mismatched", "a (\nb\n]\nc\n)", []Fold{{0, 3}}},
+	}
+
+	for _, test := range tests {
+		e := newFoldingEditor(test.text)
+		if blocks := e.getSyntaxBlocks(); !reflect.DeepEqual(blocks, test.blocks) {
+			t.Errorf("%s: got %v, want %v", test.name, blocks, test.blocks)
+		}
+	}
+}
+
+func TestGetIndentationBlocks(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		blocks []Fold
+	}{
+		{"flat", "a\nb\nc", []Fold{}},
+		{"nested", "a\n  b\n    c\n  d\ne", []Fold{{0, 3}, {1, 2}}},
+		{"tabs", "a\n\tb\n\t\tc\n\td", []Fold{{0, 3}, {1, 2}}},
+		{"empty lines inside", "a\n  b\n\n  c\nd", []Fold{{0, 3}}},
+		{"trailing empty lines left out", "a\n  b\n\n\nc", []Fold{{0, 1}}},
+	}
+
+	for _, test := range tests {
+		e := newFoldingEditor(test.text)
+		if blocks := e.getIndentationBlocks(); !reflect.DeepEqual(blocks, test.blocks) {
+			t.Errorf("%s: got %v, want %v", test.name, blocks, test.blocks)
+		}
+	}
+}
+
+func TestGetFoldAt(t *testing.T) {
+	tests := []struct {
+		y    int
+		fold Fold
+		ok   bool
+	}{
+		{0, Fold{0, 5}, true},
+		{1, Fold{1, 2}, true},
+		{2, Fold{1, 2}, true},
+		{3, Fold{1, 2}, true}, // the line with the closing bracket folds its block
+		{6, Fold{0, 5}, true},
+		{7, Fold{}, false},
+		{8, Fold{}, false},
+	}
+
+	e := newFoldingEditor(foldingCode)
+	for _, test := range tests {
+		fold, ok := e.getFoldAt(test.y)
+		if ok != test.ok || (ok && fold != test.fold) {
+			t.Errorf("line %d: got %v %v, want %v %v", test.y, fold, ok, test.fold, test.ok)
+		}
+	}
+}
+
+func TestShiftFolds(t *testing.T) {
+	folds := []Fold{{2, 4}, {6, 8}, {10, 12}}
+	tests := []struct {
+		name  string
+		y     int
+		delta int
+		folds []Fold
+	}{
+		{"add above", 0, 2, []Fold{{4, 6}, {8, 10}, {12, 14}}},
+		{"add between", 5, 1, []Fold{{2, 4}, {7, 9}, {11, 13}}},
+		{"add inside", 7, 1, []Fold{{2, 4}, {11, 13}}},
+		{"add below", 13, 3, []Fold{{2, 4}, {6, 8}, {10, 12}}},
+		{"delete above", 0, -2, []Fold{{0, 2}, {4, 6}, {8, 10}}},
+		{"delete inside", 7, -1, []Fold{{2, 4}, {9, 11}}},
+		{"delete over", 4, -3, []Fold{{7, 9}}},
+	}
+
+	for _, test := range tests {
+		e := newFoldingEditor("")
+		e.folds[e.path] = append([]Fold{}, folds...)
+		e.shiftFolds(test.y, test.delta)
+		if got := e.getFolds(); !reflect.DeepEqual(got, test.folds) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.folds)
+		}
+	}
+}
+
+func TestVisibleLines(t *testing.T) {
+	e := newFoldingEditor(strings.Repeat("x\n", 9) + "x")
+	e.folds[e.path] = []Fold{{1, 3}, {5, 6}}
+
+	hidden := []bool{false, false, true, true, false, false, true, false, false, false}
+	for y, want := range hidden {
+		if e.isHidden(y) != want {
+			t.Errorf("line %d hidden: got %v, want %v", y, !want, want)
+		}
+	}
+
+	if y := e.nextVisibleLine(1); y != 4 {
+		t.Errorf("next visible line after 1: got %d, want 4", y)
+	}
+	if y := e.previousVisibleLine(4); y != 1 {
+		t.Errorf("previous visible line before 4: got %d, want 1", y)
+	}
+	if n := e.countVisibleLines(0, 7); n != 4 {
+		t.Errorf("visible lines from 0 to 7: got %d, want 4", n)
+	}
+	if y := e.stepVisibleLines(0, 3); y != 5 {
+		t.Errorf("3 visible lines after 0: got %d, want 5", y)
+	}
+}
@@ -9,11 +9,11 @@ require (
 )
 
 require (
-	github.com/acarl005/stripansi v0.0.0-20180116102854-5a71ef0e047d
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/lithammer/fuzzysearch v1.1.8
 )
 
 require (
-	github.com/yireyun/go-queue v0.0.0-20220725040158-a4dd64810e1e // indirect
+	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 )
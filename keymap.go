@@ -0,0 +1,507 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	gc "github.com/rthornton128/goncurses"
+)
+
+// Used to unbind a default binding in the keymap file
+const UNBOUND_COMMAND = "none"
+
+var functionKeyRegex = regexp.MustCompile(`^[fF]([1-9]|1[0-2])$`)
+
+var modifierOrder = []string{"Ctrl", "Alt", "Shift"}
+
+var modifierAliases = map[string]string{
+	"ctrl":    "Ctrl",
+	"control": "Ctrl",
+	"alt":     "Alt",
+	"meta":    "Alt",
+	"option":  "Alt",
+	"shift":   "Shift",
+}
+
+var keyAliases = map[string]string{
+	"up":        "Up",
+	"down":      "Down",
+	"left":      "Left",
+	"right":     "Right",
+	"home":      "Home",
+	"end":       "End",
+	"pageup":    "PageUp",
+	"pgup":      "PageUp",
+	"pagedown":  "PageDown",
+	"pgdn":      "PageDown",
+	"insert":    "Insert",
+	"ins":       "Insert",
+	"delete":    "Delete",
+	"del":       "Delete",
+	"enter":     "Enter",
+	"return":    "Enter",
+	"tab":       "Tab",
+	"backspace": "Backspace",
+	"esc":       "Esc",
+	"escape":    "Esc",
+	"space":     "Space",
+}
+
+// Keys xterm sends with modifiers, ncurses numbers them after the order of the terminfo entries so these are only
+// used when the entry of the terminal can't be read. Each key has a code for Alt, Alt+Shift, Ctrl, Ctrl+Shift and Ctrl+Alt in a row
+var modifiedKeys = []struct {
+	name string
+	code gc.Key
+}{
+	{"Down", 524},
+	{"End", 529},
+	{"Home", 534},
+	{"Insert", 539},
+	{"Left", 544},
+	{"PageDown", 549},
+	{"PageUp", 554},
+	{"Right", 559},
+	{"Up", 565},
+}
+
+var keyModifiers = []string{"Alt", "Alt+Shift", "Ctrl", "Ctrl+Shift", "Ctrl+Alt"}
+
+type KeyBinding struct {
+	Keys    string `json:"keys"`    // chords separated by spaces, like "Ctrl+K Ctrl+C"
+	Command string `json:"command"` // name of the command, or "none" to unbind the keys
+}
+
+type KeymapConfig struct {
+	Bindings         []KeyBinding                 `json:"bindings"`
+	FileMenuBindings []KeyBinding                 `json:"file_menu_bindings"` // keys of the file menu, they can't be sequences
+	KeyCodes         map[string]string            `json:"key_codes"`          // key codes to key names, for terminals sending other codes than the defaults
+	Terminals        map[string]map[string]string `json:"terminals"`          // key codes that only apply when $TERM matches
+}
+
+type Keymap struct {
+	keyNames  map[gc.Key]string
+	bindings  map[string]string // key sequences to command names
+	prefixes  map[string]bool   // sequences that are the start of longer ones
+	pending   []string          // the keys typed so far of a sequence
+	conflicts []string
+
+	fileMenuBindings map[string]string // keys to the commands run on the files of the file menu
+}
+
+func getDefaultKeyBindings() []KeyBinding {
+	return []KeyBinding{
+		{"Esc", "quit"},
+		{"Alt+Right", "next_file"},
+		{"Alt+Left", "previous_file"},
+		{"Ctrl+Right", "word_right"},
+		{"Ctrl+Left", "word_left"},
+		{"Ctrl+Shift+Right", "select_word_right"},
+		{"Ctrl+Shift+Left", "select_word_left"},
+		{"Ctrl+Down", "scroll_down"},
+		{"Ctrl+Up", "scroll_up"},
+		{"Alt+Down", "move_lines_down"},
+		{"Alt+Up", "move_lines_up"},
+		{"Alt+Shift+Down", "duplicate_lines"},
+		{"Ctrl+A", "select_all"},
+		{"Ctrl+C", "copy"},
+		{"Ctrl+D", "delete_line"},
+		{"Ctrl+F", "find"},
+		{"Ctrl+G", "goto"},
+		{"Ctrl+L", "lines"},
+		{"Ctrl+O", "open"},
+		{"Ctrl+P", "command_palette"},
+		{"Ctrl+Q", "close_file"},
+		{"Ctrl+R", "replace"},
+		{"Ctrl+S", "save"},
+		{"Ctrl+T", "terminal"},
+		{"Ctrl+K Ctrl+T", "focus_terminal"},
+		{"Ctrl+K Enter", "send_to_terminal"},
+		{"Ctrl+/", "toggle_comment"},
+		{"Ctrl+K Ctrl+C", "toggle_comment"},
+		{"Ctrl+K Down", "split"},
+		{"Ctrl+K Right", "vsplit"},
+		{"Ctrl+K Tab", "next_view"},
+		{"Ctrl+K Ctrl+Q", "close_view"},
+		{"Ctrl+W", "toggle_soft_wrap"},
+		{"Ctrl+]", "toggle_fold"},
+		{"Ctrl+\\", "fold"},
+		{"Ctrl+Z", "undo"},
+		{"Ctrl+X", "cut"},
+		{"Ctrl+Y", "redo"},
+		{"Ctrl+V", "paste"},
+		{"Ctrl+K Ctrl+V", "paste_history"},
+		{"Shift+Down", "select_down"},
+		{"Shift+Up", "select_up"},
+		{"Shift+Left", "select_left"},
+		{"Shift+Right", "select_right"},
+		{"Ctrl+End", "file_end"},
+		{"Ctrl+Home", "file_start"},
+		{"F4", "next_error"},
+		{"F5", "run_task"},
+		{"F6", "quickfix"},
+		{"F7", "record_macro"},
+		{"F8", "replay_last_macro"},
+		{"F9", "replay_macro"},
+		{"PageDown", "page_down"},
+		{"PageUp", "page_up"},
+		{"Down", "down"},
+		{"Up", "up"},
+		{"Left", "left"},
+		{"Right", "right"},
+		{"Enter", "newline"},
+		{"Tab", "tab"},
+		{"Shift+End", "select_line_end"},
+		{"End", "line_end"},
+		{"Shift+Home", "select_line_start"},
+		{"Home", "line_start"},
+		{"Backspace", "backspace"},
+	}
+}
+
+// The keys of the file menu, the others search
+func getDefaultFileMenuKeyBindings() []KeyBinding {
+	return []KeyBinding{
+		{"Ctrl+N", "new_file"},
+		{"Ctrl+F", "new_folder"},
+		{"Ctrl+R", "rename_file"},
+		{"Ctrl+D", "duplicate_file"},
+		{"Delete", "delete_file"},
+	}
+}
+
+// Returns the codes of xterm's keys with modifiers, for when they can't be read from the terminfo entry
+func getXtermKeyNames() map[gc.Key]string {
+	names := make(map[gc.Key]string)
+	for _, key := range modifiedKeys {
+		for i, modifier := range keyModifiers {
+			names[key.code+gc.Key(i)] = modifier + "+" + key.name
+		}
+	}
+	return names
+}
+
+// Returns the names of the keys the terminal sends as a single code, with the modified keys it has
+func getDefaultKeyNames(modifiedKeyNames map[gc.Key]string) map[gc.Key]string {
+	names := map[gc.Key]string{
+		0:   "Ctrl+Space",
+		28:  "Ctrl+\\",
+		29:  "Ctrl+]",
+		30:  "Ctrl+^",
+		31:  "Ctrl+/",
+		127: "Backspace",
+
+		gc.KEY_TAB:       "Tab",
+		gc.KEY_RETURN:    "Enter",
+		gc.KEY_ENTER:     "Enter",
+		gc.KEY_ESC:       "Esc",
+		gc.KEY_BACKSPACE: "Backspace",
+		gc.KEY_BTAB:      "Shift+Tab",
+
+		gc.KEY_UP:       "Up",
+		gc.KEY_DOWN:     "Down",
+		gc.KEY_LEFT:     "Left",
+		gc.KEY_RIGHT:    "Right",
+		gc.KEY_HOME:     "Home",
+		gc.KEY_END:      "End",
+		gc.KEY_PAGEUP:   "PageUp",
+		gc.KEY_PAGEDOWN: "PageDown",
+		gc.KEY_IC:       "Insert",
+		gc.KEY_DC:       "Delete",
+
+		gc.KEY_SR:     "Shift+Up",
+		gc.KEY_SF:     "Shift+Down",
+		gc.KEY_SLEFT:  "Shift+Left",
+		gc.KEY_SRIGHT: "Shift+Right",
+		gc.KEY_SHOME:  "Shift+Home",
+		gc.KEY_SEND:   "Shift+End",
+	}
+
+	for k := gc.Key(1); k <= 26; k++ {
+		if _, ok := names[k]; !ok {
+			names[k] = "Ctrl+" + string(rune('A'+k-1))
+		}
+	}
+
+	for i := 1; i <= 12; i++ {
+		names[gc.KEY_F1+gc.Key(i-1)] = "F" + strconv.Itoa(i)
+	}
+
+	for code, name := range modifiedKeyNames {
+		names[code] = name
+	}
+
+	return names
+}
+
+// Turns a chord like "ctrl+shift+right" into the name used for it, "Ctrl+Shift+Right"
+func normalizeChord(chord string) (string, error) {
+	parts := strings.Split(chord, "+")
+	key := parts[len(parts)-1]
+	if key == "" && len(parts) > 1 { // The key itself is +
+		key = "+"
+		parts = parts[:len(parts)-1]
+	}
+
+	modifiers := make(map[string]bool)
+	for _, part := range parts[:len(parts)-1] {
+		modifier, ok := modifierAliases[strings.ToLower(part)]
+		if !ok {
+			return "", fmt.Errorf("unknown modifier %q in %q", part, chord)
+		}
+		modifiers[modifier] = true
+	}
+
+	if alias, ok := keyAliases[strings.ToLower(key)]; ok {
+		key = alias
+	} else if functionKeyRegex.MatchString(key) {
+		key = strings.ToUpper(key)
+	} else if len(key) == 1 {
+		if modifiers["Ctrl"] || modifiers["Alt"] {
+			key = strings.ToUpper(key)
+		}
+	} else {
+		return "", fmt.Errorf("unknown key %q in %q", key, chord)
+	}
+
+	name := ""
+	for _, modifier := range modifierOrder {
+		if modifiers[modifier] {
+			name += modifier + "+"
+		}
+	}
+	return name + key, nil
+}
+
+// Normalizes every chord of a sequence like "Ctrl+K Ctrl+C"
+func normalizeKeySequence(sequence string) (string, error) {
+	chords := strings.Fields(sequence)
+	if len(chords) == 0 {
+		return "", fmt.Errorf("no keys")
+	}
+
+	for i, chord := range chords {
+		name, err := normalizeChord(chord)
+		if err != nil {
+			return "", err
+		}
+		chords[i] = name
+	}
+	return strings.Join(chords, " "), nil
+}
+
+func getKeymapPath() string {
+	return JoinPath(getHomePath(), KEYMAP_PATH)
+}
+
+func ReadKeymapConfig() (*KeymapConfig, error) {
+	f, err := os.Open(getKeymapPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keymapConfig := &KeymapConfig{}
+	decoder := json.NewDecoder(f)
+	err = decoder.Decode(keymapConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return keymapConfig, nil
+}
+
+// Builds the keymap from the defaults and the keymap file, problems with the file are kept as conflicts
+func NewKeymap() *Keymap {
+	k := &Keymap{
+		bindings:         make(map[string]string),
+		prefixes:         make(map[string]bool),
+		conflicts:        make([]string, 0),
+		fileMenuBindings: make(map[string]string),
+	}
+
+	for _, binding := range getDefaultKeyBindings() {
+		k.bindings[binding.Keys] = binding.Command
+	}
+	for _, binding := range getDefaultFileMenuKeyBindings() {
+		k.fileMenuBindings[binding.Keys] = binding.Command
+	}
+
+	keymapConfig, err := ReadKeymapConfig()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			k.conflicts = append(k.conflicts, fmt.Sprintf("failed to read %s: %s", KEYMAP_PATH, err))
+		}
+		keymapConfig = &KeymapConfig{}
+	}
+
+	k.addBindings(keymapConfig.Bindings)
+	k.updatePrefixes()
+	k.addFileMenuBindings(keymapConfig.FileMenuBindings)
+
+	modifiedKeyNames, err := getTerminfoKeyNames(os.Getenv("TERM"))
+	if err != nil {
+		modifiedKeyNames = getXtermKeyNames()
+	}
+	k.keyNames = getDefaultKeyNames(modifiedKeyNames)
+	k.addKeyCodes(keymapConfig.KeyCodes)
+	k.addKeyCodes(keymapConfig.Terminals[os.Getenv("TERM")])
+
+	return k
+}
+
+func (k *Keymap) addKeyCodes(keyCodes map[string]string) {
+	for code, chord := range keyCodes {
+		n, err := strconv.Atoi(code)
+		if err != nil {
+			k.conflicts = append(k.conflicts, fmt.Sprintf("key code %q is not a number", code))
+			continue
+		}
+
+		name, err := normalizeChord(chord)
+		if err != nil {
+			k.conflicts = append(k.conflicts, err.Error())
+			continue
+		}
+		k.keyNames[gc.Key(n)] = name
+	}
+}
+
+func (k *Keymap) addBindings(bindings []KeyBinding) {
+	k.addBindingsTo(k.bindings, bindings)
+}
+
+// Adds the file menu bindings, a key waiting for more would be taken as a search
+func (k *Keymap) addFileMenuBindings(bindings []KeyBinding) {
+	k.addBindingsTo(k.fileMenuBindings, bindings)
+	for keys, command := range k.fileMenuBindings {
+		if strings.Contains(keys, " ") {
+			k.conflicts = append(k.conflicts, fmt.Sprintf("%s (%s) can't be typed in the file menu, it only takes single keys", keys, command))
+			delete(k.fileMenuBindings, keys)
+		}
+	}
+}
+
+func (k *Keymap) addBindingsTo(target map[string]string, bindings []KeyBinding) {
+	bound := make(map[string]string) // sequences bound in the file, to find the ones bound twice
+	for _, binding := range bindings {
+		keys, err := normalizeKeySequence(binding.Keys)
+		if err != nil {
+			k.conflicts = append(k.conflicts, err.Error())
+			continue
+		}
+
+		if binding.Command != UNBOUND_COMMAND {
+			if _, ok := getCommand(binding.Command); !ok {
+				k.conflicts = append(k.conflicts, fmt.Sprintf("%s is bound to unknown command %q", keys, binding.Command))
+				continue
+			}
+		}
+
+		if command, ok := bound[keys]; ok && command != binding.Command {
+			k.conflicts = append(k.conflicts, fmt.Sprintf("%s is bound to both %s and %s", keys, command, binding.Command))
+		}
+		bound[keys] = binding.Command
+
+		if binding.Command == UNBOUND_COMMAND {
+			delete(target, keys)
+		} else {
+			target[keys] = binding.Command
+		}
+	}
+}
+
+// Finds the sequences that start longer ones, a sequence that is bound itself hides the longer ones
+func (k *Keymap) updatePrefixes() {
+	k.prefixes = make(map[string]bool)
+	for keys := range k.bindings {
+		chords := strings.Fields(keys)
+		for i := 1; i < len(chords); i++ {
+			prefix := strings.Join(chords[:i], " ")
+			k.prefixes[prefix] = true
+
+			if command, ok := k.bindings[prefix]; ok {
+				k.conflicts = append(k.conflicts, fmt.Sprintf("%s (%s) can't be typed as %s is bound to %s", keys, k.bindings[keys], prefix, command))
+			}
+		}
+	}
+}
+
+// Returns the name of the key, printable characters are their own name
+func (k *Keymap) getKeyName(key gc.Key) string {
+	if name, ok := k.keyNames[key]; ok {
+		return name
+	}
+	if key > 32 && key < 127 {
+		return string(rune(key))
+	}
+	if key == 32 {
+		return "Space"
+	}
+	return "Key" + strconv.Itoa(int(key))
+}
+
+// Returns the command bound to the key in the file menu
+func (k *Keymap) resolveFileMenuKey(key gc.Key) (string, bool) {
+	command, ok := k.fileMenuBindings[k.getKeyName(key)]
+	return command, ok
+}
+
+// Returns the command bound to the key. Keys that start a sequence are held until the
+// sequence is complete, for those and for unbound sequences held is true
+func (k *Keymap) resolve(key gc.Key) (command string, held bool) {
+	name := k.getKeyName(key)
+	keys := strings.Join(append(k.pending, name), " ")
+
+	if command, ok := k.bindings[keys]; ok {
+		k.pending = nil
+		return command, false
+	}
+
+	if k.prefixes[keys] {
+		k.pending = append(k.pending, name)
+		return "", true
+	}
+
+	held = len(k.pending) > 0
+	k.pending = nil
+	return "", held
+}
+
+func (k *Keymap) getPending() string {
+	return strings.Join(k.pending, " ")
+}
+
+// Returns the key sequences bound to the command
+func (k *Keymap) getKeys(command string) []string {
+	keys := make([]string, 0)
+	for sequence, c := range k.bindings {
+		if c == command {
+			keys = append(keys, sequence)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Logs every conflict and tells the user about them
+func (e *Editor) reportKeymapConflicts() {
+	if len(e.keymap.conflicts) == 0 {
+		return
+	}
+
+	for _, conflict := range e.keymap.conflicts {
+		log.Println("keymap:", conflict)
+	}
+
+	message := "keymap: " + e.keymap.conflicts[0]
+	if len(e.keymap.conflicts) > 1 {
+		message = fmt.Sprintf("keymap: %d conflicts, see logs.txt", len(e.keymap.conflicts))
+	}
+	e.showMessage(message)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	gc "github.com/rthornton128/goncurses"
+)
+
+func TestNormalizeChord(t *testing.T) {
+	tests := []struct {
+		chord string
+		name  string
+		ok    bool
+	}{
+		{"a", "a", true},
+		{"A", "A", true},
+		{"ctrl+a", "Ctrl+A", true},
+		{"Control+x", "Ctrl+X", true},
+		{"shift+ctrl+right", "Ctrl+Shift+Right", true},
+		{"Shift+Alt+Ctrl+Up", "Ctrl+Alt+Shift+Up", true},
+		{"meta+pgdn", "Alt+PageDown", true},
+		{"option+del", "Alt+Delete", true},
+		{"return", "Enter", true},
+		{"escape", "Esc", true},
+		{"f12", "F12", true},
+		{"ctrl+f1", "Ctrl+F1", true},
+		{"ctrl+/", "Ctrl+/", true},
+		{"+", "+", true},
+		{"ctrl++", "Ctrl++", true},
+		{"f13", "", false},
+		{"hyper+a", "", false},
+		{"ctrl+foo", "", false},
+	}
+
+	for _, test := range tests {
+		name, err := normalizeChord(test.chord)
+		if (err == nil) != test.ok || name != test.name {
+			t.Errorf("%q: got %q %v, want %q", test.chord, name, err, test.name)
+		}
+	}
+}
+
+func TestNormalizeKeySequence(t *testing.T) {
+	tests := []struct {
+		sequence string
+		name     string
+		ok       bool
+	}{
+		{"ctrl+k ctrl+c", "Ctrl+K Ctrl+C", true},
+		{"  ctrl+k   down ", "Ctrl+K Down", true},
+		{"", "", false},
+		{"ctrl+k nope", "", false},
+	}
+
+	for _, test := range tests {
+		name, err := normalizeKeySequence(test.sequence)
+		if (err == nil) != test.ok || name != test.name {
+			t.Errorf("%q: got %q %v, want %q", test.sequence, name, err, test.name)
+		}
+	}
+}
+
+func newTestKeymap(bindings ...KeyBinding) *Keymap {
+	k := &Keymap{
+		keyNames:  map[gc.Key]string{11: "Ctrl+K", 3: "Ctrl+C", 17: "Ctrl+Q"},
+		bindings:  map[string]string{"Ctrl+C": "copy", "Ctrl+Q": "close_file"},
+		conflicts: make([]string, 0),
+	}
+	k.addBindings(bindings)
+	k.updatePrefixes()
+	return k
+}
+
+func TestAddBindings(t *testing.T) {
+	tests := []struct {
+		name      string
+		bindings  []KeyBinding
+		expected  map[string]string
+		conflicts int
+	}{
+		{"replaces a default", []KeyBinding{{"ctrl+c", "cut"}},
+			map[string]string{"Ctrl+C": "cut", "Ctrl+Q": "close_file"}, 0},
+		{"unbinds a default", []KeyBinding{{"Ctrl+Q", UNBOUND_COMMAND}},
+			map[string]string{"Ctrl+C": "copy"}, 0},
+		{"adds a sequence", []KeyBinding{{"Ctrl+K Ctrl+C", "toggle_comment"}},
+			map[string]string{"Ctrl+C": "copy", "Ctrl+Q": "close_file", "Ctrl+K Ctrl+C": "toggle_comment"}, 0},
+		{"unknown command", []KeyBinding{{"Ctrl+C", "nope"}},
+			map[string]string{"Ctrl+C": "copy", "Ctrl+Q": "close_file"}, 1},
+		{"invalid keys", []KeyBinding{{"Hyper+C", "cut"}},
+			map[string]string{"Ctrl+C": "copy", "Ctrl+Q": "close_file"}, 1},
+		{"bound twice in the file, the last wins", []KeyBinding{{"Ctrl+C", "cut"}, {"ctrl+c", "undo"}},
+			map[string]string{"Ctrl+C": "undo", "Ctrl+Q": "close_file"}, 1},
+		{"bound twice to the same command", []KeyBinding{{"Ctrl+C", "cut"}, {"ctrl+c", "cut"}},
+			map[string]string{"Ctrl+C": "cut", "Ctrl+Q": "close_file"}, 0},
+		{"prefix bound itself", []KeyBinding{{"Ctrl+C Ctrl+Q", "cut"}},
+			map[string]string{"Ctrl+C": "copy", "Ctrl+Q": "close_file", "Ctrl+C Ctrl+Q": "cut"}, 1},
+	}
+
+	for _, test := range tests {
+		k := newTestKeymap(test.bindings...)
+		if !reflect.DeepEqual(k.bindings, test.expected) {
+			t.Errorf("%s: got %v, want %v", test.name, k.bindings, test.expected)
+		}
+		if len(k.conflicts) != test.conflicts {
+			t.Errorf("%s: got conflicts %q, want %d", test.name, k.conflicts, test.conflicts)
+		}
+	}
+}
+
+func TestAddFileMenuBindings(t *testing.T) {
+	k := newTestKeymap()
+	k.keyNames[14] = "Ctrl+N"
+	k.fileMenuBindings = map[string]string{"Ctrl+N": "new_file", "Delete": "delete_file"}
+	k.addFileMenuBindings([]KeyBinding{{"ctrl+e", "new_file"}, {"Delete", UNBOUND_COMMAND}, {"Ctrl+K Ctrl+R", "rename_file"}})
+
+	expected := map[string]string{"Ctrl+N": "new_file", "Ctrl+E": "new_file"}
+	if !reflect.DeepEqual(k.fileMenuBindings, expected) {
+		t.Errorf("got %v, want %v", k.fileMenuBindings, expected)
+	}
+	if len(k.conflicts) != 1 {
+		t.Errorf("got conflicts %q, want the sequence", k.conflicts)
+	}
+
+	if command, ok := k.resolveFileMenuKey(14); !ok || command != "new_file" {
+		t.Errorf("Ctrl+N: got %q %v, want new_file", command, ok)
+	}
+	if _, ok := k.resolveFileMenuKey(3); ok {
+		t.Error("Ctrl+C is bound in the file menu")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	k := newTestKeymap(KeyBinding{"Ctrl+K Ctrl+C", "toggle_comment"})
+
+	tests := []struct {
+		key     gc.Key
+		command string
+		held    bool
+	}{
+		{3, "copy", false},
+		{11, "", true}, // Ctrl+K waits for the rest of the sequence
+		{3, "toggle_comment", false},
+		{11, "", true},
+		{'x', "", true}, // the key ending an unbound sequence is swallowed
+		{'x', "", false},
+		{17, "close_file", false},
+	}
+
+	for i, test := range tests {
+		command, held := k.resolve(test.key)
+		if command != test.command || held != test.held {
+			t.Errorf("key %d (%d): got %q %v, want %q %v", i, test.key, command, held, test.command, test.held)
+		}
+	}
+}
+
+func TestGetKeyName(t *testing.T) {
+	k := &Keymap{keyNames: getDefaultKeyNames(getXtermKeyNames())}
+
+	tests := []struct {
+		key  gc.Key
+		name string
+	}{
+		{'a', "a"},
+		{'A', "A"},
+		{' ', "Space"},
+		{1, "Ctrl+A"},
+		{9, "Tab"},
+		{10, "Enter"},
+		{27, "Esc"},
+		{31, "Ctrl+/"},
+		{127, "Backspace"},
+		{gc.KEY_F1 + 4, "F5"},
+		{gc.KEY_SRIGHT, "Shift+Right"},
+		{9999, "Key9999"},
+	}
+
+	for _, test := range tests {
+		if name := k.getKeyName(test.key); name != test.name {
+			t.Errorf("%d: got %q, want %q", test.key, name, test.name)
+		}
+	}
+}
+
+// Every chord bound by default has to be a key the terminal can send, or the binding can never be used
+func TestDefaultChordsHaveKeys(t *testing.T) {
+	keyNames := map[string]map[gc.Key]string{"xterm fallback": getXtermKeyNames()}
+	if terminfoKeyNames, err := getTerminfoKeyNames("xterm-256color"); err == nil {
+		keyNames["xterm-256color"] = terminfoKeyNames
+	}
+
+	for terminal, modifiedKeyNames := range keyNames {
+		k := &Keymap{keyNames: getDefaultKeyNames(modifiedKeyNames)}
+		codes := make(map[string]gc.Key)
+		for key := gc.Key(0); key < 1024; key++ {
+			if _, ok := codes[k.getKeyName(key)]; !ok {
+				codes[k.getKeyName(key)] = key
+			}
+		}
+
+		for _, binding := range append(getDefaultKeyBindings(), getDefaultFileMenuKeyBindings()...) {
+			for _, chord := range strings.Fields(binding.Keys) {
+				key, ok := codes[chord]
+				if !ok {
+					t.Errorf("%s: no key is %q, bound to %s", terminal, chord, binding.Command)
+					continue
+				}
+				if name := k.getKeyName(key); name != chord {
+					t.Errorf("%s: key %d of %q is named %q", terminal, key, chord, name)
+				}
+			}
+		}
+	}
+}
+
+func TestTerminfoKeyNames(t *testing.T) {
+	keyNames, err := getTerminfoKeyNames("xterm-256color")
+	if err != nil {
+		t.Skip("no terminfo entry for xterm-256color:", err)
+	}
+
+	codes := make(map[string]gc.Key)
+	for code, name := range keyNames {
+		if other, ok := codes[name]; ok {
+			t.Errorf("%q has the codes %d and %d", name, other, code)
+		}
+		codes[name] = code
+	}
+	for _, name := range []string{"Alt+Up", "Alt+Down", "Ctrl+Right", "Ctrl+Shift+Left", "Alt+Shift+Down", "Ctrl+Home", "Ctrl+End"} {
+		if _, ok := codes[name]; !ok {
+			t.Errorf("no code for %q", name)
+		}
+	}
+
+	if _, err := getTerminfoKeyNames("../xterm"); err == nil {
+		t.Error("read a terminfo entry outside of the terminfo folders")
+	}
+}
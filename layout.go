@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const MENU_HEIGHT = 20
+
+// The windows around the views are placed from the size of the screen, both when starting and when it is resized.
+// Each returns y, x, height and width
+
+func getTerminalRect(screenHeight, screenWidth int) (int, int, int, int) {
+	config := GetEditorConfig()
+	x := screenWidth*3/5 + config.LineNumberWidth + 1
+	return 0, x, screenHeight, utils.Max(screenWidth-x, 1)
+}
+
+func getMiniWindowRect(screenHeight, screenWidth int) (int, int, int, int) {
+	config := GetEditorConfig()
+	return screenHeight - 1, 4, 1, utils.Max(screenWidth-config.LineNumberWidth-4, 1)
+}
+
+func getMenuRect(screenHeight, screenWidth int) (int, int, int, int) {
+	config := GetEditorConfig()
+	textWidth := screenWidth - config.LineNumberWidth
+	width := utils.Max(textWidth-12, 8)
+	height := utils.Min(MENU_HEIGHT, utils.Max(screenHeight-2, 5))
+	return utils.Max(screenHeight/2-height/2, 0), utils.Max(textWidth/2-width/2, 4), height, width
+}
+
+func getPopUpRect(screenHeight, screenWidth int) (int, int, int, int) {
+	config := GetEditorConfig()
+	return screenHeight / 2, (screenWidth - config.LineNumberWidth) / 2, 3, 5
+}
+
+// Places the windows again when the terminal is resized while a prompt or menu reads the keys, set when the editor starts
+var onScreenResize = func() {}
+
+// Places every window again after the terminal gim runs in was resized, ncurses has already resized the screen
+func (e *Editor) resizeScreen() {
+	screenHeight, screenWidth := gc.StdScr().MaxYX()
+
+	y, x, height, width := getTerminalRect(screenHeight, screenWidth)
+	e.terminalscr, _ = placeWindow(e.terminalscr, height, width, y, x)
+	e.miniWindow.resize(getMiniWindowRect(screenHeight, screenWidth))
+
+	y, x, height, width = getMenuRect(screenHeight, screenWidth)
+	for _, menu := range []*MenuWindow{e.menuWindow.menuWindow, e.commandMenuWindow.menuWindow, e.registerMenuWindow.menuWindow, e.listMenuWindow.menuWindow} {
+		err := menu.resize(y, x, height, width)
+		if err != nil {
+			e.debugLog("failed to resize menu:", err)
+		}
+	}
+
+	e.popupWindow.y, e.popupWindow.x, _, _ = getPopUpRect(screenHeight, screenWidth)
+
+	e.layoutViews()
+
+	// Keep the cursor of every view on the screen
+	focused := e.View
+	for _, v := range e.views {
+		e.View = v
+		e.clampView()
+		e.scrollToCursor()
+	}
+	e.View = focused
+
+	e.resizeTerminal()
+
+	gc.StdScr().Clear()
+	gc.StdScr().Refresh()
+	e.draw()
+	if e.terminalOpened {
+		e.drawTerminal()
+	}
+}
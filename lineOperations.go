@@ -0,0 +1,214 @@
+package main
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var leadingNumberRegex = regexp.MustCompile(`^\s*[-+]?(\d+\.?\d*|\.\d+)`)
+
+// Replaces the lines from startY to endY (inclusive) with lines, as an add and a delete so it can be undone.
+// The new lines are added before the old ones are deleted so the file is never left without lines
+func (e *Editor) replaceLines(startY, endY int, lines []string) {
+	e.addLines(endY+1, lines)
+	e.deleteLines(startY, endY-startY+1)
+}
+
+// Selects the lines from startY to endY fully and puts the cursor at the end of the selection
+func (e *Editor) selectLines(startY, endY int) {
+	e.selectedYStart, e.selectedXStart = startY, 0
+	e.selectedYEnd, e.selectedXEnd = endY, len(e.lines[endY])
+
+	e.moveYto(endY)
+	e.moveXto(len(e.lines[endY]))
+}
+
+func (e *Editor) moveLines(delta int) {
+	startY, endY := e.getSelectedLines()
+	if (delta < 0 && startY == 0) || (delta > 0 && endY >= len(e.lines)-1) {
+		return
+	}
+
+	block := make([]string, endY-startY+1)
+	copy(block, e.lines[startY:endY+1])
+
+	if delta < 0 {
+		e.replaceLines(startY-1, endY, append(block, e.lines[startY-1]))
+		delta = -1
+	} else {
+		e.replaceLines(startY, endY+1, append([]string{e.lines[endY+1]}, block...))
+		delta = 1
+	}
+
+	e.selectedYStart += delta
+	e.selectedYEnd += delta
+	e.moveYto(e.y + delta)
+}
+
+func (e *Editor) duplicateLines() {
+	startY, endY := e.getSelectedLines()
+
+	block := make([]string, endY-startY+1)
+	copy(block, e.lines[startY:endY+1])
+	e.addLines(endY+1, block)
+
+	delta := len(block)
+	if e.hasSelection() {
+		e.selectedYStart += delta
+		e.selectedYEnd += delta
+	}
+	e.moveYto(e.y + delta)
+}
+
+// Joins the selected lines into one, or the current line with the next if nothing is selected
+func (e *Editor) joinLines() {
+	startY, endY := e.getSelectedLines()
+	if startY == endY {
+		if endY >= len(e.lines)-1 {
+			return
+		}
+		endY++
+	}
+
+	joined := e.lines[startY]
+	joinX := len(joined)
+	for _, line := range e.lines[startY+1 : endY+1] {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			continue
+		}
+
+		joined = strings.TrimRight(joined, " \t")
+		joinX = len(joined)
+		if joined != "" {
+			joined += " "
+			joinX++
+		}
+		joined += line
+	}
+
+	e.replaceLines(startY, endY, []string{joined})
+
+	e.selectedYStart, e.selectedXStart = startY, joinX
+	e.selectedYEnd, e.selectedXEnd = startY, joinX
+	e.moveYto(startY)
+	e.moveXto(joinX)
+}
+
+func getLeadingNumber(line string) float64 {
+	match := leadingNumberRegex.FindString(line)
+	number, err := strconv.ParseFloat(strings.TrimSpace(match), 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// Flags are -n for numeric, -i for case-insensitive and -r for reverse, they can be combined like -nr
+func sortLines(lines []string, flags string) {
+	numeric := strings.Contains(flags, "n")
+	ignoreCase := strings.Contains(flags, "i")
+	reverse := strings.Contains(flags, "r")
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if reverse {
+			a, b = b, a
+		}
+
+		if numeric {
+			numA, numB := getLeadingNumber(a), getLeadingNumber(b)
+			if numA != numB {
+				return numA < numB
+			}
+		}
+
+		if ignoreCase {
+			a, b = strings.ToLower(a), strings.ToLower(b)
+		}
+		return a < b
+	})
+}
+
+func uniqueLines(lines []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if seen[line] {
+			continue
+		}
+		seen[line] = true
+		unique = append(unique, line)
+	}
+	return unique
+}
+
+func shuffleLines(lines []string) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r.Shuffle(len(lines), func(i, j int) {
+		lines[i], lines[j] = lines[j], lines[i]
+	})
+}
+
+func reverseLines(lines []string) {
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+}
+
+// Runs operations like "sort -ni", "unique" or "join" on the selected lines.
+// Sort, unique, shuffle and reverse work on the whole file if nothing is selected
+func (e *Editor) runLineOperation(operation string) {
+	fields := strings.Fields(operation)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch fields[0] {
+	case "join":
+		e.joinLines()
+		return
+	case "duplicate":
+		e.duplicateLines()
+		return
+	case "up":
+		e.moveLines(-1)
+		return
+	case "down":
+		e.moveLines(1)
+		return
+	}
+
+	startY, endY := 0, len(e.lines)-1
+	if e.hasSelection() {
+		startY, endY = e.getSelectedLines()
+	}
+
+	if startY == endY {
+		return
+	}
+
+	lines := make([]string, endY-startY+1)
+	copy(lines, e.lines[startY:endY+1])
+
+	switch fields[0] {
+	case "sort":
+		sortLines(lines, strings.Join(fields[1:], ""))
+	case "unique":
+		lines = uniqueLines(lines)
+	case "shuffle":
+		shuffleLines(lines)
+	case "reverse":
+		reverseLines(lines)
+	default:
+		e.debugLog("unknown line operation:", operation)
+		return
+	}
+
+	e.replaceLines(startY, endY, lines)
+	e.selectLines(startY, startY+len(lines)-1)
+}
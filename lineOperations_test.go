@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSortLines(t *testing.T) {
+	tests := []struct {
+		flags  string
+		lines  []string
+		sorted []string
+	}{
+		{"", []string{"b", "c", "a"}, []string{"a", "b", "c"}},
+		{"", []string{"b", "B", "a"}, []string{"B", "a", "b"}},
+		{"", []string{"10", "9", "1"}, []string{"1", "10", "9"}},
+		{"n", []string{"10", "9", "1"}, []string{"1", "9", "10"}},
+		{"n", []string{"2.5 b", "-1 a", "  2 c", ".5 d"}, []string{"-1 a", ".5 d", "  2 c", "2.5 b"}},
+		{"n", []string{"x", "2", "b", "1"}, []string{"b", "x", "1", "2"}}, // lines without a number count as 0
+		{"i", []string{"b", "B", "a", "A"}, []string{"a", "A", "b", "B"}}, // equal lines keep their order
+		{"r", []string{"b", "c", "a"}, []string{"c", "b", "a"}},
+		{"nr", []string{"10", "9", "1"}, []string{"10", "9", "1"}},
+		{"ni", []string{"1 b", "1 A", "0 z"}, []string{"0 z", "1 A", "1 b"}},
+	}
+
+	for _, test := range tests {
+		lines := append([]string{}, test.lines...)
+		sortLines(lines, test.flags)
+		if !reflect.DeepEqual(lines, test.sorted) {
+			t.Errorf("sort -%s %q: got %q, want %q", test.flags, test.lines, lines, test.sorted)
+		}
+	}
+}
+
+func TestGetLeadingNumber(t *testing.T) {
+	tests := []struct {
+		line   string
+		number float64
+	}{
+		{"12", 12},
+		{"  12 apples", 12},
+		{"-3.5x", -3.5},
+		{"+7", 7},
+		{".25", 0.25},
+		{"1.", 1},
+		{"apples 12", 0},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		if number := getLeadingNumber(test.line); number != test.number {
+			t.Errorf("%q: got %v, want %v", test.line, number, test.number)
+		}
+	}
+}
+
+func TestUniqueLines(t *testing.T) {
+	tests := []struct {
+		lines, unique []string
+	}{
+		{[]string{}, []string{}},
+		{[]string{"a", "b"}, []string{"a", "b"}},
+		{[]string{"a", "a", "b", "a", "b"}, []string{"a", "b"}},
+		{[]string{"b", "a", "b", ""}, []string{"b", "a", ""}},
+		{[]string{"a", "A", " a"}, []string{"a", "A", " a"}},
+	}
+
+	for _, test := range tests {
+		if unique := uniqueLines(test.lines); !reflect.DeepEqual(unique, test.unique) {
+			t.Errorf("%q: got %q, want %q", test.lines, unique, test.unique)
+		}
+	}
+}
+
+func TestReverseLines(t *testing.T) {
+	tests := []struct {
+		lines, reversed []string
+	}{
+		{[]string{}, []string{}},
+		{[]string{"a"}, []string{"a"}},
+		{[]string{"a", "b"}, []string{"b", "a"}},
+		{[]string{"a", "b", "c"}, []string{"c", "b", "a"}},
+	}
+
+	for _, test := range tests {
+		lines := append([]string{}, test.lines...)
+		reverseLines(lines)
+		if !reflect.DeepEqual(lines, test.reversed) {
+			t.Errorf("%q: got %q, want %q", test.lines, lines, test.reversed)
+		}
+	}
+}
+
+func TestShuffleLines(t *testing.T) {
+	lines := []string{"a", "b", "c", "d", "e"}
+	shuffled := append([]string{}, lines...)
+	shuffleLines(shuffled)
+
+	sort.Strings(shuffled)
+	if !reflect.DeepEqual(shuffled, lines) {
+		t.Errorf("shuffling lost lines: %q", shuffled)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/jonasfreyr/gim/utils"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+	gc "github.com/rthornton128/goncurses"
+)
+
+// ListMenuWindow picks one of a list of lines, like a task to run or an error to jump to
+type ListMenuWindow struct {
+	menuWindow *MenuWindow
+}
+
+func NewListMenuWindow(y, x, h, w int) (*ListMenuWindow, error) {
+	menuWindow, err := NewMenuWindow(y, x, h, w)
+	if err != nil {
+		return nil, err
+	}
+
+	mw := &ListMenuWindow{
+		menuWindow: menuWindow,
+	}
+	return mw, nil
+}
+
+func (w *ListMenuWindow) getItems(searchString string, labels []string) []MenuItem {
+	config := GetEditorConfig()
+	_, width := w.menuWindow.subWindow.MaxYX()
+	width -= len(w.menuWindow.mark) + 3
+
+	items := make([]MenuItem, 0)
+	for i, label := range labels {
+		if searchString != "" && !fuzzy.MatchFold(searchString, label) {
+			continue
+		}
+
+		// Cut from the end so the start of the line is what is seen
+		if len(label) > width {
+			label = label[:utils.Max(width, 0)]
+		}
+
+		items = append(items, MenuItem{
+			label: label,
+			value: strconv.Itoa(i),
+			color: config.FileColor.Color,
+		})
+	}
+	return items
+}
+
+// Returns the index of the chosen label, -1 if nothing was chosen. The list starts at selected
+func (w *ListMenuWindow) run(title string, labels []string, selected int) int {
+	gc.Cursor(0)
+	defer gc.Cursor(1)
+
+	searchString := ""
+	updateItems := true
+	for {
+		if updateItems {
+			w.menuWindow.setItems(w.getItems(searchString, labels))
+			if searchString == "" && selected < len(w.menuWindow.items) {
+				w.menuWindow.selected = utils.Max(selected, 0)
+			}
+			updateItems = false
+		}
+
+		shownTitle := searchString
+		if shownTitle == "" {
+			shownTitle = title
+		}
+		w.menuWindow.draw(shownTitle)
+
+		ch := getChar(w.menuWindow.stdscr)
+		switch ch {
+		case gc.KEY_RESIZE:
+			onScreenResize()
+		case gc.KEY_ESC:
+			return -1
+		case gc.KEY_DOWN, gc.KEY_UP:
+			w.menuWindow.run(ch)
+		case gc.KEY_ENTER, gc.KEY_RETURN:
+			chosen := w.menuWindow.run(ch)
+			if chosen == "" {
+				continue
+			}
+
+			index, err := strconv.Atoi(chosen)
+			if err != nil {
+				return -1
+			}
+			return index
+		case gc.KEY_BACKSPACE:
+			if searchString == "" {
+				continue
+			}
+
+			searchString = searchString[:len(searchString)-1]
+			updateItems = true
+		default:
+			chr := gc.KeyString(ch)
+			if len(chr) > 1 {
+				continue
+			}
+
+			searchString += chr
+			updateItems = true
+		}
+	}
+}
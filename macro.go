@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	gc "github.com/rthornton128/goncurses"
+)
+
+const DEFAULT_MACRO_REGISTER = "default"
+
+// Stops replaying until failure from running forever
+const MAX_MACRO_REPLAYS = 10000
+
+var macroRegisterRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type Macros struct {
+	recording bool
+	register  string
+	recorded  []gc.Key
+
+	replaying bool
+	queue     []gc.Key // keys left of the macro being replayed
+	failed    bool
+
+	last      string
+	registers map[string][]gc.Key
+	loaded    bool
+}
+
+var macros = &Macros{registers: make(map[string][]gc.Key)}
+
+const KEY_NONE gc.Key = -1 // read when no key arrives before the timeout of the window
+
+// Reads a key like GetChar does, but GetChar returns 0 when no key arrives in time and that is also Ctrl+Space
+func readKey(scr *gc.Window) gc.Key {
+	y, x := scr.CursorYX()
+	return scr.MoveGetChar(y, x)
+}
+
+// Every window reads keys through here so macros can be recorded from and replayed into all of them
+func getChar(scr *gc.Window) gc.Key {
+	if macros.replaying {
+		if len(macros.queue) == 0 {
+			// A prompt wants more keys than the macro has
+			macros.failed = true
+			return gc.KEY_ESC
+		}
+
+		key := macros.queue[0]
+		macros.queue = macros.queue[1:]
+		return key
+	}
+
+	key := readKey(scr)
+	if macros.recording && key != KEY_NONE {
+		macros.recorded = append(macros.recorded, key)
+	}
+	return key
+}
+
+// Reads a key like getChar, but gives up after timeout milliseconds and returns KEY_NONE so the caller can do what else is waiting
+func getCharTimeout(scr *gc.Window, timeout int) gc.Key {
+	scr.Timeout(timeout)
+	defer scr.Timeout(-1)
+	return getChar(scr)
+}
+
+func getMacrosPath() string {
+	return JoinPath(getHomePath(), MACROS_PATH)
+}
+
+func (m *Macros) load() {
+	if m.loaded {
+		return
+	}
+	m.loaded = true
+
+	files, err := os.ReadDir(getMacrosPath())
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		if file.IsDir() || name == file.Name() {
+			continue
+		}
+
+		data, err := os.ReadFile(JoinPath(getMacrosPath(), file.Name()))
+		if err != nil {
+			continue
+		}
+
+		var keys []gc.Key
+		err = json.Unmarshal(data, &keys)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := m.registers[name]; !ok {
+			m.registers[name] = keys
+		}
+	}
+}
+
+func (m *Macros) save(register string) error {
+	err := os.MkdirAll(getMacrosPath(), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m.registers[register])
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(JoinPath(getMacrosPath(), register+".json"), data, 0666)
+}
+
+func (e *Editor) startMacroRecording() {
+	register := strings.TrimSpace(e.miniWindow.whileRun(true, "record macro to (register)"))
+	if register == "" {
+		register = DEFAULT_MACRO_REGISTER
+	}
+
+	if !macroRegisterRegex.MatchString(register) {
+		e.showMessage("Invalid register name!")
+		return
+	}
+
+	macros.recording = true
+	macros.register = register
+	macros.recorded = make([]gc.Key, 0)
+}
+
+// Stops recording, the key that stopped it is not part of the macro
+func (e *Editor) stopMacroRecording() {
+	macros.recording = false
+	keys := macros.recorded
+	if len(keys) > 0 {
+		keys = keys[:len(keys)-1]
+	}
+	macros.recorded = nil
+
+	if len(keys) == 0 {
+		return
+	}
+
+	macros.load()
+	macros.registers[macros.register] = keys
+	macros.last = macros.register
+
+	err := macros.save(macros.register)
+	if err != nil {
+		e.debugLog("failed to save macro:", err)
+	}
+}
+
+func (e *Editor) toggleMacroRecording() {
+	if macros.recording {
+		e.stopMacroRecording()
+	} else {
+		e.startMacroRecording()
+	}
+}
+
+// Runs the keys through handleKey, returns false if the macro failed
+func (e *Editor) replayKeys(keys []gc.Key) bool {
+	macros.queue = append([]gc.Key{}, keys...)
+	macros.failed = false
+
+	for len(macros.queue) > 0 && !macros.failed {
+		key := macros.queue[0]
+		macros.queue = macros.queue[1:]
+
+		beforeY, beforeX := e.y, e.x
+		if e.handleKey(key) {
+			macros.failed = true
+			break
+		}
+
+		// Like in vim, a macro fails when it can't move any further
+		switch key {
+		case gc.KEY_DOWN, gc.KEY_UP, gc.KEY_LEFT, gc.KEY_RIGHT:
+			if beforeY == e.y && beforeX == e.x {
+				macros.failed = true
+			}
+		}
+	}
+	return !macros.failed
+}
+
+// Replays the macro in the register times times, or until it fails if times is -1.
+// All the replays are one transaction so they can be undone together
+func (e *Editor) replayMacro(register string, times int) {
+	macros.load()
+	if register == "" {
+		register = macros.last
+	}
+	if register == "" {
+		register = DEFAULT_MACRO_REGISTER
+	}
+
+	if macros.replaying || macros.recording && macros.register == register {
+		return
+	}
+
+	keys, ok := macros.registers[register]
+	if !ok {
+		e.showMessage("No macro in " + register)
+		return
+	}
+	macros.last = register
+
+	// The macro can switch files, the group is ended in the history it was started in
+	transactions := e.transactions
+	macros.replaying = true
+	transactions.startGroup(e.y, e.x)
+	defer func() {
+		macros.replaying = false
+		macros.queue = nil
+		transactions.endGroup()
+	}()
+
+	untilFailure := times == -1
+	if untilFailure {
+		times = MAX_MACRO_REPLAYS
+	}
+
+	for i := 0; i < times; i++ {
+		beforeY, beforeX := e.y, e.x
+		beforeActions := e.transactions.actionCount()
+
+		if !e.replayKeys(keys) {
+			break
+		}
+
+		// Nothing changed so replaying again would not either
+		if untilFailure && beforeY == e.y && beforeX == e.x && beforeActions == e.transactions.actionCount() {
+			break
+		}
+	}
+}
+
+// Parses "register count", where count is a number or * to replay until the macro fails.
+// Both are optional, "5" replays the last macro five times
+func (e *Editor) runMacroCommand(command string) {
+	fields := strings.Fields(command)
+
+	register := ""
+	times := 1
+	for _, field := range fields {
+		if field == "*" {
+			times = -1
+		} else if n, err := strconv.Atoi(field); err == nil {
+			times = n
+		} else {
+			register = field
+		}
+	}
+
+	e.replayMacro(register, times)
+}
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -13,82 +14,98 @@ import (
 	"sync"
 	"time"
 
-	"github.com/acarl005/stripansi"
-	"github.com/atotto/clipboard"
 	"github.com/creack/pty"
 	"github.com/jonasfreyr/gim/utils"
 	gc "github.com/rthornton128/goncurses"
 )
 
 type Editor struct {
-	stdscr    *gc.Window
-	lineNrscr *gc.Window
-	headerscr *gc.Window
-
-	maxX, maxY int
+	*View // the focused view, its cursor and buffer are the ones being edited
 
-	x, y int
-	visX int
+	views  []*View // in the order focus moves through them
+	layout *Layout
 
-	inlinePosition int
-
-	printLineStartIndex int
-	printLinesIndex     int
+	headerscr *gc.Window
 
 	headerOffset int
 
-	lines []string
-	lexer *Lexer
-
-	selectedXStart, selectedYStart int
-	selectedXEnd, selectedYEnd     int
-	selected                       string
-
-	path string
-
 	cleanUps []func()
 
-	terminalscr    *gc.Window
-	terminalOpened bool
-	terminalLock   *sync.RWMutex
-	terminalAlive  bool
-
-	miniWindow     *MiniWindow
-	menuWindow     *FileMenuWindow
-	terminalWindow *MiniWindow
-	popupWindow    *PopUpWindow
-
-	transactions *Transactions
-
-	terminalLines []string
-	cmd           *os.File
+	terminalscr     *gc.Window
+	terminalOpened  bool
+	terminalFocused bool // keys go to the shell instead of the editor
+	terminalLock    *sync.RWMutex
+	terminalTabs    []*TerminalTab
+	terminalTab     *TerminalTab // the tab shown in the terminal pane
+	terminalRedraws chan bool    // output arrived for the tab shown, it is drawn by the loop reading keys
+
+	miniWindow         *MiniWindow
+	menuWindow         *FileMenuWindow
+	commandMenuWindow  *CommandMenuWindow
+	registerMenuWindow *RegisterMenuWindow
+	listMenuWindow     *ListMenuWindow
+	popupWindow        *PopUpWindow
+	statusLine         *StatusLine
+
+	keymap    *Keymap
+	vim       *Vim
+	registers *Registers
+	tasks     *TaskRunner
 
 	// TODO: Maybe collect all these into a struct
-	openPathsToNames map[string]string   // paths to name
-	openedFiles      []string            // List of paths
-	modified         map[string]bool     // paths to bool
-	current          int                 // current file user is on
-	tempFilePaths    map[string]string   // paths to temp file paths
-	tempFilePos      map[string]Location // where the user is in each opened file
+	openPathsToNames map[string]string     // paths to name
+	openedFiles      []string              // List of paths
+	modified         map[string]bool       // paths to bool
+	current          int                   // current file user is on
+	buffers          map[string]*Buffer    // paths to the text and undo history of the open files
+	tempFilePaths    map[string]string     // paths to temp file paths
+	tempFilePos      map[string]Location   // where the user is in each opened file
+	softWrap         map[string]bool       // paths to whether long lines are wrapped
+	folds            map[string][]Fold     // paths to the folded regions
+	formats          map[string]FileFormat // paths to the encoding and line endings they had on disk
+	readOnly         map[string]bool       // paths to whether the file can't be edited or saved
+	unnamed          map[string]bool       // paths of files that aren't saved anywhere yet, they are saved by picking a name
+
+	stdinChunks chan []byte // text read from stdin that isn't added to its file yet
+	stdinBuffer *Buffer     // the file stdin is read into
+
+	viewMode bool // keys page through the files like a pager, set by gim view
 }
 
 var DEBUG_MODE = false
 
-func filterEscapeCodes(input string) string {
-	return strings.ReplaceAll(stripansi.Strip(input), "\r", "")
-}
+const EVENT_POLL_INTERVAL = 100   // milliseconds the main loop waits for a key before it checks on what runs in the background
+const TERMINAL_POLL_INTERVAL = 20 // the same while the terminal is focused, its output is drawn sooner as it echoes what is typed
 
-func (e *Editor) captureTerminalOutput() {
-	scanner := bufio.NewScanner(e.cmd)
-	for scanner.Scan() {
-		e.outputToTerminal(filterEscapeCodes(scanner.Text()))
+var ErrReadOnly = errors.New("file is read-only")
+var ErrUnnamed = errors.New("file has no name")
+
+func (e *Editor) captureTerminalOutput(tab *TerminalTab) {
+	buffer := make([]byte, PASTE_BUFFER_SIZE)
+	for {
+		n, err := tab.pty.Read(buffer)
+		if err != nil {
+			break
+		}
+
+		e.terminalLock.Lock()
+		_, _ = tab.terminal.Write(buffer[:n])
+		tab.keepScroll()
+		e.terminalLock.Unlock()
+
+		if tab == e.terminalTab {
+			e.requestTerminalRedraw()
+		}
 	}
-	e.terminalAlive = false
+
+	tab.alive = false
+	_, _ = tab.process.Wait()
+	_ = tab.pty.Close()
 	e.debugLog("terminal output capture stopped")
 }
 
 func (e *Editor) executeTerminalCommand(command string, args ...string) {
-	if !e.terminalAlive {
+	if !e.terminalTab.alive {
 		err := e.initTerminal()
 		if err != nil {
 			e.debugLog(err)
@@ -96,12 +113,29 @@ func (e *Editor) executeTerminalCommand(command string, args ...string) {
 	}
 	command = strings.Join(append([]string{command}, args...), " ") + "\r"
 
-	_, err := io.WriteString(e.cmd, command)
+	_, err := io.WriteString(e.terminalTab.pty, command)
 	if err != nil {
 		e.debugLog(err)
 	}
 }
 
+// Asks the loop reading keys to draw the terminal, ncurses can only be used from there
+func (e *Editor) requestTerminalRedraw() {
+	select {
+	case e.terminalRedraws <- true:
+	default: // one is already waiting
+	}
+}
+
+// Draws the terminal if output arrived since the last time
+func (e *Editor) drawRequestedTerminal() {
+	select {
+	case <-e.terminalRedraws:
+		e.drawTerminal()
+	default:
+	}
+}
+
 func (e *Editor) drawTerminal() {
 	e.terminalLock.RLock()
 	defer e.terminalLock.RUnlock()
@@ -113,17 +147,27 @@ func (e *Editor) drawTerminal() {
 	if e.terminalOpened {
 		e.terminalscr.Erase()
 		y, _ := e.terminalscr.MaxYX()
-		for i, line := range e.terminalLines {
-			e.terminalscr.MovePrint(y-i-1, 1, line)
-		}
-		e.terminalscr.VLine(0, 0, 0, e.maxY)
+		e.drawTerminalTabs()
+		e.drawTerminalCells()
+		e.terminalscr.VLine(0, 0, 0, y)
 
 		e.terminalscr.MoveAddChar(1, 0, gc.ACS_RTEE)
-		e.terminalscr.Refresh()
 	}
 
-	accountedForTabs := e.accountForTabs(e.x, e.y)
-	e.stdscr.Move(e.y-e.printLinesIndex, accountedForTabs-e.printLineStartIndex)
+	if e.terminalFocused {
+		x, y := e.terminalTab.terminal.Cursor()
+		e.terminalscr.Move(y+TERMINAL_HEADER_HEIGHT, x+1)
+		e.terminalscr.Refresh()
+		if !e.terminalTab.terminal.CursorVisible() || e.terminalTab.scroll > 0 {
+			return
+		}
+	} else {
+		if e.terminalOpened {
+			e.terminalscr.Refresh()
+		}
+		e.stdscr.Move(e.getCursorScreenPosition())
+		e.stdscr.Refresh()
+	}
 
 	err = gc.Cursor(1)
 	if err != nil {
@@ -140,34 +184,12 @@ func (e *Editor) outputToTerminal(args ...any) {
 		logString += fmt.Sprint(arg)
 	}
 
-	logArray := strings.Split(logString, "\n")
-
-	finalArray := make([]string, 0)
-
-	_, terminalWidth := e.terminalscr.MaxYX()
-	terminalWidth -= 2
-	for _, line := range logArray {
-		if len(line) >= terminalWidth {
-			splitLineArr := make([]string, 0)
-			for len(line) >= terminalWidth {
-				prev := line[:terminalWidth]
-
-				splitLineArr = append(splitLineArr, prev)
-				line = line[terminalWidth:]
-			}
-			splitLineArr = append(splitLineArr, line)
-			finalArray = append(finalArray, utils.Reverse(splitLineArr)...)
-			continue
-		}
-		finalArray = append(finalArray, line)
-	}
+	// The terminal moves down a line on \n but doesn't go back to the start of it
+	text := strings.ReplaceAll(logString, "\n", "\r\n") + "\r\n"
 
 	e.terminalLock.Lock()
-	e.terminalLines = append(finalArray, e.terminalLines...)
-
-	if len(e.terminalLines) > e.maxY {
-		e.terminalLines = e.terminalLines[:e.maxY]
-	}
+	_, _ = e.terminalTab.terminal.Write([]byte(text))
+	e.terminalTab.keepScroll()
 	e.terminalLock.Unlock()
 
 	e.drawTerminal()
@@ -188,57 +210,70 @@ func (e *Editor) debugLog(args ...any) {
 	}
 }
 
+// Starts the shell of the shown terminal tab
 func (e *Editor) initTerminal() error {
-	// Create the command.
-	if e.terminalAlive {
+	tab := e.terminalTab
+	if tab.alive {
 		return nil
 	}
 
-	c := exec.Command("sh")
+	shell := getShell()
+	c := exec.Command(shell[0], shell[1:]...)
+	c.Dir = tab.dir
+	c.Env = append(os.Environ(), "TERM="+TERMINAL_TYPE)
 
 	var err error
-	e.cmd, err = pty.Start(c)
+	tab.pty, err = pty.Start(c)
 	if err != nil {
 		return err
 	}
+	tab.process = c.Process
+	tab.terminal.Output = tab.pty
 
 	e.addCleanUpFunc(func() {
 		e.debugLog("killing terminal")
-		err := c.Process.Kill()
+		err := tab.kill()
 		if err != nil {
 			e.debugLog(err)
 		}
 		e.debugLog("terminal process killed")
 	})
 
-	maxY, maxX := e.terminalscr.MaxYX()
-	err = pty.Setsize(e.cmd, &pty.Winsize{
-		Rows: uint16(maxY),
-		Cols: uint16(maxX),
-		X:    0,
-		Y:    0,
-	})
+	err = e.resizePty(tab)
 	if err != nil {
 		return err
 	}
 
-	go e.captureTerminalOutput()
+	tab.alive = true
+	go e.captureTerminalOutput(tab)
 
-	e.terminalAlive = true
 	e.debugLog("terminal started")
 
 	return nil
 }
 
+// Tells the shell how big the terminal is
+func (e *Editor) resizePty(tab *TerminalTab) error {
+	cols, rows := tab.terminal.Size()
+	return pty.Setsize(tab.pty, &pty.Winsize{
+		Rows: uint16(rows),
+		Cols: uint16(cols),
+		X:    0,
+		Y:    0,
+	})
+}
+
 func (e *Editor) addCleanUpFunc(f func()) {
 	e.cleanUps = append(e.cleanUps, f)
 }
 
 func (e *Editor) Init() {
 	var err error
-	e.stdscr, err = gc.Init()
+	e.View = &View{Buffer: &Buffer{transactions: NewTransactions()}}
+	screen, err := initScreen()
 
 	e.terminalLock = &sync.RWMutex{}
+	e.terminalRedraws = make(chan bool, 1)
 
 	e.cleanUps = make([]func(), 0)
 
@@ -249,30 +284,17 @@ func (e *Editor) Init() {
 	ReadEditorConfig()
 	config := GetEditorConfig()
 
-	e.maxY, e.maxX = e.stdscr.MaxYX()
+	screenHeight, screenWidth := screen.MaxYX()
 
-	e.stdscr, err = gc.NewWindow(e.maxY, e.maxX-config.LineNumberWidth, 2, config.LineNumberWidth)
+	terminalY, terminalX, terminalHeight, terminalWidth := getTerminalRect(screenHeight, screenWidth)
+	e.terminalscr, err = gc.NewWindow(terminalHeight, terminalWidth, terminalY, terminalX)
 	if err != nil {
 		e.End()
 		log.Fatal(err)
 	}
+	e.terminalscr.Keypad(true)
 
-	terminalXpos := e.maxX*3/5 + config.LineNumberWidth + 1
-	e.terminalscr, err = gc.NewWindow(e.maxY-1, e.maxX*2/5-config.LineNumberWidth, 0, e.maxX*3/5+config.LineNumberWidth+1)
-	e.terminalscr.ScrollOk(true)
-	if err != nil {
-		e.End()
-		log.Fatal(err)
-	}
-	e.maxY, e.maxX = e.stdscr.MaxYX()
-
-	e.lineNrscr, err = gc.NewWindow(e.maxY, config.LineNumberWidth, 2, 0)
-	if err != nil {
-		e.End()
-		log.Fatal(err)
-	}
-
-	e.headerscr, err = gc.NewWindow(2, e.maxX+config.LineNumberWidth, 0, 0)
+	e.headerscr, err = gc.NewWindow(2, screenWidth, 0, 0)
 	if err != nil {
 		e.End()
 		log.Fatal(err)
@@ -293,35 +315,56 @@ func (e *Editor) Init() {
 	gc.Raw(true)       // Hell yeah
 	gc.SetEscDelay(10) // Watch out for this
 
-	err = e.stdscr.Keypad(true)
+	enableBracketedPaste()
+
+	gc.SetTabSize(config.TabWidth)
+
+	e.miniWindow, err = NewMiniWindow(getMiniWindowRect(screenHeight, screenWidth))
 	if err != nil {
 		e.End()
 		log.Fatal(err)
 	}
 
-	gc.SetTabSize(config.TabWidth)
+	e.lines = make([]string, 1)
+	e.addTerminalTab("")
+	e.keymap = NewKeymap()
+	e.vim = NewVim(config.VimMode)
+	e.registers = NewRegisters()
+	e.tasks = NewTaskRunner()
+	onScreenResize = e.resizeScreen
+	e.addCleanUpFunc(func() {
+		err := e.tasks.stop()
+		if err != nil {
+			e.debugLog("failed to stop task:", err)
+		}
+	})
 
-	e.miniWindow, err = NewMiniWindow(e.maxY-1, 4, 1, e.maxX)
+	menuY, menuX, menuHeight, menuWidth := getMenuRect(screenHeight, screenWidth)
+	e.menuWindow, err = NewFileMenuWindow(menuY, menuX, menuHeight, menuWidth)
 	if err != nil {
 		e.End()
 		log.Fatal(err)
 	}
+	e.addCleanUpFunc(func() {
+		err := e.menuWindow.walker.Close()
+		if err != nil {
+			e.debugLog("failed to stop watching files:", err)
+		}
+	})
 
-	_, terminalWidth := e.terminalscr.MaxYX()
-	e.terminalWindow, err = NewMiniWindow(e.maxY-1, terminalXpos, e.maxY-1, terminalWidth)
+	e.commandMenuWindow, err = NewCommandMenuWindow(menuY, menuX, menuHeight, menuWidth)
 	if err != nil {
 		e.End()
 		log.Fatal(err)
 	}
 
-	e.lines = make([]string, 1)
-	e.terminalLines = make([]string, 0)
-	e.transactions = NewTransactions()
+	e.registerMenuWindow, err = NewRegisterMenuWindow(menuY, menuX, menuHeight, menuWidth)
+	if err != nil {
+		e.End()
+		log.Fatal(err)
+	}
 
-	// TODO: not hardcode these values
-	width := e.maxX - 12
-	height := 20
-	e.menuWindow, err = NewFileMenuWindow(e.maxY/2-(height/2), utils.Max(e.maxX/2-(width/2), 4), height, width)
+	e.listMenuWindow, err = NewListMenuWindow(menuY, menuX, menuHeight, menuWidth)
 	if err != nil {
 		e.End()
 		log.Fatal(err)
@@ -330,14 +373,26 @@ func (e *Editor) Init() {
 	e.openPathsToNames = make(map[string]string)
 	e.openedFiles = make([]string, 0)
 	e.modified = make(map[string]bool)
+	e.buffers = make(map[string]*Buffer)
 	e.tempFilePaths = make(map[string]string)
 	e.tempFilePos = make(map[string]Location)
+	e.softWrap = make(map[string]bool)
+	e.folds = make(map[string][]Fold)
+	e.formats = make(map[string]FileFormat)
+	e.readOnly = make(map[string]bool)
+	e.unnamed = make(map[string]bool)
 
-	e.popupWindow, err = NewPopUpWindow(e.maxY/2, e.maxX/2, 3, 5)
+	e.popupWindow, err = NewPopUpWindow(getPopUpRect(screenHeight, screenWidth))
 	if err != nil {
 		e.End()
 		log.Fatal(err)
 	}
+
+	e.statusLine = NewStatusLine()
+
+	e.views = []*View{e.View}
+	e.layout = NewLayout(e.View)
+	e.layoutViews()
 }
 func (e *Editor) isSelected(startX, endX, startY, endY, line, col int) bool {
 	if startX == endX && startY == endY {
@@ -377,10 +432,7 @@ func (e *Editor) drawHeader() {
 			break
 		}
 
-		name := e.openPathsToNames[path]
-		if e.modified[path] {
-			name = "*" + name
-		}
+		name := e.getHeaderName(path)
 
 		if x < 0 {
 			if x+len(name)+1 < 0 {
@@ -414,6 +466,27 @@ func (e *Editor) drawHeader() {
 		e.headerscr.VLine(0, curX, 0, 1)
 		x += len(name) + 1
 	}
+
+	if macros.recording {
+		recording := " recording " + macros.register + " "
+		e.headerscr.AttrOn(gc.A_REVERSE)
+		e.headerscr.MovePrint(0, utils.Max(maxX-len(recording), 0), recording)
+		e.headerscr.AttrOff(gc.A_REVERSE)
+		maxX -= len(recording)
+	}
+
+	if e.vim.enabled {
+		mode := " " + e.vim.mode + " "
+		e.headerscr.AttrOn(gc.A_BOLD)
+		e.headerscr.MovePrint(0, utils.Max(maxX-len(mode), 0), mode)
+		e.headerscr.AttrOff(gc.A_BOLD)
+		maxX -= len(mode)
+	}
+
+	if pending := strings.TrimSpace(e.keymap.getPending() + " " + e.vim.getPending()); pending != "" {
+		pending += " -"
+		e.headerscr.MovePrint(0, utils.Max(maxX-len(pending)-1, 0), pending)
+	}
 	e.headerscr.Refresh()
 }
 func (e *Editor) drawLineNumbers() {
@@ -422,8 +495,15 @@ func (e *Editor) drawLineNumbers() {
 	start := e.printLinesIndex
 	e.lineNrscr.Erase()
 	EnableColor(e.lineNrscr, config.LineNumberColor.Color)
-	for i := 1; i <= e.maxY; i++ {
-		e.lineNrscr.MovePrint(i-1, 0, fmt.Sprintf("%s", strconv.Itoa(start+i)))
+	if e.isSoftWrapped() {
+		e.drawWrappedLineNumbers()
+	} else {
+		y := start
+		for i := 1; i <= e.maxY; i++ {
+			e.lineNrscr.MovePrint(i-1, 0, fmt.Sprintf("%s", strconv.Itoa(y+1)))
+			e.drawFoldMarker(i-1, y)
+			y = e.nextVisibleLine(y)
+		}
 	}
 	DisableColor(e.lineNrscr, config.LineNumberColor.Color)
 	e.lineNrscr.VLine(0, config.LineNumberWidth-1, 0, e.maxY)
@@ -448,7 +528,36 @@ func (e *Editor) accountForTabs(x, y int) int {
 	}
 	return newX
 }
+
+// Returns where the cursor is on stdscr
+func (e *Editor) getCursorScreenPosition() (int, int) {
+	accountedForTabs := e.accountForTabs(e.x, e.y)
+	if e.isSoftWrapped() {
+		return e.getWrappedCursorPosition(accountedForTabs)
+	}
+
+	return e.countVisibleLines(e.printLinesIndex, e.y), accountedForTabs - e.printLineStartIndex
+}
+
+// Draws every view, the focused one last so the cursor ends up in it
 func (e *Editor) draw() {
+	focused := e.View
+	for _, v := range e.views {
+		if v == focused {
+			continue
+		}
+
+		e.View = v
+		e.clampView()
+		e.drawView(false)
+	}
+	e.View = focused
+
+	e.drawStatusLine()
+	e.drawView(true)
+}
+
+func (e *Editor) drawView(focused bool) {
 	config := GetEditorConfig()
 
 	accountedForTabs := e.accountForTabs(e.x, e.y)
@@ -473,22 +582,57 @@ func (e *Editor) draw() {
 		selectedXEnd = utils.Max(tempStart, tempEnd)
 	}
 
+	e.printLinesIndex = e.skipFold(e.printLinesIndex, -1)
+	if e.isSoftWrapped() {
+		e.printLineStartIndex = 0
+		e.scrollToWrappedCursor()
+	}
+
 	err := gc.Cursor(0)
 	if err != nil {
 		e.debugLog(err)
 	}
 	e.drawLineNumbers()
-	e.drawHeader()
+	if focused {
+		e.drawHeader()
+	}
+	e.drawViewBar(focused)
 	e.stdscr.Erase()
-	e.selected = ""
-	lastY := -1
+	e.updateSelected()
 
-	tokens := e.lexer.Tokenize(strings.Join(e.lines[:utils.Min(e.printLinesIndex+e.maxY, len(e.lines))], "\n"))
+	lastLine := e.printLinesIndex
+	for row := 0; row < e.maxY && lastLine < len(e.lines); row++ {
+		lastLine = e.nextVisibleLine(lastLine)
+	}
+	tokens := e.lexer.Tokenize(strings.Join(e.lines[:utils.Min(lastLine, len(e.lines))], "\n"))
 
-	for i, line := range tokens[e.printLinesIndex:] {
-		if i >= e.maxY {
-			break
+	if e.isSoftWrapped() {
+		e.drawWrapped(tokens, selectedXStart, selectedXEnd, selectedYStart, selectedYEnd)
+	} else {
+		e.drawLines(tokens, selectedXStart, selectedXEnd, selectedYStart, selectedYEnd)
+	}
+
+	cursorY, cursorX := e.getCursorScreenPosition()
+	e.stdscr.Move(cursorY, cursorX)
+
+	if focused && 0 <= cursorY && cursorY < e.maxY {
+		err = gc.Cursor(1)
+		if err != nil {
+			e.debugLog(err)
 		}
+	}
+
+	e.stdscr.Refresh()
+}
+
+func (e *Editor) drawLines(tokens [][]Token, selectedXStart, selectedXEnd, selectedYStart, selectedYEnd int) {
+	row := 0
+	for y := e.printLinesIndex; y < len(e.lines) && y < len(tokens) && row < e.maxY; y = e.nextVisibleLine(y) {
+		line := tokens[y]
+		i := row
+		row++
+
+		e.drawFoldSummary(i, e.accountForTabs(len(e.lines[y]), y)-e.printLineStartIndex, y)
 
 		if len(line) == 0 || line[len(line)-1].location.col+line[len(line)-1].Length() <= e.printLineStartIndex {
 			e.stdscr.Println()
@@ -527,11 +671,6 @@ func (e *Editor) draw() {
 					highlighted = true
 					DisableColor(e.stdscr, t.color)
 					e.stdscr.AttrOn(gc.A_REVERSE)
-					if lastY != -1 && t.location.line != lastY {
-						e.selected += "\n"
-					}
-					e.selected += string(chr)
-					lastY = t.location.line
 				}
 				e.stdscr.AddChar(gc.Char(chr))
 
@@ -545,17 +684,6 @@ func (e *Editor) draw() {
 		e.stdscr.Println()
 
 	}
-
-	e.stdscr.Move(e.y-e.printLinesIndex, accountedForTabs-e.printLineStartIndex)
-
-	if e.printLinesIndex <= e.y && e.y < e.printLinesIndex+e.maxY {
-		err = gc.Cursor(1)
-		if err != nil {
-			e.debugLog(err)
-		}
-	}
-
-	e.stdscr.Refresh()
 }
 
 func (e *Editor) runCleanUps() {
@@ -570,20 +698,33 @@ func (e *Editor) End() {
 	}
 
 	e.runCleanUps()
+	disableBracketedPaste()
 	gc.End()
 }
-func (e *Editor) removeSelection() {
-	selectedXStart := e.selectedXStart
-	selectedXEnd := e.selectedXEnd
-	selectedYStart := utils.Min(e.selectedYStart, e.selectedYEnd)
-	selectedYEnd := utils.Max(e.selectedYStart, e.selectedYEnd)
-	if selectedYStart == e.selectedYEnd { // Did the ends swap
-		selectedXStart = e.selectedXEnd
-		selectedXEnd = e.selectedXStart
+
+func (e *Editor) hasSelection() bool {
+	return e.selectedXStart != e.selectedXEnd || e.selectedYStart != e.selectedYEnd
+}
+
+// Returns the selection with the start before the end, regardless of which way it was made
+func (e *Editor) getSelectionBounds() (startY, startX, endY, endX int) {
+	startX = e.selectedXStart
+	endX = e.selectedXEnd
+	startY = utils.Min(e.selectedYStart, e.selectedYEnd)
+	endY = utils.Max(e.selectedYStart, e.selectedYEnd)
+	if startY == e.selectedYEnd { // Did the ends swap
+		startX = e.selectedXEnd
+		endX = e.selectedXStart
+	}
+	if startY == endY { // Are the ends the same
+		startX = utils.Min(e.selectedXStart, e.selectedXEnd)
+		endX = utils.Max(e.selectedXStart, e.selectedXEnd)
 	}
+	return
+}
+func (e *Editor) removeSelection() {
+	selectedYStart, selectedXStart, selectedYEnd, selectedXEnd := e.getSelectionBounds()
 	if selectedYStart == selectedYEnd { // Are the ends the same
-		selectedXStart = utils.Min(e.selectedXStart, e.selectedXEnd)
-		selectedXEnd = utils.Max(e.selectedXStart, e.selectedXEnd)
 		e.remove(selectedYStart, selectedXEnd, selectedXEnd-selectedXStart)
 		e.moveXto(selectedXStart)
 		return
@@ -607,6 +748,10 @@ func (e *Editor) removeText(y, x, num int) string {
 	return text
 }
 func (e *Editor) remove(y, x, num int) {
+	if !e.checkEditable() {
+		return
+	}
+
 	if num == 0 {
 		return
 	}
@@ -657,6 +802,10 @@ func (e *Editor) insertText(y, x int, text string) (int, int) {
 	return y, x
 }
 func (e *Editor) insert(y, x int, text string) {
+	if !e.checkEditable() {
+		return
+	}
+
 	e.modified[e.path] = true
 
 	y, x = e.insertText(y, x, text)
@@ -671,7 +820,61 @@ func (e *Editor) insert(y, x int, text string) {
 	}
 	e.transactions.addAction(a)
 }
+
+// Inserts text that can span multiple lines, returns where it ends
+func (e *Editor) insertString(y, x int, text string) (int, int) {
+	lines := strings.Split(text, "\n")
+	if len(lines) == 1 {
+		e.insert(y, x, text)
+		return y, x + len(text)
+	}
+
+	rest := e.lines[y][x:]
+	e.remove(y, len(e.lines[y]), len(rest))
+	e.insert(y, x, lines[0])
+
+	added := append([]string{}, lines[1:]...)
+	added[len(added)-1] += rest
+	e.addLines(y+1, added)
+
+	last := len(lines) - 1
+	return y + last, len(lines[last])
+}
+
+// Sets the selected text from the selection, whether it is on the screen or not
+func (e *Editor) updateSelected() {
+	e.selected = ""
+	if !e.hasSelection() {
+		return
+	}
+
+	startY, startX, endY, endX := e.getSelectionBounds()
+	last := len(e.lines) - 1
+	startY, endY = utils.Min(startY, last), utils.Min(endY, last)
+	startX = utils.Min(startX, len(e.lines[startY]))
+	endX = utils.Min(endX, len(e.lines[endY]))
+	if startY == endY && startX > endX {
+		return
+	}
+	e.selected = e.getText(startY, startX, endY, endX)
+}
+
+// Returns the text from startY, startX up to endY, endX
+func (e *Editor) getText(startY, startX, endY, endX int) string {
+	if startY == endY {
+		return e.lines[startY][startX:endX]
+	}
+
+	text := e.lines[startY][startX:]
+	for y := startY + 1; y < endY; y++ {
+		text += "\n" + e.lines[y]
+	}
+	return text + "\n" + e.lines[endY][:endX]
+}
 func (e *Editor) undoTransaction() {
+	if !e.checkEditable() {
+		return
+	}
 	before := time.Now()
 	defer e.debugLog("undo took:", time.Since(before))
 
@@ -700,6 +903,9 @@ func (e *Editor) undoTransaction() {
 	e.moveXto(ta.location.col)
 }
 func (e *Editor) redoTransaction() {
+	if !e.checkEditable() {
+		return
+	}
 	before := time.Now()
 	defer e.debugLog("redo took:", time.Since(before))
 
@@ -730,6 +936,10 @@ func (e *Editor) redoTransaction() {
 	e.moveXto(ta.location.col)
 }
 func (e *Editor) addLines(y int, lines []string) {
+	if !e.checkEditable() {
+		return
+	}
+
 	e.addLinesText(y, lines)
 
 	ta := Action{
@@ -757,6 +967,8 @@ func (e *Editor) addLinesText(y int, lines []string) {
 	}
 
 	e.lines = newList
+	e.shiftFolds(y, len(lines))
+	e.shiftViews(y, len(lines))
 	e.debugLog("len:", len(e.lines))
 }
 func (e *Editor) deleteLinesText(y, num int) (text string) {
@@ -769,10 +981,16 @@ func (e *Editor) deleteLinesText(y, num int) (text string) {
 
 		text = strings.Join(deletedLines, "\n")
 		e.lines = append(e.lines[:y], e.lines[utils.Min(y+num, len(e.lines)):]...)
+		e.shiftFolds(y, -len(deletedLines))
+		e.shiftViews(y, -len(deletedLines))
 	}
 	return
 }
 func (e *Editor) deleteLines(y, num int) {
+	if !e.checkEditable() {
+		return
+	}
+
 	if len(e.lines) <= 0 {
 		return
 	}
@@ -830,8 +1048,14 @@ func (e *Editor) switchFile(delta int) {
 func (e *Editor) exitFile(path string) {
 	delete(e.openPathsToNames, path)
 	delete(e.modified, path)
+	delete(e.buffers, path)
 	delete(e.tempFilePaths, path)
 	delete(e.tempFilePos, path)
+	delete(e.softWrap, path)
+	delete(e.folds, path)
+	delete(e.formats, path)
+	delete(e.readOnly, path)
+	delete(e.unnamed, path)
 
 	if e.path == path {
 		e.switchFile(1)
@@ -840,6 +1064,13 @@ func (e *Editor) exitFile(path string) {
 	index := utils.Index(e.openedFiles, path)
 	e.openedFiles = append(e.openedFiles[:index], e.openedFiles[index+1:]...)
 
+	// Other views showing the file show the one the current view switched to
+	for _, v := range e.views {
+		if v != e.View && v.path == path {
+			e.loadInView(v, e.path)
+		}
+	}
+
 	e.current = utils.Index(e.openedFiles, e.path)
 }
 
@@ -847,10 +1078,7 @@ func (e *Editor) calculateHeaderOffset() {
 	_, maxX := e.headerscr.MaxYX()
 	x := -e.headerOffset
 	for _, path := range e.openedFiles {
-		name := e.openPathsToNames[path]
-		if e.modified[path] {
-			name = "*" + name
-		}
+		name := e.getHeaderName(path)
 
 		if path == e.path && x+len(name) > maxX {
 			xWithoutOffset := x + e.headerOffset
@@ -870,56 +1098,59 @@ func (e *Editor) calculateHeaderOffset() {
 	}
 }
 
-func (e *Editor) Load(filePath string) error {
-	if e.path != "" && e.modified[e.path] {
-		if _, ok := e.tempFilePaths[e.path]; !ok {
-			tempFile, err := os.CreateTemp("", e.openPathsToNames[e.path])
-			if err != nil {
-				return err
-			}
-			e.tempFilePaths[e.path] = tempFile.Name()
+// Creates a temp file for unsaved changes in the gim folder, so they are still there after a reboot
+func createTempFile(name string) (*os.File, error) {
+	dir := JoinPath(getHomePath(), UNSAVED_PATH)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, name)
+}
 
-		}
+// Writes the text of the current file to its temp file if it has unsaved changes, so it can be loaded again
+func (e *Editor) saveTempFile() error {
+	// Unnamed files are only kept in their buffer
+	if e.path == "" || !e.modified[e.path] || e.unnamed[e.path] {
+		return nil
+	}
 
-		data := []byte(strings.Join(e.lines, "\n"))
-		err := os.WriteFile(e.tempFilePaths[e.path], data, 0666)
+	if _, ok := e.tempFilePaths[e.path]; !ok {
+		tempFile, err := createTempFile(e.openPathsToNames[e.path])
 		if err != nil {
 			return err
 		}
-
+		tempFile.Close()
+		e.tempFilePaths[e.path] = tempFile.Name()
 	}
-	e.tempFilePos[e.path] = Location{col: e.x, line: e.y}
-	e.path = filePath
 
+	data := []byte(strings.Join(e.lines, "\n"))
+	return os.WriteFile(e.tempFilePaths[e.path], data, 0666)
+}
+
+// Reads the lines of the file, from its temp file if it has unsaved changes
+func (e *Editor) readLines(filePath string) ([]string, error) {
 	var lines []byte
 	var err error
-	if modified, ok := e.modified[e.path]; ok && modified {
-		lines, err = os.ReadFile(e.tempFilePaths[e.path])
+	if modified, ok := e.modified[filePath]; ok && modified {
+		lines, err = os.ReadFile(e.tempFilePaths[filePath])
 		if err != nil {
-			return err
+			return nil, err
 		}
 	} else {
 		lines, err = os.ReadFile(filePath)
-		e.modified[e.path] = false
-		if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
 			e.debugLog("file not found, creating file")
 			lines = []byte{}
-			e.modified[e.path] = true
-		}
-	}
-
-	fileExtension := filepath.Ext(filePath)
-	if fileExtension != "" {
-		fileExtension = strings.ReplaceAll(fileExtension, ".", "")
-		err = e.lexer.SetHighlighting(fileExtension)
-		if err != nil {
-			e.debugLog(err)
+			e.modified[filePath] = true
+		} else if err != nil {
+			return nil, err
+		} else {
+			e.modified[filePath] = false
 		}
+		e.formats[filePath] = getFileFormat(lines)
 	}
 
-	e.selectedXStart, e.selectedYStart, e.selectedXEnd, e.selectedYEnd = 0, 0, 0, 0
-	e.inlinePosition = 0
-
 	text := make([]string, 1)
 	lineNr := 0
 	for _, r := range lines {
@@ -938,11 +1169,46 @@ func (e *Editor) Load(filePath string) error {
 		text[lineNr] += chr
 
 	}
-	e.lines = text
+	return text, nil
+}
+
+func (e *Editor) Load(filePath string) error {
+	err := e.saveTempFile()
+	if err != nil {
+		return err
+	}
+
+	// An open file keeps its buffer so its undo history stays, else it is read first so the current file stays open if it can't be
+	buffer, ok := e.buffers[filePath]
+	if !ok {
+		text, err := e.readLines(filePath)
+		if err != nil {
+			return err
+		}
+		buffer = &Buffer{lines: text, transactions: NewTransactions()}
+	}
+
+	// What was done in the file being left is one undo step, even when it was the command switching files
+	e.transactions.submit(e.y, e.x)
+
+	e.tempFilePos[e.path] = Location{col: e.x, line: e.y}
+	e.path = filePath
+	e.Buffer = buffer
+
+	fileExtension := filepath.Ext(filePath)
+	if fileExtension != "" {
+		fileExtension = strings.ReplaceAll(fileExtension, ".", "")
+		err = e.lexer.SetHighlighting(fileExtension)
+		if err != nil {
+			e.debugLog(err)
+		}
+	}
+
+	e.selectedXStart, e.selectedYStart, e.selectedXEnd, e.selectedYEnd = 0, 0, 0, 0
+	e.inlinePosition = 0
 
 	if loc, ok := e.tempFilePos[e.path]; ok {
-		e.moveYto(loc.line)
-		e.moveXto(loc.col)
+		e.moveToClamped(loc.line, loc.col)
 		e.debugLog("loc:", loc.col, loc.line)
 
 	} else {
@@ -951,6 +1217,18 @@ func (e *Editor) Load(filePath string) error {
 	}
 
 	if _, ok := e.openPathsToNames[filePath]; !ok {
+		// Switching back to a file that is open isn't a visit
+		if !e.unnamed[filePath] {
+			e.addRecentFile(filePath)
+		}
+
+		e.softWrap[filePath] = shouldSoftWrap(filePath)
+		if !isWritable(filePath) {
+			e.readOnly[filePath] = true
+		}
+
+		e.buffers[filePath] = buffer
+
 		filename := filepath.Base(filePath)
 		e.openPathsToNames[filePath] = filename
 		e.openedFiles = append(e.openedFiles, filePath)
@@ -966,15 +1244,21 @@ func (e *Editor) Load(filePath string) error {
 	return nil
 }
 func (e *Editor) moveY(delta int) {
-	config := GetEditorConfig()
-
 	e.y = utils.Min(utils.Max(e.y+delta, 0), len(e.lines)-1)
+	e.y = e.skipFold(e.y, delta)
 	e.clampX()
+	e.scrollToCursor()
+}
+
+// Scrolls so the cursor line is on the screen, with some lines around it
+func (e *Editor) scrollToCursor() {
+	config := GetEditorConfig()
 
-	if e.y-e.printLinesIndex > e.maxY-config.TabWidth {
-		e.printLinesIndex = e.y - e.maxY + config.TabWidth
-	} else if e.y-config.TabWidth < e.printLinesIndex {
-		e.printLinesIndex = utils.Max(e.y-config.TabWidth, 0)
+	row := e.countVisibleLines(e.printLinesIndex, e.y)
+	if row > e.maxY-config.TabWidth {
+		e.printLinesIndex = e.stepVisibleLines(e.y, -(e.maxY - config.TabWidth))
+	} else if row < config.TabWidth {
+		e.printLinesIndex = e.stepVisibleLines(e.y, -config.TabWidth)
 	}
 }
 func (e *Editor) moveX(delta int) {
@@ -1002,8 +1286,15 @@ func (e *Editor) moveXto(x int) {
 	e.moveX(x - e.x)
 }
 func (e *Editor) moveYto(y int) {
+	e.unfoldLine(y)
 	e.moveY(y - e.y)
 }
+
+// Moves to a position kept from before, it is clamped as the file can have changed since
+func (e *Editor) moveToClamped(y, x int) {
+	e.moveYto(utils.Min(utils.Max(y, 0), len(e.lines)-1))
+	e.moveXto(utils.Min(utils.Max(x, 0), len(e.lines[e.y])))
+}
 func (e *Editor) getTokenIndexByX(tokens []Token, x int) int {
 	index := -1
 	for i, token := range tokens {
@@ -1119,369 +1410,220 @@ func (e *Editor) find(text string) (int, int) {
 
 	return -1, -1
 }
-func (e *Editor) resizeWindows() {
-	config := GetEditorConfig()
-
-	if e.terminalOpened {
-		_, width := e.terminalscr.MaxYX()
-		e.stdscr.Resize(e.maxY, e.maxX+width)
-		height, _ := e.headerscr.MaxYX()
-		e.headerscr.Resize(height, e.maxX+width+config.LineNumberWidth)
-	} else {
-		_, width := e.terminalscr.MaxYX()
-		e.stdscr.Resize(e.maxY, e.maxX-width)
-		height, _ := e.headerscr.MaxYX()
-		e.headerscr.Resize(height, e.maxX-width+config.LineNumberWidth)
-	}
-
-	_, e.maxX = e.stdscr.MaxYX()
 
+// Opens or closes the space of the terminal, the views get what is left
+func (e *Editor) resizeWindows() {
 	e.terminalOpened = !e.terminalOpened
+	e.layoutViews()
 }
-func (e *Editor) runTerminal() {
+
+// Waits for a key to send to the shell, drawing its output while waiting
+func (e *Editor) waitForTerminalKey() gc.Key {
 	for {
-		e.drawTerminal()
-		command := e.terminalWindow.whileRun(true, ">")
-		if command == "" {
-			break
+		key := getCharTimeout(e.terminalscr, TERMINAL_POLL_INTERVAL)
+		if key != KEY_NONE || !e.terminalTab.alive {
+			return key
 		}
-		commandAndArgs := strings.Split(command, " ")
+		e.drawRequestedTerminal()
+	}
+}
 
-		if len(commandAndArgs) == 1 {
-			e.executeTerminalCommand(command)
-		} else {
-			e.executeTerminalCommand(commandAndArgs[0], commandAndArgs[1:]...)
+// Sends what is typed to the shell until the key to leave the terminal is pressed
+func (e *Editor) runTerminal() {
+	if !e.terminalTab.alive {
+		err := e.initTerminal()
+		if err != nil {
+			e.debugLog(err)
+			return
 		}
 	}
-}
-func (e *Editor) Run() error {
-	for {
-		key := e.stdscr.GetChar()
 
-		updateLengthIndex := true
-		resetSelected := true
-		currentLine := e.lines[e.y]
+	e.terminalFocused = true
+	defer func() {
+		e.terminalFocused = false
+		e.drawTerminal()
+	}()
 
-		beforeY, beforeX := e.y, e.x
+	for e.terminalTab.alive {
+		e.drawTerminal()
 
-		// TODO: Make CTRL and Shift bools instead, how to do release tho?
+		pageSize, _ := e.getTerminalSize()
+		key := e.waitForTerminalKey()
 		switch key {
+		case KEY_NONE: // the shell exited
+			continue
+		case TERMINAL_LEAVE_KEY:
+			return
+		case gc.KEY_RESIZE:
+			e.resizeScreen()
+			continue
+		case gc.KEY_SR: // Shift+Up
+			e.scrollTerminal(1)
+			continue
+		case gc.KEY_SF: // Shift+Down
+			e.scrollTerminal(-1)
+			continue
+		case gc.KEY_SPREVIOUS: // Shift+PageUp
+			e.scrollTerminal(pageSize)
+			continue
+		case gc.KEY_SNEXT: // Shift+PageDown
+			e.scrollTerminal(-pageSize)
+			continue
 		case gc.KEY_ESC:
-			anyUnsaved := false
-			for _, modified := range e.modified {
-				if modified {
-					anyUnsaved = true
-					break
-				}
-			}
-			if anyUnsaved {
-				str := e.miniWindow.whileRun(true, "unsaved, are you sure? (y/n)")
-				if strings.ToLower(str) == "y" {
-					return nil
-				}
-				break
-			}
-
-			return nil
-		case 559, 563: // ALT + Right
-			e.switchFile(1)
-		case 544, 548: // ALT + Left
-			e.switchFile(-1)
-		case 562, 566: // CTRL + Shift + Right
-			e.ctrlMoveRight()
-			resetSelected = false
-			e.selectedXEnd = e.x
-			e.selectedYEnd = e.y
-		case 561, 565: // CTRL + Right
-			e.ctrlMoveRight()
-		case 526, 530: // CTRL + Down
-			e.printLinesIndex = utils.Min(e.printLinesIndex+1, len(e.lines))
-			resetSelected = false
-		case 547, 551: // CTRL + Shift + Left
-			e.ctrlMoveLeft()
-			resetSelected = false
-			e.selectedXEnd = e.x
-			e.selectedYEnd = e.y
-		case 546, 550: // CTRL + Left
-			e.ctrlMoveLeft()
-		case 567, 571: // CTRL + Up
-			e.printLinesIndex = utils.Max(e.printLinesIndex-1, 0)
-			resetSelected = false
-		case 1: // CTRL + A
-			e.selectedYStart = 0
-			e.selectedXStart = 0
-			e.selectedXEnd = len(e.lines[len(e.lines)-1])
-			e.selectedYEnd = len(e.lines) - 1
-
-			e.moveYto(e.selectedYEnd)
-			e.moveXto(e.selectedXEnd)
-			resetSelected = false
-		case 3: // CTRL + C
-			text := e.selected
-			if e.selected == "" {
-				text = "\n" + currentLine
-			}
-			err := clipboard.WriteAll(text)
-			if err != nil {
-				panic(err)
-			}
-		case 4: // CTRL + D
-			e.deleteLines(e.y, 1)
-			e.moveY(0)
-		case 6: // CTRL + F
-			for {
-				str := e.miniWindow.whileRun(false, "find")
-				if str == "" {
-					break
-				}
-
-				y, x := e.find(str)
-				if y == -1 || x == -1 {
-					continue
-				}
-
-				e.debugLog("y, x", y, x)
-				e.moveYto(y)
-				e.moveXto(x)
-
-				e.debugLog("after move y, x", e.y, e.x)
-
-				e.debugLog("x is:", e.x)
-				resetSelected = false
-				e.selectedXStart = e.x
-				e.selectedYStart = e.y
-				e.selectedXEnd = e.x + len(str)
-				e.selectedYEnd = e.y
-
-				e.draw()
-			}
-		case 7: // CTRL + G
-			str := e.miniWindow.whileRun(true, "goto")
-			lineNr, err := strconv.Atoi(str)
-			if err != nil {
-				break
-			}
-
-			if lineNr == -1 {
-				lineNr = len(e.lines)
+			if text, ok := e.readPaste(); ok {
+				e.pasteToTerminal(text, BRACKETED_PASTE_AUTO)
+				continue
 			}
+		}
 
-			e.moveXto(0)
-			e.inlinePosition = 0
-			e.moveYto(lineNr - 1)
-		case 15: // CTRL + O
-			path, err := e.menuWindow.run()
-			if err != nil {
-				e.debugLog(err)
-			}
+		// Typing goes back to the output
+		e.scrollTerminal(-e.terminalTab.scroll)
+		e.writeToTerminal(getTerminalKeySequence(key, e.terminalTab.terminal.ApplicationCursorKeys()))
+	}
+}
+func (e *Editor) Run() error {
+	e.reportKeymapConflicts()
 
-			if path == "" {
-				break
-			}
+	for {
+		// A task that ended, output of the terminal or text from stdin that arrived while waiting for the last key is shown now
+		e.showTaskMessage()
+		e.drawRequestedTerminal()
+		e.addStdinText()
+
+		// Waiting for a key is given up on once in a while, so what happens in the background is shown while no key is pressed
+		key := getCharTimeout(e.stdscr, EVENT_POLL_INTERVAL)
+		if key == KEY_NONE {
+			continue
+		}
+		if key == gc.KEY_RESIZE {
+			e.resizeScreen()
+			continue
+		}
 
-			err = e.Load(path)
-			if err != nil {
-				e.debugLog(err)
-			}
-		case 17: // CTRL + Q Used for testing for now
-			if e.modified[e.path] {
-				str := e.miniWindow.whileRun(true, "unsaved, are you sure? (y/n)")
-				if strings.ToLower(str) != "y" {
-					break
-				}
+		if key == gc.KEY_ESC {
+			if text, ok := e.readPaste(); ok {
+				e.insertPaste(text)
+				continue
 			}
-
-			if len(e.openedFiles) == 1 {
-				return nil
+		} else if (!e.vim.enabled || e.vim.mode == INSERT_MODE) && e.keymap.getPending() == "" {
+			if text, ok := e.readPasteBurst(key); ok {
+				e.insertPaste(text)
+				continue
 			}
+		}
 
-			e.exitFile(e.path)
-		case 18: // CTRL + R
-			for {
-				str1 := e.miniWindow.whileRun(false, "replace(find)")
-				if str1 == "" {
-					break
-				}
-
-				y, x := e.find(str1)
-				if y == -1 || x == -1 {
-					continue
-				}
-
-				e.moveYto(y)
-				e.moveXto(x)
+		if e.handleKey(key) {
+			return nil
+		}
+	}
+}
 
-				resetSelected = false
-				e.selectedXStart = e.x
-				e.selectedYStart = e.y
-				e.selectedXEnd = e.x + len(str1)
-				e.selectedYEnd = e.y
+// Handles a single key press, returns true if the editor should exit
+func (e *Editor) handleKey(key gc.Key) bool {
+	if e.viewMode {
+		if handled, exit := e.handleViewKey(key); handled {
+			return exit
+		}
+	}
 
-				e.draw()
+	if e.vim.enabled {
+		if handled, exit := e.handleVimKey(key); handled {
+			return exit
+		}
+	}
 
-				str2 := e.miniWindow.whileRun(false, "replace(overwrite)")
-				if str2 == "" {
-					break
-				}
+	c := newCommandContext(nil)
 
-				e.removeSelection()
-				e.insert(e.selectedYStart, e.selectedXStart, str2)
-				e.selectedXEnd = e.x + len(str2)
+	beforeY, beforeX := e.y, e.x
 
-				e.draw()
-				e.transactions.submit(e.y, e.x)
-			}
-		case 19: // CTRL + S
-			err := e.Save(e.path)
-			if err != nil {
-				log.Println(err)
-				e.popupWindow.pop("Failed to save!")
-			} else {
-				e.drawHeader()
-			}
-		case 20: // CTRL + T
-			if !e.terminalOpened {
-				e.resizeWindows()
-
-				e.runTerminal()
-			} else {
-				e.resizeWindows()
-			}
-		case 26: // CTRL + Z
-			e.undoTransaction()
-		case 24: // CTRL + X
-			var text string
-			if e.selected == "" {
-				text = "\n" + currentLine
-				e.deleteLines(e.y, 1)
-			} else {
-				text = e.selected
-				e.removeSelection()
-			}
-
-			err := clipboard.WriteAll(text)
+	command, held := e.keymap.resolve(key)
+	if held {
+		if !macros.replaying {
+			e.draw() // Shows the keys typed so far of the sequence
+		}
+		return false
+	}
 
-			if err != nil {
-				panic(err)
-			}
-		case 25: // CTRL + Y
-			e.redoTransaction()
-		case 336: // Shift+Down
-			e.moveY(1)
-			updateLengthIndex = false
-			resetSelected = false
-			e.selectedYEnd = e.y
-			e.selectedXEnd = e.x
-		case 337: // Shift+Up
-			e.moveY(-1)
-			updateLengthIndex = false
-			resetSelected = false
-			e.selectedYEnd = e.y
-			e.selectedXEnd = e.x
-		case 393: // Shift+Left
-			e.moveX(-1)
-			resetSelected = false
-			e.selectedYEnd = e.y
-			e.selectedXEnd = e.x
-		case 402: // Shift+Right
-			e.moveX(1)
-			resetSelected = false
-			e.selectedYEnd = e.y
-			e.selectedXEnd = e.x
-		case 531, 535: // CTRL+END
-			e.moveY(len(e.lines) - e.y)
-			updateLengthIndex = false
-		case 536, 540: // CTRL+Home
-			e.moveY(-e.y)
-			updateLengthIndex = false
-		case gc.KEY_PAGEDOWN:
-			e.printLinesIndex = utils.Min(e.printLinesIndex+e.maxY, len(e.lines))
-			e.moveY(e.maxY)
-		case gc.KEY_PAGEUP:
-			e.printLinesIndex = utils.Max(e.printLinesIndex-e.maxY, 0)
-			e.moveY(-e.maxY)
-		case gc.KEY_DOWN:
-			e.moveY(1)
-			updateLengthIndex = false
-		case gc.KEY_UP:
-			e.moveY(-1)
-			updateLengthIndex = false
-		case gc.KEY_LEFT:
-			e.moveX(-1)
-		case gc.KEY_RIGHT:
-			e.moveX(1)
-		case gc.KEY_ENTER, gc.KEY_RETURN:
-			if e.selected != "" {
-				e.removeSelection()
-			}
+	if command != "" {
+		e.runCommand(command, c)
+		if c.exit {
+			return true
+		}
+	} else if e.vim.enabled && e.vim.mode != INSERT_MODE || !e.typeKey(key, c) {
+		return false
+	}
 
-			newLine := e.lines[e.y][e.x:]
-			e.remove(e.y, len(e.lines[e.y]), len(e.lines[e.y])-e.x)
-			e.addLines(e.y+1, []string{newLine})
+	e.finishKey(c, beforeY, beforeX)
+	return false
+}
 
-			e.moveY(1)
-			e.moveXto(0)
-		case gc.KEY_TAB:
-			if e.selected != "" {
-				e.removeSelection()
-			}
+// Updates the cursor, selection and screen after a key press
+func (e *Editor) finishKey(c *CommandContext, beforeY, beforeX int) {
+	if c.updateLengthIndex {
+		e.inlinePosition = e.accountForTabs(e.x, e.y)
+	}
+	if c.resetSelected {
+		e.selectedXStart = e.x
+		e.selectedYStart = e.y
+		e.selectedXEnd = e.x
+		e.selectedYEnd = e.y
+	}
 
-			e.lines[e.y] = e.lines[e.y][:e.x] + "\t" + e.lines[e.y][e.x:]
-			e.moveX(1)
-		case gc.KEY_SEND:
-			e.moveXto(len(e.lines[e.y]))
-			resetSelected = false
-			e.selectedXEnd = e.x
-		case gc.KEY_END:
-			e.moveXto(len(e.lines[e.y]))
-		case gc.KEY_SHOME:
-			e.moveXto(0)
-			resetSelected = false
-			e.selectedXEnd = e.x
-		case gc.KEY_HOME:
-			e.moveXto(0)
-		case gc.KEY_BACKSPACE:
-			if e.selected != "" {
-				e.removeSelection()
-				break
-			}
+	e.y = utils.Min(utils.Max(len(e.lines)-1, 0), e.y)
+	e.updateSelected() // draw is skipped when replaying, the next key still needs it
+	if !macros.replaying {
+		e.draw()
+	}
+	e.transactions.submit(beforeY, beforeX)
+}
 
-			x := e.x
-			y := e.y
-			e.moveX(-1)
-			e.remove(y, x, 1)
-		default:
-			chr := gc.KeyString(key)
-			if len(chr) > 1 {
-				continue
-			}
+// Types the key if it is a character, returns false if it isn't
+func (e *Editor) typeKey(key gc.Key, c *CommandContext) bool {
+	chr := gc.KeyString(key)
+	if len(chr) > 1 {
+		return false
+	}
 
-			if e.selected != "" {
-				e.removeSelection()
-			}
+	if !e.checkEditable() {
+		c.resetSelected = false
+		return true
+	}
 
-			e.insert(e.y, e.x, chr)
-			e.moveX(1)
+	if e.selected != "" {
+		if closer, ok := e.getClosingPair(chr); ok {
+			e.wrapSelection(chr, closer)
+			c.resetSelected = false
+			return true
 		}
 
-		if updateLengthIndex {
-			e.inlinePosition = e.accountForTabs(e.x, e.y)
-		}
-		if resetSelected {
-			e.selectedXStart = e.x
-			e.selectedYStart = e.y
-			e.selectedXEnd = e.x
-			e.selectedYEnd = e.y
-		}
+		e.removeSelection()
+	}
 
-		e.y = utils.Min(utils.Max(len(e.lines)-1, 0), e.y)
-		e.draw()
-		e.transactions.submit(beforeY, beforeX)
+	if e.typeOverClosingPair(chr) {
+		return true
+	}
+
+	closer, autoPair := e.shouldAutoPair(chr)
+	e.insert(e.y, e.x, chr)
+	if autoPair {
+		e.insert(e.y, e.x+1, closer)
 	}
+	e.moveX(1)
+	return true
 }
 func (e *Editor) Save(path string) error {
-	e.modified[e.path] = false
-	data := []byte(strings.Join(e.lines, "\n"))
+	if e.readOnly[e.path] && path == e.path {
+		return ErrReadOnly
+	}
+	if e.unnamed[path] {
+		return ErrUnnamed
+	}
+
+	lineEnding := "\n"
+	if e.getFileFormat().lineEnding == "crlf" {
+		lineEnding = "\r\n"
+	}
+	data := []byte(strings.Join(e.lines, lineEnding))
 
 	err := os.MkdirAll(filepath.Dir(path), 0750)
 	if err != nil {
@@ -1492,26 +1634,90 @@ func (e *Editor) Save(path string) error {
 	if err != nil {
 		return err
 	}
+
+	// Only once it is written, a failed save leaves the file unsaved
+	e.modified[e.path] = false
 	return nil
 }
 func main() {
-	if len(os.Args) <= 1 {
-		fmt.Println("missing argument {file}")
+	args := os.Args[1:]
+	viewMode := len(args) > 0 && args[0] == VIEW_MODE_COMMAND
+	if viewMode {
+		args = args[1:]
+	}
+
+	arguments, err := parseArguments(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "gim:", err)
+		os.Exit(2)
+	}
+
+	if arguments.version {
+		fmt.Println("gim", VERSION)
+		return
+	}
+
+	// gim view pages through what is piped to it
+	if viewMode {
+		arguments.readOnly = true
+		if len(arguments.files) == 0 && !isTerminal(os.Stdin) {
+			arguments.files = append(arguments.files, FileArgument{path: "-"})
+		}
+	}
+
+	restoring := arguments.restore || arguments.session != ""
+	if len(arguments.files) == 0 && !restoring {
+		fmt.Fprintln(os.Stderr, "gim: missing argument {file}")
 		os.Exit(1)
 	}
 
-	path := os.Args[1]
-	if len(os.Args) >= 3 && os.Args[2] == "--debug" {
-		DEBUG_MODE = true
+	DEBUG_MODE = arguments.debug
+
+	// Everything that can go wrong with the arguments is told before the screen is taken over
+	for _, file := range arguments.files {
+		if file.path == "-" {
+			continue
+		}
+
+		err = checkFileArgument(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gim:", err)
+			os.Exit(1)
+		}
+	}
+
+	if arguments.config != "" {
+		err = SetEditorConfigPath(arguments.config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gim:", err)
+			os.Exit(1)
+		}
+	}
+
+	err = readStdinArguments(arguments.files)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gim:", err)
+		os.Exit(1)
 	}
 
 	InitHomeFolder()
 
-	err := EnsureGimFolderExists()
+	err = EnsureGimFolderExists()
 	if err != nil {
 		panic(err)
 	}
 
+	var session *Session
+	if restoring {
+		session, err = ReadSession(arguments.session)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gim:", err)
+			os.Exit(1)
+		}
+	}
+
 	homedir := getHomePath()
 	f, err := os.Create(JoinPath(homedir, "logs.txt"))
 	if err != nil {
@@ -1525,12 +1731,22 @@ func main() {
 	e.Init()
 	defer e.End()
 
-	if path != "" {
-		_ = e.Load(path)
+	e.viewMode = viewMode
+	if session != nil {
+		e.restoreSession(session)
 	}
+	e.openFileArguments(arguments)
 
 	err = e.Run()
 	if err != nil {
 		panic(err)
 	}
+
+	// What was open is kept for gim --restore, pages viewed aren't
+	if !e.viewMode {
+		err = e.saveSession("")
+		if err != nil {
+			e.debugLog("failed to save session:", err)
+		}
+	}
 }
@@ -45,6 +45,18 @@ func NewMenuWindow(y, x, h, w int) (*MenuWindow, error) {
 	return mw, nil
 }
 
+func (m *MenuWindow) resize(y, x, h, w int) error {
+	// The derived window is made again as it can't outgrow the window it is in
+	err := m.subWindow.Delete()
+	if err != nil {
+		return err
+	}
+
+	m.stdscr, _ = placeWindow(m.stdscr, h, w, y, x)
+	m.subWindow = m.stdscr.Derived(h-4, w-2, 3, 1)
+	return nil
+}
+
 func (m *MenuWindow) drawBorderAndTitle(title string) {
 	_, x := m.stdscr.MaxYX()
 	m.stdscr.Box(0, 0)
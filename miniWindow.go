@@ -30,6 +30,11 @@ func NewMiniWindow(y, x, h, w int) (*MiniWindow, error) {
 
 }
 
+func (w *MiniWindow) resize(y, x, h, width int) {
+	w.width = width
+	w.stdscr, _ = placeWindow(w.stdscr, h, width, y, x)
+}
+
 func (w *MiniWindow) draw(label string) {
 	w.stdscr.Erase()
 	// w.stdscr.Border(gc.ACS_VLINE, gc.ACS_VLINE, gc.ACS_HLINE, gc.A_INVIS, gc.A_INVIS, gc.A_INVIS, gc.A_INVIS, gc.A_INVIS)
@@ -53,9 +58,12 @@ func (w *MiniWindow) whileRun(clear bool, label string) string {
 
 	w.draw(label)
 	for {
-		ch := w.stdscr.GetChar()
+		ch := getChar(w.stdscr)
 
 		switch ch {
+		case gc.KEY_RESIZE:
+			onScreenResize()
+			w.draw(label)
 		case gc.KEY_ESC:
 			return ""
 		case gc.KEY_ENTER, gc.KEY_RETURN:
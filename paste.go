@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+
+	gc "github.com/rthornton128/goncurses"
+)
+
+const (
+	BRACKETED_PASTE_ON  = "\x1b[?2004h"
+	BRACKETED_PASTE_OFF = "\x1b[?2004l"
+	PASTE_START         = "[200~" // follows the escape key
+	PASTE_END           = "\x1b[201~"
+
+	PASTE_BUFFER_SIZE  = 64 * 1024
+	PASTE_BURST_LENGTH = 16   // keys that arrive at once to be taken as a paste
+	PASTE_TIMEOUT      = 1000 // milliseconds to wait for more of a paste before giving up on its end
+)
+
+// Makes the terminal mark pasted text so it isn't handled as typed keys
+func enableBracketedPaste() {
+	_, err := os.Stdout.WriteString(BRACKETED_PASTE_ON)
+	if err != nil {
+		log.Println("failed to enable bracketed paste:", err)
+	}
+}
+
+func disableBracketedPaste() {
+	_, _ = os.Stdout.WriteString(BRACKETED_PASTE_OFF)
+}
+
+// Checks if the escape key that was just read starts a paste, if it does the pasted text is returned.
+// Otherwise the keys read are put back so they are handled as usual
+func (e *Editor) readPaste() (string, bool) {
+	e.stdscr.Timeout(0)
+	keys := make([]gc.Key, 0, len(PASTE_START))
+	for i := 0; i < len(PASTE_START); i++ {
+		key := readKey(e.stdscr)
+		if key != gc.Key(PASTE_START[i]) {
+			if key != KEY_NONE {
+				keys = append(keys, key)
+			}
+			break
+		}
+		keys = append(keys, key)
+	}
+	e.stdscr.Timeout(-1)
+
+	if len(keys) != len(PASTE_START) {
+		for i := len(keys) - 1; i >= 0; i-- {
+			gc.UnGetChar(gc.Char(keys[i]))
+		}
+		return "", false
+	}
+
+	// A paste that is cut off or never ended stops when no more text arrives for a while
+	var text []byte
+	e.stdscr.Timeout(PASTE_TIMEOUT)
+	gc.NewLines(false) // so \r\n isn't read as two line breaks
+	for {
+		key := readKey(e.stdscr)
+		if key == KEY_NONE {
+			log.Println("paste didn't end, using the text read")
+			break
+		}
+		if key > 255 { // keys ncurses turned into codes aren't text
+			continue
+		}
+
+		text = append(text, byte(key))
+		if bytes.HasSuffix(text, []byte(PASTE_END)) {
+			text = text[:len(text)-len(PASTE_END)]
+			break
+		}
+	}
+	gc.NewLines(true)
+	e.stdscr.Timeout(-1)
+
+	pasted := normalizePaste(string(text))
+
+	// The escape key is already recorded, the paste is replayed as typed keys
+	if macros.recording {
+		macros.recorded = macros.recorded[:len(macros.recorded)-1]
+		for _, chr := range []byte(pasted) {
+			macros.recorded = append(macros.recorded, gc.Key(chr))
+		}
+	}
+	return pasted, true
+}
+
+func normalizePaste(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+// Text keys, pasted text is made of these
+func isPasteKey(key gc.Key) bool {
+	return key >= 32 && key < 256 && key != 127 || key == '\t' || key == '\n' || key == '\r'
+}
+
+// For terminals without bracketed paste, checks if more text arrived together with the key.
+// A person can't type fast enough for many keys to be waiting, so that is taken as a paste
+func (e *Editor) readPasteBurst(first gc.Key) (string, bool) {
+	if !isPasteKey(first) {
+		return "", false
+	}
+
+	keys := []gc.Key{first}
+	e.stdscr.Timeout(0)
+	for {
+		key := readKey(e.stdscr)
+		if key == KEY_NONE {
+			break
+		}
+
+		if !isPasteKey(key) {
+			gc.UnGetChar(gc.Char(key))
+			break
+		}
+		keys = append(keys, key)
+	}
+	e.stdscr.Timeout(-1)
+
+	if len(keys) < PASTE_BURST_LENGTH {
+		for i := len(keys) - 1; i > 0; i-- {
+			gc.UnGetChar(gc.Char(keys[i]))
+		}
+		return "", false
+	}
+
+	text := make([]byte, len(keys))
+	for i, key := range keys {
+		text[i] = byte(key)
+	}
+
+	// The first key is already recorded
+	if macros.recording {
+		macros.recorded = append(macros.recorded, keys[1:]...)
+	}
+	return normalizePaste(string(text)), true
+}
+
+// Inserts pasted text at the cursor as it is, without auto indenting, as one undo step
+func (e *Editor) insertPaste(text string) {
+	if !e.checkEditable() {
+		return
+	}
+
+	beforeY, beforeX := e.y, e.x
+	e.paste(Register{text: text})
+
+	c := newCommandContext(nil)
+	e.finishKey(c, beforeY, beforeX)
+}
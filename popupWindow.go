@@ -27,6 +27,16 @@ func NewPopUpWindow(y, x, h, w int) (*PopUpWindow, error) {
 func (pw *PopUpWindow) pop(message string) {
 	gc.Cursor(0)
 	defer gc.Cursor(1)
+	pw.draw(message)
+
+	// Any key closes it, resizing the terminal only moves it
+	for getChar(pw.stdscr) == gc.KEY_RESIZE {
+		onScreenResize()
+		pw.draw(message)
+	}
+}
+
+func (pw *PopUpWindow) draw(message string) {
 	pw.stdscr.Erase()
 	pw.stdscr.Resize(3, len(message)+2)
 	pw.stdscr.MoveWindow(pw.y, pw.x-len(message)/2)
@@ -37,6 +47,4 @@ func (pw *PopUpWindow) pop(message string) {
 	pw.stdscr.HLine(y, 1, gc.ACS_HLINE, x-2)
 	pw.stdscr.MoveAddChar(y, x-1, gc.ACS_RTEE)
 	pw.stdscr.Refresh()
-
-	pw.stdscr.GetChar()
 }
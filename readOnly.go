@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	gc "github.com/rthornton128/goncurses"
+)
+
+const READ_ONLY_MARKER = "[RO]" // shown before the names of read-only files
+
+// The keys of view mode and the commands they run, like in less
+var viewModeKeys = map[string]string{
+	" ": "page_down",
+	"f": "page_down",
+	"b": "page_up",
+	"j": "down",
+	"k": "up",
+	"g": "file_start",
+	"G": "file_end",
+	"/": "find",
+}
+
+const VIEW_MODE_QUIT_KEY = "q"
+
+// Returns false for files that exist but can't be written to, new files can be
+func isWritable(path string) bool {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	} else if err != nil {
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+// Returns false and tells the user when the current file can't be edited
+func (e *Editor) checkEditable() bool {
+	if !e.readOnly[e.path] {
+		return true
+	}
+
+	e.showMessage(e.openPathsToNames[e.path] + " is read-only")
+	return false
+}
+
+// Returns the name shown for the file in the header, with markers for unsaved and read-only files
+func (e *Editor) getHeaderName(path string) string {
+	name := e.openPathsToNames[path]
+	if e.modified[path] {
+		name = "*" + name
+	}
+	if e.readOnly[path] {
+		name = READ_ONLY_MARKER + name
+	}
+	return name
+}
+
+// Handles the keys of view mode, other keys do what they always do
+func (e *Editor) handleViewKey(key gc.Key) (handled, exit bool) {
+	chr := gc.KeyString(key)
+	if chr == VIEW_MODE_QUIT_KEY {
+		return true, true
+	}
+
+	command, ok := viewModeKeys[chr]
+	if !ok {
+		return false, false
+	}
+
+	c := newCommandContext(nil)
+	beforeY, beforeX := e.y, e.x
+	e.runCommand(command, c)
+	e.finishKey(c, beforeY, beforeX)
+	return true, false
+}
+
+func init() {
+	registerCommand("read_only", "toggle whether the current file can be edited and saved", func(e *Editor, c *CommandContext) {
+		name := e.openPathsToNames[e.path]
+		if e.readOnly[e.path] {
+			delete(e.readOnly, e.path)
+			e.showMessage(name + " can be edited")
+		} else {
+			e.readOnly[e.path] = true
+			e.showMessage(name + " is read-only")
+		}
+
+		e.calculateHeaderOffset()
+		e.drawHeader()
+	})
+}
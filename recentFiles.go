@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const MAX_RECENT_FILES = 200      // files remembered, the ones with the lowest frecency are forgotten first
+const MAX_SHOWN_RECENT_FILES = 10 // shown above the files of the directory when nothing is searched for
+const FRECENCY_WEIGHT = 8.0       // how many characters of path length a doubling of frecency is worth in the search
+
+// RecentFile is a file that has been opened, how often and when it was last opened make up its frecency
+type RecentFile struct {
+	Path   string    `json:"path"` // absolute
+	Visits int       `json:"visits"`
+	Last   time.Time `json:"last"`
+}
+
+// Returns how often the file is opened weighted by how long ago it was last opened
+func (f RecentFile) frecency(now time.Time) float64 {
+	age := now.Sub(f.Last)
+	weight := 0.25
+	switch {
+	case age < time.Hour:
+		weight = 4
+	case age < 24*time.Hour:
+		weight = 2
+	case age < 7*24*time.Hour:
+		weight = 1
+	case age < 30*24*time.Hour:
+		weight = 0.5
+	}
+	return float64(f.Visits) * weight
+}
+
+func getRecentFilesPath() string {
+	return JoinPath(getHomePath(), RECENT_FILES_PATH)
+}
+
+func (w *FileMenuWindow) loadRecent() {
+	if w.recentLoaded {
+		return
+	}
+	w.recentLoaded = true
+
+	data, err := os.ReadFile(getRecentFilesPath())
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, &w.recent)
+	if err != nil {
+		w.recent = nil
+	}
+}
+
+// Counts a visit to the file, files that aren't on the disk aren't remembered
+func (w *FileMenuWindow) addRecent(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	w.loadRecent()
+
+	now := time.Now()
+	found := false
+	for i := range w.recent {
+		if w.recent[i].Path == absolute {
+			w.recent[i].Visits++
+			w.recent[i].Last = now
+			found = true
+			break
+		}
+	}
+	if !found {
+		w.recent = append(w.recent, RecentFile{Path: absolute, Visits: 1, Last: now})
+	}
+
+	sort.SliceStable(w.recent, func(i, j int) bool {
+		return w.recent[i].frecency(now) > w.recent[j].frecency(now)
+	})
+	if len(w.recent) > MAX_RECENT_FILES {
+		w.recent = w.recent[:MAX_RECENT_FILES]
+	}
+	return w.saveRecent()
+}
+
+func (w *FileMenuWindow) saveRecent() error {
+	data, err := json.Marshal(w.recent)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(getRecentFilesPath(), data, 0666)
+}
+
+// Follows a file or directory that was moved to target, the files in it are forgotten when target is empty
+func (w *FileMenuWindow) moveRecent(path, target string) error {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	absoluteTarget := ""
+	if target != "" {
+		absoluteTarget, err = filepath.Abs(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	w.loadRecent()
+
+	recent := make([]RecentFile, 0, len(w.recent))
+	changed := false
+	for _, file := range w.recent {
+		relative, err := filepath.Rel(absolute, file.Path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			recent = append(recent, file)
+			continue
+		}
+
+		changed = true
+		if absoluteTarget != "" {
+			file.Path = filepath.Join(absoluteTarget, relative)
+			recent = append(recent, file)
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	w.recent = recent
+	return w.saveRecent()
+}
+
+// Counts a visit to the file
+func (e *Editor) addRecentFile(path string) {
+	err := e.menuWindow.addRecent(path)
+	if err != nil {
+		e.debugLog("failed to save recent files:", err)
+	}
+}
+
+// Forgets or follows the recent files in path after it was deleted or moved
+func (e *Editor) moveRecentFiles(path, target string) {
+	err := e.menuWindow.moveRecent(path, target)
+	if err != nil {
+		e.debugLog("failed to save recent files:", err)
+	}
+}
+
+// Returns the frecency of the files by their absolute paths
+func (w *FileMenuWindow) getFrecencies() map[string]float64 {
+	w.loadRecent()
+
+	now := time.Now()
+	frecencies := make(map[string]float64, len(w.recent))
+	for _, file := range w.recent {
+		frecencies[file.Path] = file.frecency(now)
+	}
+	return frecencies
+}
+
+// Returns the recent files that still exist with the highest frecency first,
+// relative to the working directory if they are in it
+func (w *FileMenuWindow) getRecentItems() []MenuItem {
+	w.loadRecent()
+	config := GetEditorConfig()
+	wd, _ := os.Getwd()
+
+	now := time.Now()
+	recent := append([]RecentFile{}, w.recent...)
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].frecency(now) > recent[j].frecency(now)
+	})
+
+	items := make([]MenuItem, 0, MAX_SHOWN_RECENT_FILES)
+	for _, file := range recent {
+		if len(items) == MAX_SHOWN_RECENT_FILES {
+			break
+		}
+		if info, err := os.Stat(file.Path); err != nil || info.IsDir() {
+			continue
+		}
+
+		path := file.Path
+		if relative, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(relative, "..") {
+			path = relative
+		}
+		items = append(items, MenuItem{label: path, value: path, color: config.FileColor.Color})
+	}
+	return items
+}
+
+// Puts the recent files above the files of the directory, leaving out the ones the directory shows anyway
+func mergeRecentItems(recent, items []MenuItem) []MenuItem {
+	listed := make(map[string]bool, len(items))
+	for _, item := range items {
+		listed[filepath.Clean(item.value)] = true
+	}
+
+	merged := make([]MenuItem, 0, len(recent)+len(items))
+	for _, item := range recent {
+		if !listed[filepath.Clean(item.value)] {
+			merged = append(merged, item)
+		}
+	}
+	return append(merged, items...)
+}
+
+// Returns how well the path matches, lower is better. Short paths and often opened files rank high
+func getFileScore(path string, frecencies map[string]float64, wd string) float64 {
+	absolute := path
+	if !filepath.IsAbs(path) {
+		absolute = filepath.Join(wd, path)
+	}
+	return float64(len(path)) - FRECENCY_WEIGHT*math.Log2(1+frecencies[absolute])
+}
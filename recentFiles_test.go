@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFrecency(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		visits   int
+		age      time.Duration
+		frecency float64
+	}{
+		{1, time.Minute, 4},
+		{3, time.Minute, 12},
+		{1, 2 * time.Hour, 2},
+		{1, 2 * 24 * time.Hour, 1},
+		{1, 10 * 24 * time.Hour, 0.5},
+		{4, 60 * 24 * time.Hour, 1},
+		{0, time.Minute, 0},
+	}
+
+	for _, test := range tests {
+		file := RecentFile{Visits: test.visits, Last: now.Add(-test.age)}
+		if frecency := file.frecency(now); frecency != test.frecency {
+			t.Errorf("%d visits %v ago: got %v, want %v", test.visits, test.age, frecency, test.frecency)
+		}
+	}
+}
+
+func TestGetFileScore(t *testing.T) {
+	wd := "/work"
+	frecencies := map[string]float64{
+		"/work/often/opened/file.go": 12,
+		"/work/once.go":              1,
+		"/elsewhere/x.go":            4,
+	}
+
+	// Lower scores come first, a doubling of frecency is worth FRECENCY_WEIGHT characters
+	paths := []string{"a.go", "once.go", "never/opened.go", "often/opened/file.go", "/elsewhere/x.go"}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return getFileScore(paths[i], frecencies, wd) < getFileScore(paths[j], frecencies, wd)
+	})
+
+	expected := []string{"often/opened/file.go", "/elsewhere/x.go", "once.go", "a.go", "never/opened.go"}
+	for i := range paths {
+		if paths[i] != expected[i] {
+			t.Fatalf("got %v, want %v", paths, expected)
+		}
+	}
+}
+
+func TestAddRecent(t *testing.T) {
+	useTempHome(t)
+	err := os.MkdirAll(filepath.Join(HOME_PATH, GIM_PATH), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	for _, path := range []string{a, b} {
+		err = os.WriteFile(path, nil, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &FileMenuWindow{}
+	for _, path := range []string{a, b, b, filepath.Join(dir, "missing.go")} {
+		err = w.addRecent(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Read again from the file, missing files aren't remembered
+	w = &FileMenuWindow{}
+	w.loadRecent()
+	if len(w.recent) != 2 || w.recent[0].Path != b || w.recent[0].Visits != 2 || w.recent[1].Path != a || w.recent[1].Visits != 1 {
+		t.Fatalf("got %+v, want b visited twice then a once", w.recent)
+	}
+
+	err = os.Remove(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := w.getRecentItems()
+	if len(items) != 1 || items[0].value != a {
+		t.Errorf("got %+v, want only %s", items, a)
+	}
+}
+
+func TestMoveRecent(t *testing.T) {
+	useTempHome(t)
+	err := os.MkdirAll(filepath.Join(HOME_PATH, GIM_PATH), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	a, b, other := filepath.Join(dir, "a", "a.go"), filepath.Join(dir, "a", "b.go"), filepath.Join(dir, "ab.go")
+	w := &FileMenuWindow{recentLoaded: true}
+	for _, path := range []string{a, b, other} {
+		w.recent = append(w.recent, RecentFile{Path: path, Visits: 1})
+	}
+
+	err = w.moveRecent(filepath.Join(dir, "a"), filepath.Join(dir, "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.moveRecent(filepath.Join(dir, "c", "b.go"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read again from the file
+	w = &FileMenuWindow{}
+	w.loadRecent()
+	paths := make([]string, 0)
+	for _, file := range w.recent {
+		paths = append(paths, file.Path)
+	}
+	expected := []string{filepath.Join(dir, "c", "a.go"), other}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got %v, want %v", paths, expected)
+	}
+}
+
+func TestMergeRecentItems(t *testing.T) {
+	items := []MenuItem{{label: "..", value: ".."}, {label: "sub", value: "sub"}, {label: "main.go", value: "main.go"}}
+	recent := []MenuItem{{label: "main.go", value: "main.go"}, {label: "sub/a.go", value: "sub/a.go"}, {label: "/else/b.go", value: "/else/b.go"}}
+
+	got := make([]string, 0)
+	for _, item := range mergeRecentItems(recent, items) {
+		got = append(got, item.value)
+	}
+	want := []string{"sub/a.go", "/else/b.go", "..", "sub", "main.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
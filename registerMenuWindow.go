@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	"github.com/lithammer/fuzzysearch/fuzzy"
+	gc "github.com/rthornton128/goncurses"
+)
+
+type RegisterMenuWindow struct {
+	menuWindow *MenuWindow
+}
+
+func NewRegisterMenuWindow(y, x, h, w int) (*RegisterMenuWindow, error) {
+	menuWindow, err := NewMenuWindow(y, x, h, w)
+	if err != nil {
+		return nil, err
+	}
+
+	mw := &RegisterMenuWindow{
+		menuWindow: menuWindow,
+	}
+	return mw, nil
+}
+
+// Shows the register on one line
+func getRegisterLabel(register Register) string {
+	label := strings.ReplaceAll(register.text, "\t", " ")
+	label = strings.ReplaceAll(label, "\r", "")
+	label = strings.ReplaceAll(label, "\n", "\\n")
+	if register.linewise {
+		label = "(lines) " + label
+	}
+	return label
+}
+
+func (w *RegisterMenuWindow) getItems(searchString string, history []Register) []MenuItem {
+	config := GetEditorConfig()
+	_, width := w.menuWindow.subWindow.MaxYX()
+	width -= len(w.menuWindow.mark) + 3
+
+	items := make([]MenuItem, 0)
+	for i, register := range history {
+		label := getRegisterLabel(register)
+		if searchString != "" && !fuzzy.MatchFold(searchString, label) {
+			continue
+		}
+
+		// Cut from the end so the start of the text is what is seen
+		if len(label) > width {
+			label = label[:utils.Max(width, 0)]
+		}
+
+		items = append(items, MenuItem{
+			label: label,
+			value: strconv.Itoa(i),
+			color: config.FileColor.Color,
+		})
+	}
+	return items
+}
+
+// Returns the index of the chosen entry of history, -1 if nothing was chosen
+func (w *RegisterMenuWindow) run(history []Register) int {
+	gc.Cursor(0)
+	defer gc.Cursor(1)
+
+	searchString := ""
+	updateItems := true
+	for {
+		if updateItems {
+			w.menuWindow.setItems(w.getItems(searchString, history))
+			updateItems = false
+		}
+
+		title := searchString
+		if title == "" {
+			title = "paste"
+		}
+		w.menuWindow.draw(title)
+
+		ch := getChar(w.menuWindow.stdscr)
+		switch ch {
+		case gc.KEY_RESIZE:
+			onScreenResize()
+		case gc.KEY_ESC:
+			return -1
+		case gc.KEY_DOWN, gc.KEY_UP:
+			w.menuWindow.run(ch)
+		case gc.KEY_ENTER, gc.KEY_RETURN:
+			selected := w.menuWindow.run(ch)
+			if selected == "" {
+				continue
+			}
+
+			index, err := strconv.Atoi(selected)
+			if err != nil {
+				return -1
+			}
+			return index
+		case gc.KEY_BACKSPACE:
+			if searchString == "" {
+				continue
+			}
+
+			searchString = searchString[:len(searchString)-1]
+			updateItems = true
+		default:
+			chr := gc.KeyString(ch)
+			if len(chr) > 1 {
+				continue
+			}
+
+			searchString += chr
+			updateItems = true
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/jonasfreyr/gim/utils"
+)
+
+const UNNAMED_REGISTER = "\""
+const MAX_REGISTER_HISTORY = 50
+
+type Register struct {
+	text     string
+	linewise bool // pasted as whole lines
+}
+
+// Registers holds the named registers and a history of everything copied, cut or deleted into them.
+// The clipboard set in the config backs the + and * registers, when there is none they are kept internally
+type Registers struct {
+	registers map[string]Register
+	history   []Register // the most recent first
+
+	clipboard bool // false when there is no system clipboard or writing to it failed
+}
+
+func NewRegisters() *Registers {
+	return &Registers{
+		registers: make(map[string]Register),
+		history:   make([]Register, 0),
+		clipboard: !clipboard.Unsupported,
+	}
+}
+
+func (r *Registers) writeClipboard(register Register) {
+	text := register.text
+	if register.linewise {
+		text += "\n"
+	}
+
+	switch GetEditorConfig().Clipboard {
+	case CLIPBOARD_INTERNAL:
+		return
+	case CLIPBOARD_OSC52:
+		err := writeOsc52(text)
+		if err != nil {
+			log.Println("failed to write to clipboard through the terminal:", err)
+		}
+		return
+	}
+
+	if !r.clipboard {
+		return
+	}
+
+	err := clipboard.WriteAll(text)
+	if err != nil {
+		log.Println("failed to write to clipboard, using internal registers only:", err)
+		r.clipboard = false
+	}
+}
+
+// Returns the system clipboard as a register, false if it can't be read or has not changed since it was written.
+// The terminal clipboard can't be read so the + register is used with osc52
+func (r *Registers) readClipboard() (Register, bool) {
+	mode := GetEditorConfig().Clipboard
+	if !r.clipboard || mode == CLIPBOARD_OSC52 || mode == CLIPBOARD_INTERNAL {
+		return Register{}, false
+	}
+
+	text, err := clipboard.ReadAll()
+	if err != nil {
+		log.Println("failed to read from clipboard:", err)
+		return Register{}, false
+	}
+
+	register := Register{text: text}
+	if strings.HasSuffix(text, "\n") {
+		register = Register{text: strings.TrimSuffix(text, "\n"), linewise: true}
+	}
+
+	if register == r.registers["+"] {
+		return Register{}, false
+	}
+	return register, true
+}
+
+func (r *Registers) addHistory(register Register) {
+	if register.text == "" {
+		return
+	}
+
+	index := utils.Index(r.history, register)
+	if index != -1 {
+		r.history = append(r.history[:index], r.history[index+1:]...)
+	}
+
+	r.history = append([]Register{register}, r.history...)
+	if len(r.history) > MAX_REGISTER_HISTORY {
+		r.history = r.history[:MAX_REGISTER_HISTORY]
+	}
+}
+
+// Stores the register under name, works like vim: uppercase appends, "_" discards and
+// without a name yanks go to "0, deleted lines shift through "1 to "9 and small deletes go to "-
+func (r *Registers) set(name string, register Register, yank bool) {
+	switch {
+	case name == "_": // The black hole register
+		return
+	case len(name) == 1 && name[0] >= 'A' && name[0] <= 'Z': // Uppercase appends
+		name = strings.ToLower(name)
+		if existing := r.registers[name]; existing.text != "" {
+			if existing.linewise || register.linewise {
+				register = Register{text: existing.text + "\n" + register.text, linewise: true}
+			} else {
+				register.text = existing.text + register.text
+			}
+		}
+		r.registers[name] = register
+	case name == "+" || name == "*":
+		r.writeClipboard(register)
+		r.registers["+"] = register
+	case name != "":
+		r.registers[name] = register
+	case yank:
+		r.registers["0"] = register
+	case register.linewise || strings.Contains(register.text, "\n"):
+		for i := 9; i > 1; i-- {
+			r.registers[strconv.Itoa(i)] = r.registers[strconv.Itoa(i-1)]
+		}
+		r.registers["1"] = register
+	default:
+		r.registers["-"] = register
+	}
+
+	r.registers[UNNAMED_REGISTER] = register
+	r.addHistory(register)
+}
+
+func (r *Registers) get(name string) Register {
+	if name == "" {
+		name = UNNAMED_REGISTER
+	}
+
+	if name == "+" || name == "*" {
+		if register, ok := r.readClipboard(); ok {
+			return register
+		}
+		name = "+"
+	}
+
+	return r.registers[strings.ToLower(name)]
+}
+
+// Makes an entry of the history the one pasted next
+func (r *Registers) useHistory(index int) Register {
+	register := r.history[index]
+	r.registers[UNNAMED_REGISTER] = register
+	r.addHistory(register)
+	return register
+}
+
+// Pastes the register over the selection, whole lines go above the current line
+func (e *Editor) paste(register Register) {
+	if register.text == "" {
+		return
+	}
+
+	transactions := e.transactions
+	transactions.startGroup(e.y, e.x)
+	defer transactions.endGroup()
+
+	if e.selected != "" {
+		e.removeSelection()
+	}
+
+	if register.linewise {
+		lines := strings.Split(register.text, "\n")
+		e.addLines(e.y, lines)
+		e.setCursor(e.y+len(lines), e.x)
+		return
+	}
+
+	y, x := e.insertString(e.y, e.x, register.text)
+	e.setCursor(y, x)
+}
+
+// Puts the selection or the current line into the register, the system clipboard when no register is given
+func (e *Editor) copyToRegister(name string, cut bool) {
+	if name == "" {
+		name = "+"
+	}
+
+	if e.selected == "" {
+		e.registers.set(name, Register{text: e.lines[e.y], linewise: true}, !cut)
+		if cut {
+			e.deleteLines(e.y, 1)
+			e.setCursor(utils.Min(e.y, len(e.lines)-1), e.x)
+		}
+		return
+	}
+
+	e.registers.set(name, Register{text: e.selected}, !cut)
+	if cut {
+		e.removeSelection()
+	}
+}
+
+func init() {
+	registerEditCommand("paste", "paste the clipboard, or the register given", func(e *Editor, c *CommandContext) {
+		name := "+"
+		if len(c.args) > 0 {
+			name = c.args[0]
+		}
+		e.paste(e.registers.get(name))
+	})
+	registerEditCommand("paste_history", "pick something copied, cut or deleted earlier and paste it", func(e *Editor, c *CommandContext) {
+		index := e.registerMenuWindow.run(e.registers.history)
+		if index == -1 {
+			return
+		}
+		e.paste(e.registers.useHistory(index))
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistersSet(t *testing.T) {
+	type set struct {
+		name     string
+		register Register
+		yank     bool
+	}
+
+	tests := []struct {
+		name     string
+		sets     []set
+		expected map[string]Register
+	}{
+		{"named", []set{{"a", Register{text: "x"}, true}},
+			map[string]Register{"a": {text: "x"}, UNNAMED_REGISTER: {text: "x"}}},
+		{"yank", []set{{"", Register{text: "x"}, true}},
+			map[string]Register{"0": {text: "x"}, UNNAMED_REGISTER: {text: "x"}}},
+		{"small delete", []set{{"", Register{text: "x"}, false}},
+			map[string]Register{"-": {text: "x"}, UNNAMED_REGISTER: {text: "x"}}},
+		{"deleted lines shift", []set{
+			{"", Register{text: "a", linewise: true}, false},
+			{"", Register{text: "b\nc"}, false},
+		}, map[string]Register{
+			"1": {text: "b\nc"}, "2": {text: "a", linewise: true}, "3": {}, "4": {}, "5": {}, "6": {}, "7": {}, "8": {}, "9": {},
+			UNNAMED_REGISTER: {text: "b\nc"},
+		}},
+		{"black hole", []set{{"a", Register{text: "x"}, true}, {"_", Register{text: "y"}, false}},
+			map[string]Register{"a": {text: "x"}, UNNAMED_REGISTER: {text: "x"}}},
+		{"uppercase appends", []set{{"a", Register{text: "x"}, true}, {"A", Register{text: "y"}, true}},
+			map[string]Register{"a": {text: "xy"}, UNNAMED_REGISTER: {text: "xy"}}},
+		{"uppercase appends lines", []set{{"a", Register{text: "x"}, true}, {"A", Register{text: "y", linewise: true}, true}},
+			map[string]Register{"a": {text: "x\ny", linewise: true}, UNNAMED_REGISTER: {text: "x\ny", linewise: true}}},
+		{"uppercase to an empty register", []set{{"B", Register{text: "y"}, true}},
+			map[string]Register{"b": {text: "y"}, UNNAMED_REGISTER: {text: "y"}}},
+	}
+
+	for _, test := range tests {
+		r := NewRegisters()
+		for _, s := range test.sets {
+			r.set(s.name, s.register, s.yank)
+		}
+		if !reflect.DeepEqual(r.registers, test.expected) {
+			t.Errorf("%s: got %v, want %v", test.name, r.registers, test.expected)
+		}
+	}
+}
+
+func TestRegistersHistory(t *testing.T) {
+	r := NewRegisters()
+	r.set("", Register{text: "a"}, true)
+	r.set("", Register{text: "b"}, true)
+	r.set("", Register{}, true) // empty text isn't kept
+	r.set("", Register{text: "a"}, true)
+
+	expected := []Register{{text: "a"}, {text: "b"}}
+	if !reflect.DeepEqual(r.history, expected) {
+		t.Errorf("got %v, want %v", r.history, expected)
+	}
+
+	register := r.useHistory(1)
+	if register.text != "b" || r.get("").text != "b" {
+		t.Errorf("using the history: got %v and %v, want b", register, r.get(""))
+	}
+	expected = []Register{{text: "b"}, {text: "a"}}
+	if !reflect.DeepEqual(r.history, expected) {
+		t.Errorf("after using it: got %v, want %v", r.history, expected)
+	}
+
+	for i := 0; i < MAX_REGISTER_HISTORY+5; i++ {
+		r.set("", Register{text: string(rune('a'+i%26)) + string(rune('0'+i/26))}, true)
+	}
+	if len(r.history) != MAX_REGISTER_HISTORY {
+		t.Errorf("history has %d entries, want %d", len(r.history), MAX_REGISTER_HISTORY)
+	}
+}
+
+func TestRegistersGet(t *testing.T) {
+	r := NewRegisters()
+	r.set("a", Register{text: "x"}, true)
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"a", "x"},
+		{"A", "x"},
+		{"", "x"},
+		{UNNAMED_REGISTER, "x"},
+		{"b", ""},
+	}
+
+	for _, test := range tests {
+		if register := r.get(test.name); register.text != test.text {
+			t.Errorf("%q: got %q, want %q", test.name, register.text, test.text)
+		}
+	}
+}
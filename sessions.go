@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+var SESSIONS_PATH = JoinPath(GIM_PATH, "sessions")
+
+var sessionNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Session is what was open when it was saved, the files, how the views were split and the terminal tabs
+type Session struct {
+	Dir       string            `json:"dir"`   // the working directory it was saved in
+	Files     []SessionFile     `json:"files"` // in the order of the tabs
+	Layout    *SessionLayout    `json:"layout"`
+	Focused   int               `json:"focused"` // the view that had focus, counted from the top left
+	Prompts   map[string]string `json:"prompts"` // the last text typed in each prompt, like what was searched for
+	Terminals []SessionTerminal `json:"terminals"`
+	Terminal  bool              `json:"terminal"` // the terminal pane was open
+}
+
+type SessionFile struct {
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	TempFile string `json:"temp_file"` // holds the unsaved changes, empty when there are none
+	ReadOnly bool   `json:"read_only"`
+	SoftWrap bool   `json:"soft_wrap"`
+}
+
+// SessionLayout is a Layout, leaves have a view and the others children
+type SessionLayout struct {
+	Vertical bool             `json:"vertical"`
+	Weight   float64          `json:"weight"`
+	Children []*SessionLayout `json:"children"`
+	View     *SessionView     `json:"view"`
+}
+
+type SessionView struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Col    int    `json:"col"`
+	Scroll int    `json:"scroll"` // the first line shown
+}
+
+type SessionTerminal struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+func getSessionsPath() string {
+	return JoinPath(getHomePath(), SESSIONS_PATH)
+}
+
+// Returns the file of the session, the session of the working directory when name is empty
+func getSessionPath(name string) (string, error) {
+	if name == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		// Escaped so it can't be the same as a named session
+		return JoinPath(getSessionsPath(), url.QueryEscape(wd)+".json"), nil
+	}
+
+	if !sessionNameRegex.MatchString(name) {
+		return "", errors.New("invalid session name " + name + ", use letters, digits, _ and -")
+	}
+	return JoinPath(getSessionsPath(), name+".json"), nil
+}
+
+// Returns the names of the named sessions, the ones saved for working directories are left out
+func getSessionNames() []string {
+	files, err := os.ReadDir(getSessionsPath())
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0)
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		if !file.IsDir() && sessionNameRegex.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ReadSession(name string) (*Session, error) {
+	path, err := getSessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if name == "" {
+			return nil, errors.New("no session saved for this directory")
+		}
+		return nil, errors.New("no session named " + name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	err = json.Unmarshal(data, session)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func WriteSession(name string, session *Session) error {
+	path, err := getSessionPath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(getSessionsPath(), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(session, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func getAbsolutePath(path string) string {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return absolute
+}
+
+// Writes the unsaved changes of every view to their temp files so the session can point to them
+func (e *Editor) saveViewTempFiles() {
+	focused := e.View
+	for _, v := range e.views {
+		e.View = v
+		err := e.saveTempFile()
+		if err != nil {
+			e.debugLog("failed to save temp file:", err)
+		}
+	}
+	e.View = focused
+}
+
+func (e *Editor) getSessionLayout(l *Layout) *SessionLayout {
+	sessionLayout := &SessionLayout{Vertical: l.vertical, Weight: l.weight}
+	if l.view != nil {
+		sessionLayout.View = &SessionView{
+			Path:   getAbsolutePath(l.view.path),
+			Line:   l.view.y,
+			Col:    l.view.x,
+			Scroll: l.view.printLinesIndex,
+		}
+		return sessionLayout
+	}
+
+	for _, child := range l.children {
+		sessionLayout.Children = append(sessionLayout.Children, e.getSessionLayout(child))
+	}
+	return sessionLayout
+}
+
+// Returns what is open now as a session
+func (e *Editor) getSession() *Session {
+	e.saveViewTempFiles()
+
+	// The cursors of files shown in a view are in the view
+	positions := make(map[string]Location)
+	for path, loc := range e.tempFilePos {
+		positions[path] = loc
+	}
+	for _, v := range e.views {
+		positions[v.path] = Location{line: v.y, col: v.x}
+	}
+
+	session := &Session{
+		Layout:   e.getSessionLayout(e.layout),
+		Focused:  utils.Index(e.views, e.View),
+		Prompts:  make(map[string]string),
+		Terminal: e.terminalOpened,
+	}
+	session.Dir, _ = os.Getwd()
+
+	for _, path := range e.openedFiles {
+		// Unnamed files have no path to open them from again
+		if e.unnamed[path] {
+			continue
+		}
+
+		file := SessionFile{
+			Path:     getAbsolutePath(path),
+			Line:     positions[path].line,
+			Col:      positions[path].col,
+			ReadOnly: e.readOnly[path],
+			SoftWrap: e.softWrap[path],
+		}
+		if e.modified[path] {
+			file.TempFile = e.tempFilePaths[path]
+		}
+		session.Files = append(session.Files, file)
+	}
+
+	// Answers to questions aren't worth keeping
+	for label, text := range e.miniWindow.texts {
+		if text != "" && !strings.HasSuffix(label, "(y/n)") {
+			session.Prompts[label] = text
+		}
+	}
+
+	for _, tab := range e.terminalTabs {
+		session.Terminals = append(session.Terminals, SessionTerminal{Name: tab.name, Dir: tab.dir})
+	}
+	return session
+}
+
+// Saves what is open as the session, the one of the working directory when name is empty
+func (e *Editor) saveSession(name string) error {
+	return WriteSession(name, e.getSession())
+}
+
+// Opens the files of the session, and splits the views and opens the terminal tabs like they were
+func (e *Editor) restoreSession(session *Session) {
+	for _, file := range session.Files {
+		path := e.getOpenedPath(file.Path)
+		if _, ok := e.openPathsToNames[path]; ok {
+			// A file that is open already stays as it is
+			continue
+		}
+
+		// Unsaved changes are read from the temp file they were kept in
+		_, tempErr := os.Stat(file.TempFile)
+		if file.TempFile != "" && tempErr == nil {
+			e.tempFilePaths[path] = file.TempFile
+			e.modified[path] = true
+		} else if _, err := os.Stat(path); err != nil {
+			e.debugLog("session file is gone:", path)
+			continue
+		}
+
+		e.tempFilePos[path] = Location{line: file.Line, col: file.Col}
+		err := e.Load(path)
+		if err != nil {
+			e.debugLog(err)
+			continue
+		}
+		e.softWrap[path] = file.SoftWrap
+		if file.ReadOnly {
+			e.readOnly[path] = true
+		}
+	}
+
+	if session.Layout != nil {
+		e.restoreLayout(session)
+	}
+
+	for label, text := range session.Prompts {
+		e.miniWindow.texts[label] = text
+		e.miniWindow.x[label] = len(text)
+	}
+
+	e.restoreTerminals(session)
+	e.calculateHeaderOffset()
+	e.draw()
+}
+
+func (e *Editor) restoreLayoutTree(sessionLayout *SessionLayout, parent *Layout) *Layout {
+	l := &Layout{parent: parent, vertical: sessionLayout.Vertical, weight: sessionLayout.Weight}
+	if sessionLayout.View != nil || len(sessionLayout.Children) == 0 {
+		lexer := *e.lexer
+		view := *e.View
+		view.lexer = &lexer
+		view.stdscr, view.lineNrscr, view.barscr = nil, nil, nil
+		l.view = &view
+		return l
+	}
+
+	for _, child := range sessionLayout.Children {
+		l.children = append(l.children, e.restoreLayoutTree(child, l))
+	}
+	return l
+}
+
+// Replaces the views with the ones of the session, views showing files that aren't open show the current file
+func (e *Editor) restoreLayout(session *Session) {
+	for _, v := range e.views {
+		for _, window := range []*gc.Window{v.stdscr, v.lineNrscr, v.barscr} {
+			if window != nil {
+				_ = window.Delete()
+			}
+		}
+	}
+
+	layout := e.restoreLayoutTree(session.Layout, nil)
+	layout.weight = 1
+	e.layout = layout
+	e.views = layout.getViews()
+	e.layoutViews()
+
+	sessionViews := make([]*SessionView, 0, len(e.views))
+	var collect func(l *SessionLayout)
+	collect = func(l *SessionLayout) {
+		if l.View != nil || len(l.Children) == 0 {
+			sessionViews = append(sessionViews, l.View)
+			return
+		}
+		for _, child := range l.Children {
+			collect(child)
+		}
+	}
+	collect(session.Layout)
+
+	for i, v := range e.views {
+		e.View = v
+		sessionView := sessionViews[i]
+		if sessionView == nil {
+			continue
+		}
+
+		path := e.getOpenedPath(sessionView.Path)
+		if _, ok := e.openPathsToNames[path]; !ok {
+			continue
+		}
+
+		err := e.Load(path)
+		if err != nil {
+			e.debugLog(err)
+			continue
+		}
+
+		e.inlinePosition = 0
+		e.moveToClamped(sessionView.Line, sessionView.Col)
+		e.printLinesIndex = utils.Min(utils.Max(sessionView.Scroll, 0), len(e.lines)-1)
+		e.scrollToCursor()
+	}
+
+	e.focusView(e.views[utils.Min(utils.Max(session.Focused, 0), len(e.views)-1)])
+	e.layoutViews()
+}
+
+// Opens the terminal tabs of the session in place of the ones no shell was started in, their shells start when focused
+func (e *Editor) restoreTerminals(session *Session) {
+	if len(session.Terminals) > 0 {
+		tabs := make([]*TerminalTab, 0, len(e.terminalTabs))
+		for _, tab := range e.terminalTabs {
+			if tab.process != nil {
+				tabs = append(tabs, tab)
+			}
+		}
+		e.terminalTabs = tabs
+
+		for _, sessionTab := range session.Terminals {
+			e.addTerminalTab(sessionTab.Dir)
+			if sessionTab.Name != "" {
+				e.terminalTab.name = sessionTab.Name
+			}
+		}
+		e.terminalTab = e.terminalTabs[0]
+	}
+
+	if session.Terminal && !e.terminalOpened {
+		e.resizeWindows()
+		e.drawTerminal()
+	}
+}
+
+func init() {
+	registerCommand("save_session", "save the open files, views and terminal tabs as a session, the one of the working directory if no name is given", func(e *Editor, c *CommandContext) {
+		name := strings.TrimSpace(e.getCommandInput(c, "save session as"))
+		err := e.saveSession(name)
+		if err != nil {
+			e.debugLog(err)
+			e.showMessage("Failed to save session: " + err.Error())
+			return
+		}
+
+		if name == "" {
+			name = "this directory"
+		}
+		e.showMessage("Saved session of " + name)
+	})
+	registerCommand("load_session", "open the files, views and terminal tabs of a session, the sessions are listed if none is given", func(e *Editor, c *CommandContext) {
+		name := strings.TrimSpace(strings.Join(c.args, " "))
+		if len(c.args) == 0 {
+			names := append([]string{"(this directory)"}, getSessionNames()...)
+			index := e.listMenuWindow.run("load session", names, 0)
+			if index == -1 {
+				return
+			}
+			if index > 0 {
+				name = names[index]
+			}
+		}
+
+		session, err := ReadSession(name)
+		if err != nil {
+			e.showMessage(err.Error())
+			return
+		}
+
+		// The open files the session doesn't have are closed
+		closing := e.getFilesNotInSession(session)
+		for _, path := range closing {
+			if e.modified[path] {
+				str := e.miniWindow.whileRun(true, "unsaved files will be closed, are you sure? (y/n)")
+				if strings.ToLower(str) != "y" {
+					return
+				}
+				break
+			}
+		}
+
+		e.restoreSession(session)
+		for _, path := range closing {
+			// The last file stays open if none of the session could be
+			if len(e.openedFiles) > 1 {
+				e.exitFile(path)
+			}
+		}
+		e.calculateHeaderOffset()
+		e.draw()
+	})
+}
+
+// Returns the open files that aren't in the session
+func (e *Editor) getFilesNotInSession(session *Session) []string {
+	sessionPaths := make([]string, 0, len(session.Files))
+	for _, file := range session.Files {
+		sessionPaths = append(sessionPaths, e.getOpenedPath(file.Path))
+	}
+
+	paths := make([]string, 0)
+	for _, path := range e.openedFiles {
+		if !utils.Contains(sessionPaths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Keeps the sessions in a temporary gim folder for the test
+func useTempHome(t *testing.T) {
+	home := HOME_PATH
+	HOME_PATH = t.TempDir()
+	t.Cleanup(func() { HOME_PATH = home })
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	useTempHome(t)
+
+	session := &Session{
+		Dir: "/work",
+		Files: []SessionFile{
+			{Path: "/work/a.go", Line: 3, Col: 7, ReadOnly: true},
+			{Path: "/work/b.go", TempFile: "/tmp/b.go123", SoftWrap: true},
+		},
+		Layout: &SessionLayout{Vertical: true, Weight: 1, Children: []*SessionLayout{
+			{Weight: 0.3, View: &SessionView{Path: "/work/a.go", Line: 3, Col: 7, Scroll: 1}},
+			{Weight: 0.7, View: &SessionView{Path: "/work/b.go"}},
+		}},
+		Focused:   1,
+		Prompts:   map[string]string{"find": "needle"},
+		Terminals: []SessionTerminal{{Name: "shell", Dir: "/work"}},
+		Terminal:  true,
+	}
+
+	for _, name := range []string{"work", ""} {
+		err := WriteSession(name, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := ReadSession(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(read, session) {
+			t.Errorf("%q: got %+v, want %+v", name, read, session)
+		}
+	}
+}
+
+func TestSessionNames(t *testing.T) {
+	useTempHome(t)
+
+	for _, name := range []string{"b", "a-1", "c_2", ""} {
+		err := WriteSession(name, &Session{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The session of the working directory isn't named
+	expected := []string{"a-1", "b", "c_2"}
+	if names := getSessionNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("got %v, want %v", names, expected)
+	}
+
+	for _, name := range []string{"../x", "a b", "a.json"} {
+		if err := WriteSession(name, &Session{}); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+
+	if _, err := ReadSession("missing"); err == nil {
+		t.Error("reading a missing session: expected an error")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+// Checks whether files of this type are wrapped by default, either from the config or the file extension
+func shouldSoftWrap(path string) bool {
+	config := GetEditorConfig()
+	if config.SoftWrap {
+		return true
+	}
+
+	extension := strings.ReplaceAll(filepath.Ext(path), ".", "")
+	return extension != "" && utils.Contains(config.SoftWrapFileTypes, extension)
+}
+
+func (e *Editor) isSoftWrapped() bool {
+	return e.softWrap[e.path]
+}
+
+func (e *Editor) toggleSoftWrap() {
+	e.softWrap[e.path] = !e.softWrap[e.path]
+	e.printLineStartIndex = 0
+}
+
+func (e *Editor) getWrapWidth() int {
+	return utils.Max(e.maxX-1, 1)
+}
+
+// Returns the visual columns where each row of line y starts when wrapped, the first row always starts at 0
+func (e *Editor) getWrapPoints(y int) []int {
+	config := GetEditorConfig()
+	width := e.getWrapWidth()
+
+	starts := []int{0}
+	rowStart := 0
+	afterSpace := -1
+	col := 0
+	for _, chr := range []byte(e.lines[y]) {
+		w := 1
+		if chr == '\t' {
+			w = config.TabWidth - (col % config.TabWidth)
+		}
+
+		if col+w-rowStart > width {
+			if config.WrapAtWords && afterSpace > rowStart {
+				rowStart = afterSpace
+			} else {
+				rowStart = col
+			}
+			starts = append(starts, rowStart)
+		}
+
+		col += w
+		if chr == ' ' || chr == '\t' {
+			afterSpace = col
+		}
+	}
+	return starts
+}
+
+// Returns which of the rows the visual column col is on
+func getWrapRow(starts []int, col int) int {
+	row := 0
+	for i, start := range starts {
+		if col >= start {
+			row = i
+		}
+	}
+	return row
+}
+
+// Returns where the cursor is on the screen, counting the rows of the wrapped lines above it
+func (e *Editor) getWrappedCursorPosition(col int) (int, int) {
+	if e.y < e.printLinesIndex {
+		return -1, col
+	}
+
+	row := 0
+	for y := e.printLinesIndex; y < e.y; y = e.nextVisibleLine(y) {
+		row += len(e.getWrapPoints(y))
+		if row >= e.maxY {
+			return row, col
+		}
+	}
+
+	starts := e.getWrapPoints(e.y)
+	r := getWrapRow(starts, col)
+	return row + r, col - starts[r]
+}
+
+// Scrolls down until the cursor is on the screen, as wrapped lines can take up more than one row each
+func (e *Editor) scrollToWrappedCursor() {
+	if e.y < e.printLinesIndex {
+		e.printLinesIndex = e.y
+	}
+
+	for e.printLinesIndex < e.y {
+		row, _ := e.getCursorScreenPosition()
+		if row < e.maxY {
+			break
+		}
+		e.printLinesIndex = e.nextVisibleLine(e.printLinesIndex)
+	}
+}
+
+// Moves the cursor up or down by rows on the screen instead of lines
+func (e *Editor) moveVisualRow(delta int) {
+	starts := e.getWrapPoints(e.y)
+	offset := e.inlinePosition - starts[getWrapRow(starts, e.inlinePosition)]
+	row := getWrapRow(starts, e.accountForTabs(e.x, e.y))
+
+	y := e.y
+	row += delta
+	for row < 0 {
+		if e.previousVisibleLine(y) < 0 {
+			row = 0
+			offset = 0
+			break
+		}
+		y = e.previousVisibleLine(y)
+		starts = e.getWrapPoints(y)
+		row += len(starts)
+	}
+	for row >= len(starts) {
+		if e.nextVisibleLine(y) >= len(e.lines) {
+			row = len(starts) - 1
+			offset = e.accountForTabs(len(e.lines[y]), y) - starts[row]
+			break
+		}
+		row -= len(starts)
+		y = e.nextVisibleLine(y)
+		starts = e.getWrapPoints(y)
+	}
+	col := starts[row] + offset
+	rowEnd := e.accountForTabs(len(e.lines[y]), y)
+	if row < len(starts)-1 {
+		rowEnd = starts[row+1] - 1
+	}
+
+	e.y = y
+	e.x = e.findNewX(utils.Min(col, rowEnd), y)
+	e.inlinePosition = col
+
+	if e.y < e.printLinesIndex {
+		e.printLinesIndex = e.y
+	}
+}
+
+// Moves the cursor up or down, by rows on the screen if the file is wrapped
+func (e *Editor) moveCursorY(delta int) {
+	if e.isSoftWrapped() {
+		e.moveVisualRow(delta)
+		return
+	}
+	e.moveY(delta)
+}
+
+func (e *Editor) drawWrappedLineNumbers() {
+	config := GetEditorConfig()
+
+	row := 0
+	y := e.printLinesIndex
+	for row < e.maxY {
+		e.lineNrscr.MovePrint(row, 0, strconv.Itoa(y+1))
+		e.drawFoldMarker(row, y)
+		row++
+
+		if y < len(e.lines) {
+			for i := 1; i < len(e.getWrapPoints(y)) && row < e.maxY; i++ {
+				e.lineNrscr.MovePrint(row, 0, config.WrapIndicator)
+				row++
+			}
+		}
+		y = e.nextVisibleLine(y)
+	}
+}
+
+func (e *Editor) drawWrapped(tokens [][]Token, selectedXStart, selectedXEnd, selectedYStart, selectedYEnd int) {
+	row := 0
+	for y := e.printLinesIndex; y < len(e.lines) && y < len(tokens) && row < e.maxY; y = e.nextVisibleLine(y) {
+		line := tokens[y]
+		starts := e.getWrapPoints(y)
+
+		// The summary goes after the end of the last row
+		lastRow := len(starts) - 1
+		if row+lastRow < e.maxY {
+			e.drawFoldSummary(row+lastRow, e.accountForTabs(len(e.lines[y]), y)-starts[lastRow], y)
+		}
+
+		for _, t := range line {
+			token := t.Token()
+			if token == "\t" { // Tabs are drawn as spaces as they don't line up with the tab stops once wrapped
+				token = strings.Repeat(" ", t.Length())
+			}
+
+			EnableColor(e.stdscr, t.color)
+			for index, chr := range token {
+				col := t.location.col + index
+				r := getWrapRow(starts, col)
+				if row+r >= e.maxY {
+					break
+				}
+
+				highlighted := false
+				if e.isSelected(selectedXStart, selectedXEnd, selectedYStart, selectedYEnd, t.location.line, col) {
+					highlighted = true
+					DisableColor(e.stdscr, t.color)
+					e.stdscr.AttrOn(gc.A_REVERSE)
+				}
+				e.stdscr.MoveAddChar(row+r, col-starts[r], gc.Char(chr))
+
+				if highlighted {
+					EnableColor(e.stdscr, t.color)
+					e.stdscr.AttrOff(gc.A_REVERSE)
+				}
+			}
+			DisableColor(e.stdscr, t.color)
+		}
+
+		row += len(starts)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const STATUS_MESSAGE_DURATION = 3 * time.Second
+const GIT_BRANCH_CACHE_DURATION = 5 * time.Second
+const INDENTATION_SAMPLE_LINES = 1000
+
+// FileFormat is how a file was stored on disk, it is kept when saving
+type FileFormat struct {
+	encoding   string
+	lineEnding string
+}
+
+type gitBranch struct {
+	name    string
+	checked time.Time
+}
+
+// StatusLine is the row at the bottom showing the segments set in the config, or a message for a few seconds
+type StatusLine struct {
+	stdscr *gc.Window
+
+	message     string
+	messageTime time.Time
+
+	branches map[string]gitBranch // directories to the branch they are on
+}
+
+// Segments that can be put in the status line, empty ones are left out
+var statusSegments = map[string]func(e *Editor) string{
+	"mode": func(e *Editor) string {
+		if !e.vim.enabled {
+			return ""
+		}
+		return e.vim.mode
+	},
+	"file": func(e *Editor) string {
+		return e.openPathsToNames[e.path]
+	},
+	"modified": func(e *Editor) string {
+		if e.modified[e.path] {
+			return "[+]"
+		}
+		return ""
+	},
+	"read_only": func(e *Editor) string {
+		if e.readOnly[e.path] {
+			return READ_ONLY_MARKER
+		}
+		return ""
+	},
+	"position": func(e *Editor) string {
+		return strconv.Itoa(e.y+1) + ":" + strconv.Itoa(e.x+1)
+	},
+	"percent": func(e *Editor) string {
+		return strconv.Itoa((e.y+1)*100/utils.Max(len(e.lines), 1)) + "%"
+	},
+	"lines": func(e *Editor) string {
+		return strconv.Itoa(len(e.lines)) + " lines"
+	},
+	"file_type": func(e *Editor) string {
+		extension := strings.TrimPrefix(filepath.Ext(e.path), ".")
+		if extension == "" {
+			return "text"
+		}
+		return extension
+	},
+	"encoding": func(e *Editor) string {
+		return e.getFileFormat().encoding
+	},
+	"line_ending": func(e *Editor) string {
+		return e.getFileFormat().lineEnding
+	},
+	"indentation": func(e *Editor) string {
+		return e.getIndentationStyle()
+	},
+	"git_branch": func(e *Editor) string {
+		return e.statusLine.getGitBranch(filepath.Dir(e.path))
+	},
+}
+
+func NewStatusLine() *StatusLine {
+	return &StatusLine{
+		branches: make(map[string]gitBranch),
+	}
+}
+
+func (s *StatusLine) isShown() bool {
+	config := GetEditorConfig()
+	return len(config.StatusLineLeft) > 0 || len(config.StatusLineRight) > 0
+}
+
+// Shows a message in the status line instead of the segments until it gets old
+func (e *Editor) showMessage(message string) {
+	if !e.statusLine.isShown() {
+		e.popupWindow.pop(message)
+		return
+	}
+
+	e.statusLine.message = message
+	e.statusLine.messageTime = time.Now()
+	if !macros.replaying {
+		e.drawStatusLine()
+	}
+}
+
+func (e *Editor) getFileFormat() FileFormat {
+	if format, ok := e.formats[e.path]; ok {
+		return format
+	}
+	return FileFormat{encoding: "utf-8", lineEnding: "lf"}
+}
+
+func getFileFormat(data []byte) FileFormat {
+	format := FileFormat{encoding: "utf-8", lineEnding: "lf"}
+	if !utf8.Valid(data) {
+		format.encoding = "binary"
+	} else if strings.HasPrefix(string(data[:utils.Min(len(data), 3)]), "\xef\xbb\xbf") {
+		format.encoding = "utf-8 bom"
+	}
+
+	if strings.Contains(string(data), "\r\n") {
+		format.lineEnding = "crlf"
+	}
+	return format
+}
+
+// Guesses from the indented lines if the file is indented with tabs or spaces, and how many spaces
+func (e *Editor) getIndentationStyle() string {
+	tabs, spaces, width := 0, 0, 0
+	for _, line := range e.lines[:utils.Min(len(e.lines), INDENTATION_SAMPLE_LINES)] {
+		indentation := getIndentation(line)
+		switch {
+		case indentation == "":
+			continue
+		case indentation[0] == '\t':
+			tabs++
+		default:
+			spaces++
+			if len(indentation) > 1 && (width == 0 || len(indentation) < width) {
+				width = len(indentation)
+			}
+		}
+	}
+
+	switch {
+	case tabs == 0 && spaces == 0:
+		return ""
+	case tabs >= spaces:
+		return "tabs"
+	case width == 0:
+		return "spaces"
+	}
+	return "spaces: " + strconv.Itoa(width)
+}
+
+// Returns the branch the git repository dir is in is on, read from .git/HEAD now and then
+func (s *StatusLine) getGitBranch(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	if branch, ok := s.branches[dir]; ok && time.Since(branch.checked) < GIT_BRANCH_CACHE_DURATION {
+		return branch.name
+	}
+
+	name := readGitBranch(dir)
+	s.branches[dir] = gitBranch{name: name, checked: time.Now()}
+	return name
+}
+
+func readGitBranch(dir string) string {
+	for {
+		gitPath := JoinPath(dir, ".git")
+		info, err := os.Stat(gitPath)
+		if err == nil {
+			// Worktrees and submodules have a file pointing to the git directory
+			if !info.IsDir() {
+				data, err := os.ReadFile(gitPath)
+				if err != nil {
+					return ""
+				}
+				gitPath = strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(gitPath) {
+					gitPath = JoinPath(dir, gitPath)
+				}
+			}
+
+			head, err := os.ReadFile(JoinPath(gitPath, "HEAD"))
+			if err != nil {
+				return ""
+			}
+
+			ref := strings.TrimSpace(string(head))
+			if strings.HasPrefix(ref, "ref: ") {
+				return strings.TrimPrefix(strings.TrimPrefix(ref, "ref: "), "refs/heads/")
+			}
+			return ref[:utils.Min(len(ref), 7)] // A detached head shows the commit
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func (e *Editor) getStatusSegments(names []string) string {
+	segments := make([]string, 0, len(names))
+	for _, name := range names {
+		segment, ok := statusSegments[name]
+		if !ok {
+			continue
+		}
+
+		if text := segment(e); text != "" {
+			segments = append(segments, text)
+		}
+	}
+	return strings.Join(segments, "  ")
+}
+
+func (e *Editor) drawStatusLine() {
+	s := e.statusLine
+	if s.stdscr == nil {
+		return
+	}
+	config := GetEditorConfig()
+
+	left := e.getStatusSegments(config.StatusLineLeft)
+	if s.message != "" && time.Since(s.messageTime) < STATUS_MESSAGE_DURATION {
+		left = s.message
+	} else {
+		s.message = ""
+	}
+	right := e.getStatusSegments(config.StatusLineRight)
+
+	_, width := s.stdscr.MaxYX()
+	line := " " + left + strings.Repeat(" ", utils.Max(width-len(left)-len(right)-2, 1)) + right + " "
+
+	s.stdscr.Erase()
+	s.stdscr.AttrOn(gc.A_REVERSE)
+	s.stdscr.MovePrint(0, 0, line[:utils.Min(len(line), width)])
+	s.stdscr.AttrOff(gc.A_REVERSE)
+	s.stdscr.Refresh()
+}
+
+func init() {
+	registerCommand("message", "show a message in the status line", func(e *Editor, c *CommandContext) {
+		e.showMessage(e.getCommandInput(c, "message"))
+		c.resetSelected = false
+	})
+}
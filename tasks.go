@@ -0,0 +1,611 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/jonasfreyr/gim/utils"
+)
+
+const TASKS_FILE = "tasks.json"      // in the .gim folder of a project
+const MAX_TASK_OUTPUT_LINES = 10000  // lines of output kept of the last task
+const MAX_TASK_LINE_LENGTH = 1 << 20 // longer lines of output are cut
+
+// Task is a command run for a project, like building or testing it
+type Task struct {
+	Name          string   `json:"name"`
+	Command       string   `json:"command"`        // run with sh
+	Dir           string   `json:"dir"`            // relative to the project, the project itself when empty
+	ErrorPatterns []string `json:"error_patterns"` // names of the patterns errors are found with, all of them when empty
+}
+
+type TasksConfig struct {
+	Tasks []Task `json:"tasks"`
+
+	// Regular expressions with the groups file, line and optionally col and message, they are added to the built-in ones
+	ErrorPatterns map[string]string `json:"error_patterns"`
+}
+
+var defaultErrorPatternNames = []string{"go", "gcc", "python"}
+
+var defaultErrorPatterns = map[string]string{
+	"go":     `^\s*(?P<file>[^\s:]+\.go):(?P<line>\d+)(?::(?P<col>\d+))?: (?P<message>.*)$`,
+	"gcc":    `^(?P<file>[^\s:][^:]*):(?P<line>\d+):(?P<col>\d+): (?P<message>(?:fatal )?(?:error|warning): .*)$`,
+	"python": `^\s*File "(?P<file>[^"]+)", line (?P<line>\d+)(?:, in (?P<message>.*))?$`,
+}
+
+// go test names the package of the tests that ran after their output
+var goTestPackagePattern = regexp.MustCompile(`^(?:ok|FAIL)\s+(\S+)`)
+
+// QuickfixEntry is an error found in the output of a task
+type QuickfixEntry struct {
+	path    string
+	line    int
+	col     int
+	message string
+}
+
+// TaskRunner runs one task at a time in the background and keeps the errors of the last one
+type TaskRunner struct {
+	lock sync.Mutex
+
+	task    Task
+	process *os.Process
+	running bool
+	stopped bool
+	output  []string
+	message string // how the task ended, shown by the main loop as ncurses can only be used from there
+
+	errors  []QuickfixEntry
+	current int // the error last jumped to, -1 before the first
+}
+
+func NewTaskRunner() *TaskRunner {
+	return &TaskRunner{current: -1}
+}
+
+// Finds the tasks file of the project, in the working directory or one of the directories above it
+func findTasksFile() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		path := JoinPath(dir, GIM_PATH, TASKS_FILE)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no " + JoinPath(GIM_PATH, TASKS_FILE) + " found")
+		}
+		dir = parent
+	}
+}
+
+// Reads the tasks of the project, the directory of the project is returned with them
+func ReadTasksConfig() (*TasksConfig, string, error) {
+	path, err := findTasksFile()
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	config := &TasksConfig{}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return config, filepath.Dir(filepath.Dir(path)), nil
+}
+
+func (c *TasksConfig) getTask(name string) (Task, bool) {
+	for _, task := range c.Tasks {
+		if task.Name == name {
+			return task, true
+		}
+	}
+	return Task{}, false
+}
+
+func (c *TasksConfig) getTaskNames() []string {
+	names := make([]string, 0, len(c.Tasks))
+	for _, task := range c.Tasks {
+		names = append(names, task.Name)
+	}
+	return names
+}
+
+// Returns the patterns the output of the task is matched with, patterns of the project replace built-in ones with the same name
+func (e *Editor) getErrorPatterns(task Task, config *TasksConfig) []*regexp.Regexp {
+	names := task.ErrorPatterns
+	if len(names) == 0 {
+		names = append(names, defaultErrorPatternNames...)
+		for name := range config.ErrorPatterns {
+			if _, ok := defaultErrorPatterns[name]; !ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(names))
+	for _, name := range names {
+		pattern, ok := config.ErrorPatterns[name]
+		if !ok {
+			pattern, ok = defaultErrorPatterns[name]
+		}
+		if !ok {
+			e.debugLog("unknown error pattern:", name)
+			continue
+		}
+
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			e.debugLog("invalid error pattern", name+":", err)
+			continue
+		}
+
+		if !utils.Contains(regex.SubexpNames(), "file") || !utils.Contains(regex.SubexpNames(), "line") {
+			e.debugLog("error pattern", name, "needs the groups file and line")
+			continue
+		}
+		patterns = append(patterns, regex)
+	}
+	return patterns
+}
+
+// Finds an error in a line of output, its path is left as the output has it
+func parseError(line string, patterns []*regexp.Regexp) (QuickfixEntry, bool) {
+	for _, pattern := range patterns {
+		match := pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		entry := QuickfixEntry{}
+		for i, name := range pattern.SubexpNames() {
+			switch name {
+			case "file":
+				entry.path = match[i]
+			case "line":
+				entry.line, _ = strconv.Atoi(match[i])
+			case "col":
+				entry.col, _ = strconv.Atoi(match[i])
+			case "message":
+				entry.message = strings.TrimSpace(match[i])
+			}
+		}
+
+		if entry.path == "" || entry.line <= 0 {
+			continue
+		}
+		return entry, true
+	}
+	return QuickfixEntry{}, false
+}
+
+// Returns the path of a file an error is in, relative to dir when it isn't absolute. The file has to exist
+func resolveErrorPath(path, dir string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", false
+	}
+	return path, true
+}
+
+// Returns the directory of a package go test named, from the go.mod of the module dir is in
+func findGoPackageDir(dir, importPath string) (string, bool) {
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) != 2 || fields[0] != "module" {
+					continue
+				}
+
+				module := strings.Trim(fields[1], `"`)
+				if importPath == module {
+					return dir, true
+				}
+				if strings.HasPrefix(importPath, module+"/") {
+					return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(importPath, module+"/"))), true
+				}
+				return "", false
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// errorCollector finds the errors in the output of a task line by line. Errors in files that don't exist are left out
+type errorCollector struct {
+	patterns []*regexp.Regexp
+	dir      string
+	pending  []QuickfixEntry // errors of failing tests, go test prints them relative to the package it names after them
+}
+
+// Returns the errors found with the line, the ones held back for their package come with the line naming it
+func (c *errorCollector) add(line string) []QuickfixEntry {
+	if match := goTestPackagePattern.FindStringSubmatch(line); match != nil {
+		entries := make([]QuickfixEntry, 0, len(c.pending))
+		if dir, ok := findGoPackageDir(c.dir, match[1]); ok {
+			for _, entry := range c.pending {
+				if path, ok := resolveErrorPath(entry.path, dir); ok {
+					entry.path = path
+					entries = append(entries, entry)
+				}
+			}
+		}
+		c.pending = nil
+		return entries
+	}
+
+	entry, ok := parseError(line, c.patterns)
+	if !ok {
+		return nil
+	}
+
+	// go test indents the output of tests and gives only the name of the file
+	if strings.TrimLeft(line, " \t") != line && filepath.Base(entry.path) == entry.path {
+		c.pending = append(c.pending, entry)
+		return nil
+	}
+
+	if path, ok := resolveErrorPath(entry.path, c.dir); ok {
+		entry.path = path
+		return []QuickfixEntry{entry}
+	}
+	return nil
+}
+
+// Returns the errors still held back when the output ends. They are looked for in dir, then in the directories below it
+// where it has to be the only file with the name
+func (c *errorCollector) finish() []QuickfixEntry {
+	entries := make([]QuickfixEntry, 0, len(c.pending))
+	var found map[string][]string // file names to the paths of the files with them
+	for _, entry := range c.pending {
+		if path, ok := resolveErrorPath(entry.path, c.dir); ok {
+			entry.path = path
+			entries = append(entries, entry)
+			continue
+		}
+
+		if found == nil {
+			found = findFiles(c.dir)
+		}
+		if paths := found[entry.path]; len(paths) == 1 {
+			entry.path = paths[0]
+			entries = append(entries, entry)
+		}
+	}
+	c.pending = nil
+	return entries
+}
+
+// Returns the files below dir by their names, hidden directories are left out
+func findFiles(dir string) map[string][]string {
+	files := make(map[string][]string)
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files[d.Name()] = append(files[d.Name()], path)
+		return nil
+	})
+	return files
+}
+
+// Kills the task running with everything it started, its errors are kept
+func (r *TaskRunner) stop() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.running {
+		return nil
+	}
+	r.stopped = true
+	return syscall.Kill(-r.process.Pid, syscall.SIGKILL)
+}
+
+// Runs the task in the background, one already running is stopped
+func (e *Editor) runTask(name string) error {
+	config, projectDir, err := ReadTasksConfig()
+	if err != nil {
+		return err
+	}
+
+	task, ok := config.getTask(name)
+	if !ok {
+		return errors.New("no task named " + name)
+	}
+
+	dir := projectDir
+	if task.Dir != "" {
+		dir = task.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(projectDir, dir)
+		}
+	}
+
+	err = e.tasks.stop()
+	if err != nil {
+		e.debugLog("failed to stop task:", err)
+	}
+
+	cmd := exec.Command("sh", "-c", task.Command)
+	cmd.Dir = dir
+	// In its own process group so stopping it also stops the commands sh runs, they keep the output open otherwise
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	r := e.tasks
+	r.lock.Lock()
+	r.task, r.process, r.running, r.stopped = task, cmd.Process, true, false
+	r.output, r.errors, r.current, r.message = nil, nil, -1, ""
+	r.lock.Unlock()
+
+	go e.captureTaskOutput(cmd, output, &errorCollector{patterns: e.getErrorPatterns(task, config), dir: dir})
+
+	e.showMessage("Running " + task.Name)
+	return nil
+}
+
+// Reads the output of the task until it exits and finds the errors in it
+func (e *Editor) captureTaskOutput(cmd *exec.Cmd, output io.Reader, collector *errorCollector) {
+	r := e.tasks
+
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_TASK_LINE_LENGTH)
+	for scanner.Scan() {
+		line := scanner.Text()
+		entries := collector.add(line)
+
+		r.lock.Lock()
+		// The output of a task that was replaced is read to the end but not kept
+		if r.process == cmd.Process {
+			if len(r.output) < MAX_TASK_OUTPUT_LINES {
+				r.output = append(r.output, line)
+			}
+			r.errors = append(r.errors, entries...)
+		}
+		r.lock.Unlock()
+	}
+
+	err := cmd.Wait()
+	entries := collector.finish()
+
+	r.lock.Lock()
+	if r.process != cmd.Process {
+		r.lock.Unlock()
+		return
+	}
+	r.errors = append(r.errors, entries...)
+	r.running = false
+	message := r.task.Name + " finished"
+	if r.stopped {
+		message = r.task.Name + " stopped"
+	} else if err != nil {
+		message = r.task.Name + " failed: " + err.Error()
+	}
+	if len(r.errors) > 0 {
+		message += ", " + strconv.Itoa(len(r.errors)) + " errors"
+	}
+	r.message = message
+	r.lock.Unlock()
+}
+
+// Shows how the last task ended if that hasn't been shown yet
+func (e *Editor) showTaskMessage() {
+	r := e.tasks
+	r.lock.Lock()
+	message := r.message
+	r.message = ""
+	r.lock.Unlock()
+
+	if message != "" {
+		e.debugLog(message)
+		e.showMessage(message)
+	}
+}
+
+// Returns the path the file is open with, so an error in an open file doesn't open it again
+func (e *Editor) getOpenedPath(path string) string {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	for _, opened := range e.openedFiles {
+		if openedAbsolute, err := filepath.Abs(opened); err == nil && openedAbsolute == absolute {
+			return opened
+		}
+	}
+
+	// Paths below the working directory are shown like files opened from it
+	if wd, err := os.Getwd(); err == nil {
+		if relative, err := filepath.Rel(wd, absolute); err == nil && !strings.HasPrefix(relative, "..") {
+			return relative
+		}
+	}
+	return absolute
+}
+
+func (e *Editor) jumpToError(entry QuickfixEntry) {
+	path := e.getOpenedPath(entry.path)
+	if path != e.path {
+		err := e.Load(path)
+		if err != nil {
+			e.debugLog(err)
+			e.showMessage("Failed to open " + path)
+			return
+		}
+	}
+
+	e.inlinePosition = 0
+	e.moveYto(utils.Min(entry.line, len(e.lines)) - 1)
+	e.moveXto(utils.Min(utils.Max(entry.col-1, 0), len(e.lines[e.y])))
+	if entry.message != "" {
+		e.showMessage(entry.message)
+	}
+}
+
+// Jumps to the error delta after the one last jumped to
+func (e *Editor) jumpToNextError(delta int) {
+	r := e.tasks
+	r.lock.Lock()
+	if len(r.errors) == 0 {
+		r.lock.Unlock()
+		e.showMessage("No errors")
+		return
+	}
+
+	index := r.current + delta
+	if r.current == -1 && delta < 0 {
+		index = len(r.errors) - 1
+	}
+	if index < 0 || index >= len(r.errors) {
+		r.lock.Unlock()
+		e.showMessage("No more errors")
+		return
+	}
+	r.current = index
+	entry := r.errors[index]
+	r.lock.Unlock()
+
+	e.jumpToError(entry)
+}
+
+func (e *Editor) getQuickfixLabel(entry QuickfixEntry) string {
+	label := e.getOpenedPath(entry.path) + ":" + strconv.Itoa(entry.line)
+	if entry.col > 0 {
+		label += ":" + strconv.Itoa(entry.col)
+	}
+	if entry.message != "" {
+		label += " " + entry.message
+	}
+	return strings.ReplaceAll(label, "\t", " ")
+}
+
+func init() {
+	registerCommand("run_task", "run a task of the project in .gim/tasks.json, the tasks are listed if none is given", func(e *Editor, c *CommandContext) {
+		name := strings.TrimSpace(strings.Join(c.args, " "))
+		if name == "" {
+			config, _, err := ReadTasksConfig()
+			if err != nil {
+				e.showMessage(err.Error())
+				return
+			}
+
+			names := config.getTaskNames()
+			index := e.listMenuWindow.run("run task", names, 0)
+			if index == -1 {
+				return
+			}
+			name = names[index]
+		}
+
+		err := e.runTask(name)
+		if err != nil {
+			e.showMessage(err.Error())
+		}
+	})
+	registerCommand("rerun_task", "run the last task again", func(e *Editor, c *CommandContext) {
+		e.tasks.lock.Lock()
+		name := e.tasks.task.Name
+		e.tasks.lock.Unlock()
+
+		if name == "" {
+			e.showMessage("No task has been run")
+			return
+		}
+
+		err := e.runTask(name)
+		if err != nil {
+			e.showMessage(err.Error())
+		}
+	})
+	registerCommand("stop_task", "stop the task running", func(e *Editor, c *CommandContext) {
+		err := e.tasks.stop()
+		if err != nil {
+			e.debugLog("failed to stop task:", err)
+		}
+	})
+	registerCommand("quickfix", "list the errors of the last task and jump to the one chosen", func(e *Editor, c *CommandContext) {
+		r := e.tasks
+		r.lock.Lock()
+		entries := append([]QuickfixEntry{}, r.errors...)
+		current := r.current
+		title := r.task.Name + " errors"
+		if r.running {
+			title = r.task.Name + " errors (running)"
+		}
+		r.lock.Unlock()
+
+		if len(entries) == 0 {
+			e.showMessage("No errors")
+			return
+		}
+
+		labels := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			labels = append(labels, e.getQuickfixLabel(entry))
+		}
+
+		index := e.listMenuWindow.run(title, labels, current)
+		if index == -1 {
+			return
+		}
+
+		r.lock.Lock()
+		r.current = index
+		r.lock.Unlock()
+		e.jumpToError(entries[index])
+	})
+	registerCommand("next_error", "jump to the next error of the last task", func(e *Editor, c *CommandContext) {
+		e.jumpToNextError(1)
+	})
+	registerCommand("previous_error", "jump to the previous error of the last task", func(e *Editor, c *CommandContext) {
+		e.jumpToNextError(-1)
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	patterns := (&Editor{}).getErrorPatterns(Task{}, &TasksConfig{})
+
+	tests := []struct {
+		name  string
+		line  string
+		entry QuickfixEntry
+		ok    bool
+	}{
+		{"go", "main.go:4:2: declared and not used: x", QuickfixEntry{"main.go", 4, 2, "declared and not used: x"}, true},
+		{"go in a package", "./sub/a.go:4:2: bad", QuickfixEntry{"./sub/a.go", 4, 2, "bad"}, true},
+		{"go without column", "main.go:12: missing return", QuickfixEntry{"main.go", 12, 0, "missing return"}, true},
+		{"go test indented", "    main_test.go:7: got 1, want 2", QuickfixEntry{"main_test.go", 7, 0, "got 1, want 2"}, true},
+		{"gcc", "src/b.c:3:9: error: expected ';'", QuickfixEntry{"src/b.c", 3, 9, "error: expected ';'"}, true},
+		{"gcc note is left out", "src/b.c:3:9: note: declared here", QuickfixEntry{}, false},
+		{"python", `  File "/app/app.py", line 8, in main`, QuickfixEntry{"/app/app.py", 8, 0, "main"}, true},
+		{"python without function", `  File "app.py", line 8`, QuickfixEntry{"app.py", 8, 0, ""}, true},
+		{"line 0", "main.go:0: bad", QuickfixEntry{}, false},
+		{"go test package", "ok  \texample.com/pkg\t0.01s", QuickfixEntry{}, false},
+		{"text", "building main.go", QuickfixEntry{}, false},
+	}
+
+	for _, test := range tests {
+		entry, ok := parseError(test.line, patterns)
+		if ok != test.ok || entry != test.entry {
+			t.Errorf("%s: got %+v %v, want %+v %v", test.name, entry, ok, test.entry, test.ok)
+		}
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(text), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestErrorCollector(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":                "module example.com/m\n\ngo 1.18\n",
+		"main.go":               "",
+		"main_test.go":          "",
+		"sub/sub_test.go":       "",
+		"sub/deeper/x_test.go":  "",
+		"other/main_test.go":    "",
+		"src/b.c":               "",
+		".hidden/only_test.go":  "",
+		"twice/a/same_test.go":  "",
+		"twice/b/same_test.go":  "",
+		"pkg.go/placeholder.go": "",
+	})
+	patterns := (&Editor{}).getErrorPatterns(Task{}, &TasksConfig{})
+	join := func(name string) string {
+		return filepath.Join(dir, filepath.FromSlash(name))
+	}
+
+	tests := []struct {
+		name    string
+		lines   []string
+		entries []QuickfixEntry
+	}{
+		{"relative to the task", []string{"main.go:4:2: bad", "src/b.c:3:9: error: x"},
+			[]QuickfixEntry{{join("main.go"), 4, 2, "bad"}, {join("src/b.c"), 3, 9, "error: x"}}},
+		{"absolute", []string{join("main.go") + ":1:1: bad"}, []QuickfixEntry{{join("main.go"), 1, 1, "bad"}}},
+		{"missing file", []string{"gone.go:1:1: bad"}, []QuickfixEntry{}},
+		{"directory", []string{"pkg.go:1:1: bad"}, []QuickfixEntry{}},
+		{"failing test in a package", []string{"--- FAIL: TestX (0.00s)", "    sub_test.go:7: got 1", "FAIL", "FAIL\texample.com/m/sub\t0.01s"},
+			[]QuickfixEntry{{join("sub/sub_test.go"), 7, 0, "got 1"}}},
+		{"same name in two packages", []string{"    main_test.go:3: a", "FAIL\texample.com/m/other\t0.01s", "    main_test.go:5: b", "FAIL\texample.com/m\t0.01s"},
+			[]QuickfixEntry{{join("other/main_test.go"), 3, 0, "a"}, {join("main_test.go"), 5, 0, "b"}}},
+		{"package of another module", []string{"    sub_test.go:7: got 1", "FAIL\texample.com/other\t0.01s"}, []QuickfixEntry{}},
+		{"no package named, searched for", []string{"    x_test.go:2: bad"}, []QuickfixEntry{{join("sub/deeper/x_test.go"), 2, 0, "bad"}}},
+		{"no package named, in the task directory", []string{"    main_test.go:2: bad"}, []QuickfixEntry{{join("main_test.go"), 2, 0, "bad"}}},
+		{"no package named, more than one file", []string{"    same_test.go:2: bad"}, []QuickfixEntry{}},
+		{"no package named, hidden", []string{"    only_test.go:2: bad"}, []QuickfixEntry{}},
+	}
+
+	for _, test := range tests {
+		collector := &errorCollector{patterns: patterns, dir: dir}
+		entries := make([]QuickfixEntry, 0)
+		for _, line := range test.lines {
+			entries = append(entries, collector.add(line)...)
+		}
+		entries = append(entries, collector.finish()...)
+
+		if !reflect.DeepEqual(entries, test.entries) {
+			t.Errorf("%s: got %+v, want %+v", test.name, entries, test.entries)
+		}
+	}
+}
+
+func TestGetErrorPatterns(t *testing.T) {
+	config := &TasksConfig{ErrorPatterns: map[string]string{
+		"lint":    `^(?P<file>\S+) (?P<line>\d+)$`,
+		"go":      `^GO (?P<file>\S+) (?P<line>\d+)$`, // replaces the built-in one
+		"invalid": `(`,
+		"no_line": `^(?P<file>\S+)$`,
+	}}
+
+	tests := []struct {
+		name     string
+		task     Task
+		patterns []string
+	}{
+		{"named", Task{ErrorPatterns: []string{"lint", "gcc"}}, []string{config.ErrorPatterns["lint"], defaultErrorPatterns["gcc"]}},
+		{"replaced", Task{ErrorPatterns: []string{"go"}}, []string{config.ErrorPatterns["go"]}},
+		{"unknown, invalid or without a line", Task{ErrorPatterns: []string{"nope", "invalid", "no_line"}}, []string{}},
+	}
+
+	for _, test := range tests {
+		patterns := (&Editor{}).getErrorPatterns(test.task, config)
+		got := make([]string, 0, len(patterns))
+		for _, pattern := range patterns {
+			got = append(got, pattern.String())
+		}
+		if len(got) != len(test.patterns) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.patterns)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.patterns[i] {
+				t.Errorf("%s: got %q, want %q", test.name, got, test.patterns)
+			}
+		}
+	}
+
+	// Without names every pattern is used, the built-in ones first
+	patterns := (&Editor{}).getErrorPatterns(Task{}, config)
+	if len(patterns) != 4 || patterns[0].String() != config.ErrorPatterns["go"] {
+		t.Errorf("all patterns: got %v", patterns)
+	}
+}
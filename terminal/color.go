@@ -0,0 +1,42 @@
+package terminal
+
+// The steps of each of red, green and blue in the 6x6x6 color cube of the palette
+var cubeSteps = [6]int{0, 95, 135, 175, 215, 255}
+
+// RGB returns the color of the palette closest to the true color, from the color cube or the grays
+func RGB(r, g, b int) Color {
+	r, g, b = clamp(r, 0, 255), clamp(g, 0, 255), clamp(b, 0, 255)
+
+	cube := 16 + 36*nearestCubeStep(r) + 6*nearestCubeStep(g) + nearestCubeStep(b)
+	cubeR, cubeG, cubeB := cubeSteps[nearestCubeStep(r)], cubeSteps[nearestCubeStep(g)], cubeSteps[nearestCubeStep(b)]
+
+	// The 24 grays go from 8 to 238 in steps of 10
+	gray := clamp(((r+g+b)/3-8+5)/10, 0, 23)
+	grayLevel := 8 + gray*10
+
+	if distance(r, g, b, grayLevel, grayLevel, grayLevel) < distance(r, g, b, cubeR, cubeG, cubeB) {
+		return Color(232 + gray)
+	}
+	return Color(cube)
+}
+
+func nearestCubeStep(value int) int {
+	nearest := 0
+	for i, step := range cubeSteps {
+		if abs(value-step) < abs(value-cubeSteps[nearest]) {
+			nearest = i
+		}
+	}
+	return nearest
+}
+
+func distance(r1, g1, b1, r2, g2, b2 int) int {
+	return (r1-r2)*(r1-r2) + (g1-g2)*(g1-g2) + (b1-b2)*(b1-b2)
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
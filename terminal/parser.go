@@ -0,0 +1,437 @@
+package terminal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+)
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateCharset    // after ESC ( and the like, the next byte picks the character set
+	stateCsi        // after ESC [
+	stateOsc        // after ESC ], a string ended by BEL or ESC \
+	stateOscEscape  // an ESC in an osc string, it ends the string
+	stateString     // device control and other strings that are ignored
+	stateStringDone // an ESC in an ignored string
+)
+
+const MAX_PARAMS = 32
+
+// parser keeps what has been read of an escape code, it can be split between writes
+type parser struct {
+	state parserState
+
+	params       []int
+	param        int
+	hasParam     bool
+	private      byte // ?, >, < or = at the start of a csi
+	intermediate byte
+	osc          []byte
+
+	pending []byte // the start of a utf-8 character cut off by the end of a write
+}
+
+func (t *Terminal) handle(b byte) {
+	p := &t.parser
+	switch p.state {
+	case stateGround:
+		if b < 0x20 {
+			t.control(b)
+		} else if b != 0x7f {
+			t.put(rune(b))
+		}
+	case stateEscape:
+		t.escape(b)
+	case stateCharset:
+		if p.intermediate == '#' {
+			if b == '8' {
+				t.alignmentTest()
+			}
+		} else if p.intermediate == '(' {
+			t.cursor.charsets[0] = b == '0'
+		} else if p.intermediate == ')' {
+			t.cursor.charsets[1] = b == '0'
+		}
+		p.state = stateGround
+	case stateCsi:
+		t.collectCsi(b)
+	case stateOsc:
+		switch b {
+		case 0x07:
+			t.runOsc()
+			p.state = stateGround
+		case 0x1b:
+			p.state = stateOscEscape
+		default:
+			if len(p.osc) < MAX_TITLE_LENGTH {
+				p.osc = append(p.osc, b)
+			}
+		}
+	case stateOscEscape:
+		t.runOsc()
+		p.state = stateGround
+		if b != '\\' {
+			p.state = stateEscape
+			t.escape(b)
+		}
+	case stateString:
+		if b == 0x1b {
+			p.state = stateStringDone
+		}
+	case stateStringDone:
+		p.state = stateString
+		if b == '\\' {
+			p.state = stateGround
+		}
+	}
+}
+
+// Runs the c0 control characters
+func (t *Terminal) control(b byte) {
+	switch b {
+	case '\b':
+		t.moveHorizontally(-1)
+	case '\t':
+		t.tab(1)
+	case '\n', '\v', '\f':
+		t.lineFeed()
+	case '\r':
+		t.cursor.x = 0
+		t.wrapNext = false
+	case 0x0e: // Shift out
+		t.cursor.charset = 1
+	case 0x0f: // Shift in
+		t.cursor.charset = 0
+	case 0x18, 0x1a: // Cancel
+		t.parser.state = stateGround
+	case 0x1b:
+		t.parser.state = stateEscape
+	}
+}
+
+func (t *Terminal) escape(b byte) {
+	p := &t.parser
+	p.state = stateGround
+
+	switch b {
+	case '[':
+		p.state = stateCsi
+		p.params = p.params[:0]
+		p.param, p.hasParam = 0, false
+		p.private, p.intermediate = 0, 0
+	case ']':
+		p.state = stateOsc
+		p.osc = p.osc[:0]
+	case 'P', 'X', '^', '_':
+		p.state = stateString
+	case '(', ')', '*', '+', '#':
+		p.state = stateCharset
+		p.intermediate = b
+	case '7':
+		t.saveCursor()
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.lineFeed()
+	case 'E':
+		t.cursor.x = 0
+		t.lineFeed()
+	case 'M':
+		t.reverseIndex()
+	case 'H':
+		t.tabStops[t.cursor.x] = true
+	case 'c':
+		t.reset(t.width, t.height)
+	default:
+		if b < 0x20 {
+			t.control(b)
+		}
+	}
+}
+
+func (t *Terminal) collectCsi(b byte) {
+	p := &t.parser
+	switch {
+	case b >= '0' && b <= '9':
+		p.param = utils.Min(p.param*10+int(b-'0'), 99999)
+		p.hasParam = true
+	case b == ';' || b == ':':
+		p.pushParam()
+	case b >= '<' && b <= '?':
+		p.private = b
+	case b >= 0x20 && b <= 0x2f:
+		p.intermediate = b
+	case b >= 0x40 && b <= 0x7e:
+		if p.hasParam || len(p.params) > 0 {
+			p.pushParam()
+		}
+		p.state = stateGround
+		t.runCsi(b)
+	case b < 0x20:
+		t.control(b)
+	}
+}
+
+func (p *parser) pushParam() {
+	if len(p.params) < MAX_PARAMS {
+		p.params = append(p.params, p.param)
+	}
+	p.param, p.hasParam = 0, false
+}
+
+// Returns parameter i, or fallback when it is not given or 0
+func (p *parser) get(i, fallback int) int {
+	if i >= len(p.params) || p.params[i] == 0 {
+		return fallback
+	}
+	return p.params[i]
+}
+
+func (t *Terminal) runCsi(final byte) {
+	p := &t.parser
+	n := p.get(0, 1)
+
+	if p.private == '?' {
+		if final == 'h' || final == 'l' {
+			for _, mode := range p.params {
+				t.setPrivateMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+
+	if p.private == '>' {
+		if final == 'c' {
+			t.reply("\x1b[>0;10;1c")
+		}
+		return
+	}
+
+	if p.intermediate != 0 {
+		if p.intermediate == '!' && final == 'p' { // Soft reset
+			t.autoWrap, t.insertMode, t.cursorVisible = true, false, true
+			t.cursor.originMode = false
+			t.cursor.pen = blankCell
+			t.top, t.bottom = 0, t.height-1
+		}
+		return
+	}
+
+	switch final {
+	case '@':
+		t.insertCells(n)
+	case 'A':
+		t.moveVertically(-n)
+	case 'B', 'e':
+		t.moveVertically(n)
+	case 'C', 'a':
+		t.moveHorizontally(n)
+	case 'D':
+		t.moveHorizontally(-n)
+	case 'E':
+		t.moveVertically(n)
+		t.cursor.x = 0
+	case 'F':
+		t.moveVertically(-n)
+		t.cursor.x = 0
+	case 'G', '`':
+		t.wrapNext = false
+		t.cursor.x = clamp(n-1, 0, t.width-1)
+	case 'H', 'f':
+		t.moveTo(p.get(1, 1)-1, n-1)
+	case 'I':
+		t.tab(n)
+	case 'J':
+		t.eraseDisplay(p.get(0, 0))
+	case 'K':
+		t.eraseLine(p.get(0, 0))
+	case 'L':
+		t.insertLines(n)
+	case 'M':
+		t.deleteLines(n)
+	case 'P':
+		t.deleteCells(n)
+	case 'S':
+		t.scrollRegionUp(n)
+	case 'T':
+		t.scrollDown(t.top, n)
+	case 'X':
+		t.eraseCharacters(n)
+	case 'Z':
+		t.backTab(n)
+	case 'b':
+		for i := 0; i < utils.Min(n, t.width*t.height); i++ {
+			t.put(t.lastChar)
+		}
+	case 'c':
+		t.reply("\x1b[?1;2c")
+	case 'd':
+		t.moveTo(t.cursor.x, n-1)
+	case 'g':
+		switch p.get(0, 0) {
+		case 0:
+			t.tabStops[t.cursor.x] = false
+		case 3:
+			for x := range t.tabStops {
+				t.tabStops[x] = false
+			}
+		}
+	case 'h', 'l':
+		for _, mode := range p.params {
+			if mode == 4 {
+				t.insertMode = final == 'h'
+			}
+		}
+	case 'm':
+		t.setGraphics()
+	case 'n':
+		switch p.get(0, 0) {
+		case 5:
+			t.reply("\x1b[0n")
+		case 6:
+			y := t.cursor.y
+			if t.cursor.originMode {
+				y -= t.top
+			}
+			t.reply(fmt.Sprintf("\x1b[%d;%dR", y+1, t.cursor.x+1))
+		}
+	case 'r':
+		t.setScrollRegion(p.get(0, 1), p.get(1, t.height))
+	case 's':
+		t.saveCursor()
+	case 'u':
+		t.restoreCursor()
+	}
+}
+
+func (t *Terminal) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 1:
+		t.applicationCursorKeys = on
+	case 6:
+		t.cursor.originMode = on
+		t.moveTo(0, 0)
+	case 7:
+		t.autoWrap = on
+	case 25:
+		t.cursorVisible = on
+	case 47, 1047:
+		t.useAlternateScreen(on, mode == 1047)
+	case 1048:
+		if on {
+			t.saveCursor()
+		} else {
+			t.restoreCursor()
+		}
+	case 1049:
+		if on {
+			t.saveCursor()
+			t.useAlternateScreen(true, true)
+		} else {
+			t.useAlternateScreen(false, false)
+			t.restoreCursor()
+		}
+	case 2004:
+		t.bracketedPaste = on
+	}
+}
+
+// Sets the colors and attributes of the text written after it
+func (t *Terminal) setGraphics() {
+	params := t.parser.params
+	if len(params) == 0 {
+		params = []int{0}
+	}
+
+	pen := &t.cursor.pen
+	for i := 0; i < len(params); i++ {
+		switch param := params[i]; {
+		case param == 0:
+			*pen = blankCell
+		case param == 1:
+			pen.Attributes |= Bold
+		case param == 2:
+			pen.Attributes |= Dim
+		case param == 3:
+			pen.Attributes |= Italic
+		case param == 4 || param == 21:
+			pen.Attributes |= Underline
+		case param == 5 || param == 6:
+			pen.Attributes |= Blink
+		case param == 7:
+			pen.Attributes |= Reverse
+		case param == 8:
+			pen.Attributes |= Hidden
+		case param == 22:
+			pen.Attributes &^= Bold | Dim
+		case param == 23:
+			pen.Attributes &^= Italic
+		case param == 24:
+			pen.Attributes &^= Underline
+		case param == 25:
+			pen.Attributes &^= Blink
+		case param == 27:
+			pen.Attributes &^= Reverse
+		case param == 28:
+			pen.Attributes &^= Hidden
+		case param >= 30 && param <= 37:
+			pen.Fg = Color(param - 30)
+		case param == 38:
+			pen.Fg, i = getExtendedColor(params, i)
+		case param == 39:
+			pen.Fg = DefaultColor
+		case param >= 40 && param <= 47:
+			pen.Bg = Color(param - 40)
+		case param == 48:
+			pen.Bg, i = getExtendedColor(params, i)
+		case param == 49:
+			pen.Bg = DefaultColor
+		case param >= 90 && param <= 97:
+			pen.Fg = Color(param - 90 + 8)
+		case param >= 100 && param <= 107:
+			pen.Bg = Color(param - 100 + 8)
+		}
+	}
+}
+
+// Reads 38;5;n or 38;2;r;g;b starting at i, returns the color and the index of the last parameter used
+func getExtendedColor(params []int, i int) (Color, int) {
+	if i+1 >= len(params) {
+		return DefaultColor, i
+	}
+
+	switch params[i+1] {
+	case 5:
+		if i+2 < len(params) {
+			return Color(clamp(params[i+2], 0, 255)), i + 2
+		}
+	case 2:
+		if i+4 < len(params) {
+			return RGB(params[i+2], params[i+3], params[i+4]), i + 4
+		}
+	}
+	return DefaultColor, len(params) - 1
+}
+
+// Runs an operating system command, only setting the title is supported
+func (t *Terminal) runOsc() {
+	command, text, found := strings.Cut(string(t.parser.osc), ";")
+	if !found {
+		return
+	}
+
+	number, err := strconv.Atoi(command)
+	if err != nil {
+		return
+	}
+
+	if number == 0 || number == 2 {
+		t.title = text
+	}
+}
@@ -0,0 +1,291 @@
+package terminal
+
+import (
+	"github.com/jonasfreyr/gim/utils"
+)
+
+// The dec special graphics set, programs like top and tmux draw boxes with it
+var lineDrawing = map[rune]rune{
+	'`': '◆', 'a': '▒', 'f': '°', 'g': '±', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼',
+	'o': '⎺', 'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·',
+}
+
+// Puts the character at the cursor and moves it right, to the next line when the last column was written to
+func (t *Terminal) put(r rune) {
+	if t.cursor.charsets[t.cursor.charset] {
+		if drawn, ok := lineDrawing[r]; ok {
+			r = drawn
+		}
+	}
+
+	if t.wrapNext && t.autoWrap {
+		t.cursor.x = 0
+		t.lineFeed()
+	}
+	t.wrapNext = false
+
+	row := t.cells[t.cursor.y]
+	if t.insertMode {
+		copy(row[t.cursor.x+1:], row[t.cursor.x:])
+	}
+
+	cell := t.cursor.pen
+	cell.Char = r
+	row[t.cursor.x] = cell
+	t.lastChar = r
+
+	if t.cursor.x == t.width-1 {
+		t.wrapNext = t.autoWrap
+		return
+	}
+	t.cursor.x++
+}
+
+// Moves the cursor down a line, the scroll region scrolls when it is at the bottom of it
+func (t *Terminal) lineFeed() {
+	t.wrapNext = false
+	if t.cursor.y == t.bottom {
+		t.scrollRegionUp(1)
+		return
+	}
+	t.cursor.y = utils.Min(t.cursor.y+1, t.height-1)
+}
+
+func (t *Terminal) reverseIndex() {
+	t.wrapNext = false
+	if t.cursor.y == t.top {
+		t.scrollDown(t.top, 1)
+		return
+	}
+	t.cursor.y = utils.Max(t.cursor.y-1, 0)
+}
+
+// Scrolls the scroll region up by n for a line feed or SU. When the region is the whole screen the lines
+// scrolling off its top are kept, programs deleting lines or scrolling a part of the screen aren't printing output
+func (t *Terminal) scrollRegionUp(n int) {
+	if t.top == 0 && t.bottom == t.height-1 {
+		for _, line := range t.cells[:utils.Min(n, t.height)] {
+			t.pushScrollback(line)
+		}
+	}
+	t.scrollUp(t.top, n)
+}
+
+// Moves the lines from row to the bottom of the scroll region up by n, blank lines come in at the bottom
+func (t *Terminal) scrollUp(row, n int) {
+	n = utils.Min(n, t.bottom-row+1)
+	if n <= 0 {
+		return
+	}
+
+	copy(t.cells[row:t.bottom+1], t.cells[row+n:t.bottom+1])
+	for y := t.bottom - n + 1; y <= t.bottom; y++ {
+		t.cells[y] = t.blankRow()
+	}
+}
+
+// Moves the lines from row to the bottom of the scroll region down by n, blank lines come in at row
+func (t *Terminal) scrollDown(row, n int) {
+	n = utils.Min(n, t.bottom-row+1)
+	if n <= 0 {
+		return
+	}
+
+	copy(t.cells[row+n:t.bottom+1], t.cells[row:t.bottom+1-n])
+	for y := row; y < row+n; y++ {
+		t.cells[y] = t.blankRow()
+	}
+}
+
+func (t *Terminal) blankRow() []Cell {
+	row := make([]Cell, t.width)
+	t.eraseCells(row)
+	return row
+}
+
+func (t *Terminal) eraseCells(cells []Cell) {
+	blank := t.blank()
+	for x := range cells {
+		cells[x] = blank
+	}
+}
+
+// Moves the cursor, rows are counted from the top of the scroll region in origin mode
+func (t *Terminal) moveTo(x, y int) {
+	t.wrapNext = false
+	t.cursor.x = clamp(x, 0, t.width-1)
+
+	if t.cursor.originMode {
+		t.cursor.y = clamp(y+t.top, t.top, t.bottom)
+		return
+	}
+	t.cursor.y = clamp(y, 0, t.height-1)
+}
+
+// Moves the cursor up or down, it stops at the edge of the scroll region if it starts inside of it
+func (t *Terminal) moveVertically(delta int) {
+	t.wrapNext = false
+
+	top, bottom := 0, t.height-1
+	if t.cursor.y >= t.top && t.cursor.y <= t.bottom {
+		top, bottom = t.top, t.bottom
+	}
+	t.cursor.y = clamp(t.cursor.y+delta, top, bottom)
+}
+
+func (t *Terminal) moveHorizontally(delta int) {
+	t.wrapNext = false
+	t.cursor.x = clamp(t.cursor.x+delta, 0, t.width-1)
+}
+
+func (t *Terminal) tab(n int) {
+	for ; n > 0; n-- {
+		x := t.cursor.x + 1
+		for x < t.width-1 && !t.tabStops[x] {
+			x++
+		}
+		t.cursor.x = utils.Min(x, t.width-1)
+	}
+}
+
+func (t *Terminal) backTab(n int) {
+	for ; n > 0; n-- {
+		x := t.cursor.x - 1
+		for x > 0 && !t.tabStops[x] {
+			x--
+		}
+		t.cursor.x = utils.Max(x, 0)
+	}
+}
+
+// Erases the screen, 0 from the cursor, 1 up to the cursor and 2 all of it
+func (t *Terminal) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.eraseLine(0)
+		for y := t.cursor.y + 1; y < t.height; y++ {
+			t.eraseCells(t.cells[y])
+		}
+	case 1:
+		t.eraseLine(1)
+		for y := 0; y < t.cursor.y; y++ {
+			t.eraseCells(t.cells[y])
+		}
+	case 2:
+		for y := range t.cells {
+			t.eraseCells(t.cells[y])
+		}
+	case 3:
+		t.ClearScrollback()
+	}
+}
+
+// Erases the line, 0 from the cursor, 1 up to the cursor and 2 all of it
+func (t *Terminal) eraseLine(mode int) {
+	row := t.cells[t.cursor.y]
+	switch mode {
+	case 0:
+		t.eraseCells(row[t.cursor.x:])
+	case 1:
+		t.eraseCells(row[:t.cursor.x+1])
+	case 2:
+		t.eraseCells(row)
+	}
+}
+
+// Inserts n blank lines at the cursor, the lines below in the scroll region move down
+func (t *Terminal) insertLines(n int) {
+	if t.cursor.y < t.top || t.cursor.y > t.bottom {
+		return
+	}
+	t.scrollDown(t.cursor.y, n)
+	t.cursor.x = 0
+	t.wrapNext = false
+}
+
+func (t *Terminal) deleteLines(n int) {
+	if t.cursor.y < t.top || t.cursor.y > t.bottom {
+		return
+	}
+	t.scrollUp(t.cursor.y, n)
+	t.cursor.x = 0
+	t.wrapNext = false
+}
+
+func (t *Terminal) insertCells(n int) {
+	row := t.cells[t.cursor.y]
+	n = utils.Min(n, t.width-t.cursor.x)
+	copy(row[t.cursor.x+n:], row[t.cursor.x:])
+	t.eraseCells(row[t.cursor.x : t.cursor.x+n])
+	t.wrapNext = false
+}
+
+func (t *Terminal) deleteCells(n int) {
+	row := t.cells[t.cursor.y]
+	n = utils.Min(n, t.width-t.cursor.x)
+	copy(row[t.cursor.x:], row[t.cursor.x+n:])
+	t.eraseCells(row[t.width-n:])
+	t.wrapNext = false
+}
+
+func (t *Terminal) eraseCharacters(n int) {
+	row := t.cells[t.cursor.y]
+	t.eraseCells(row[t.cursor.x:utils.Min(t.cursor.x+n, t.width)])
+	t.wrapNext = false
+}
+
+// Sets the rows the screen scrolls between, counted from 1 like the escape code does
+func (t *Terminal) setScrollRegion(top, bottom int) {
+	if bottom <= 0 || bottom > t.height {
+		bottom = t.height
+	}
+	top = utils.Max(top, 1)
+	if top >= bottom {
+		return
+	}
+
+	t.top, t.bottom = top-1, bottom-1
+	t.moveTo(0, 0)
+}
+
+func (t *Terminal) saveCursor() {
+	t.saved = t.cursor
+}
+
+func (t *Terminal) restoreCursor() {
+	t.cursor = t.saved
+	t.cursor.x = utils.Min(t.cursor.x, t.width-1)
+	t.cursor.y = utils.Min(t.cursor.y, t.height-1)
+	t.wrapNext = false
+}
+
+// Switches to the alternate screen or back, it is cleared when entered if clear is set
+func (t *Terminal) useAlternateScreen(alternate, clear bool) {
+	if alternate == t.alternateScreen {
+		return
+	}
+
+	t.alternateScreen = alternate
+	t.cells = t.primary
+	if alternate {
+		t.cells = t.alternate
+		if clear {
+			for y := range t.cells {
+				t.eraseCells(t.cells[y])
+			}
+		}
+	}
+	t.wrapNext = false
+}
+
+// Fills the screen with E, used to line up the screen
+func (t *Terminal) alignmentTest() {
+	for y := range t.cells {
+		for x := range t.cells[y] {
+			t.cells[y][x] = Cell{Char: 'E', Fg: DefaultColor, Bg: DefaultColor}
+		}
+	}
+	t.top, t.bottom = 0, t.height-1
+	t.moveTo(0, 0)
+}
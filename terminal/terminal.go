@@ -0,0 +1,326 @@
+package terminal
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jonasfreyr/gim/utils"
+)
+
+const TAB_WIDTH = 8
+const MAX_TITLE_LENGTH = 4096
+const DEFAULT_SCROLLBACK = 10000
+
+// Color is an index in the 256 color palette of xterm, the first 16 are the ansi colors
+type Color int16
+
+const DefaultColor Color = -1
+
+type Attributes uint8
+
+const (
+	Bold Attributes = 1 << iota
+	Dim
+	Italic
+	Underline
+	Blink
+	Reverse
+	Hidden
+)
+
+// Cell is a character on the screen and how it looks
+type Cell struct {
+	Char       rune
+	Fg, Bg     Color
+	Attributes Attributes
+}
+
+var blankCell = Cell{Char: ' ', Fg: DefaultColor, Bg: DefaultColor}
+
+// cursor is where the next character goes and what it looks like, saved and restored as a whole
+type cursor struct {
+	x, y int
+	pen  Cell
+
+	originMode bool
+	charsets   [2]bool // line drawing in G0 or G1
+	charset    int
+}
+
+// Terminal emulates a vt100 like xterm does. Output of a program is written to it and the screen can be read
+// cell by cell. It is not safe to use from more than one goroutine at a time
+type Terminal struct {
+	Output          io.Writer // replies to queries like where the cursor is go here, they are dropped when it is nil
+	ScrollbackLimit int       // lines kept after they scroll off the top of the primary screen
+
+	width, height int
+
+	cells           [][]Cell // the screen being shown, either primary or alternate
+	primary         [][]Cell
+	alternate       [][]Cell
+	alternateScreen bool // full screen programs draw on the alternate screen so the shell is back when they quit
+
+	scrollback [][]Cell // the oldest line first
+	scrolled   int      // lines ever moved into the scrollback, it keeps counting when old lines are dropped
+
+	cursor cursor
+	saved  cursor
+
+	top, bottom int  // the scroll region, both rows are in it
+	wrapNext    bool // the last column was written to, the next character goes on the next line
+
+	autoWrap              bool
+	insertMode            bool
+	cursorVisible         bool
+	applicationCursorKeys bool
+	bracketedPaste        bool
+
+	tabStops []bool
+	lastChar rune
+	title    string
+
+	parser parser
+}
+
+func New(width, height int) *Terminal {
+	t := &Terminal{ScrollbackLimit: DEFAULT_SCROLLBACK}
+	t.reset(width, height)
+	return t
+}
+
+func newGrid(width, height int) [][]Cell {
+	grid := make([][]Cell, height)
+	for y := range grid {
+		grid[y] = newRow(width)
+	}
+	return grid
+}
+
+func newRow(width int) []Cell {
+	row := make([]Cell, width)
+	for x := range row {
+		row[x] = blankCell
+	}
+	return row
+}
+
+func (t *Terminal) reset(width, height int) {
+	width, height = utils.Max(width, 1), utils.Max(height, 1)
+
+	t.width, t.height = width, height
+	t.primary = newGrid(width, height)
+	t.alternate = newGrid(width, height)
+	t.cells = t.primary
+	t.alternateScreen = false
+	t.scrollback = nil
+
+	t.cursor = cursor{pen: blankCell}
+	t.saved = t.cursor
+
+	t.top, t.bottom = 0, height-1
+	t.wrapNext = false
+
+	t.autoWrap = true
+	t.insertMode = false
+	t.cursorVisible = true
+	t.applicationCursorKeys = false
+	t.bracketedPaste = false
+
+	t.tabStops = make([]bool, width)
+	t.resetTabStops(0)
+	t.title = ""
+	t.parser = parser{}
+}
+
+func (t *Terminal) resetTabStops(from int) {
+	for x := from; x < len(t.tabStops); x++ {
+		t.tabStops[x] = x%TAB_WIDTH == 0 && x > 0
+	}
+}
+
+// Write runs the output of a program, text is put on the screen and escape codes are carried out.
+// Escape codes and characters can be split between writes
+func (t *Terminal) Write(p []byte) (int, error) {
+	data := p
+	if len(t.parser.pending) > 0 {
+		data = append(t.parser.pending, p...)
+		t.parser.pending = nil
+	}
+
+	for i := 0; i < len(data); {
+		b := data[i]
+		if t.parser.state == stateGround && b >= utf8.RuneSelf {
+			if !utf8.FullRune(data[i:]) {
+				t.parser.pending = append([]byte{}, data[i:]...)
+				break
+			}
+
+			r, size := utf8.DecodeRune(data[i:])
+			t.put(r)
+			i += size
+			continue
+		}
+
+		t.handle(b)
+		i++
+	}
+	return len(p), nil
+}
+
+func (t *Terminal) Size() (int, int) {
+	return t.width, t.height
+}
+
+// Cell returns the cell in column x of row y
+func (t *Terminal) Cell(x, y int) Cell {
+	return t.cells[y][x]
+}
+
+// Lines returns how many lines there are in the scrollback and on the screen together
+func (t *Terminal) Lines() int {
+	return len(t.scrollback) + t.height
+}
+
+// Line returns line y counted from the oldest line in the scrollback, the screen comes after the scrollback.
+// Lines of the scrollback can be shorter or longer than the screen is wide if it was resized
+func (t *Terminal) Line(y int) []Cell {
+	if y < len(t.scrollback) {
+		return t.scrollback[y]
+	}
+	return t.cells[y-len(t.scrollback)]
+}
+
+// LineText returns the characters of line y without the blanks at the end
+func (t *Terminal) LineText(y int) string {
+	line := t.Line(y)
+	chars := make([]rune, len(line))
+	for x, cell := range line {
+		chars[x] = cell.Char
+	}
+	return strings.TrimRight(string(chars), " ")
+}
+
+// Scrolled returns how many lines have scrolled into the scrollback since the start, it is used to keep
+// a view of the scrollback on the same lines while more output comes
+func (t *Terminal) Scrolled() int {
+	return t.scrolled
+}
+
+func (t *Terminal) ClearScrollback() {
+	t.scrollback = nil
+}
+
+// Keeps a line that scrolled off the primary screen
+func (t *Terminal) pushScrollback(line []Cell) {
+	if t.alternateScreen || t.ScrollbackLimit <= 0 {
+		return
+	}
+
+	t.scrollback = append(t.scrollback, line)
+	t.scrolled++
+	if len(t.scrollback) > t.ScrollbackLimit {
+		t.scrollback = t.scrollback[len(t.scrollback)-t.ScrollbackLimit:]
+	}
+}
+
+// Cursor returns the column and row of the cursor
+func (t *Terminal) Cursor() (int, int) {
+	return t.cursor.x, t.cursor.y
+}
+
+func (t *Terminal) CursorVisible() bool {
+	return t.cursorVisible
+}
+
+// ApplicationCursorKeys is if the program wants the arrow keys sent as ESC O instead of ESC [
+func (t *Terminal) ApplicationCursorKeys() bool {
+	return t.applicationCursorKeys
+}
+
+// BracketedPaste is if the program wants pasted text between ESC [200~ and ESC [201~
+func (t *Terminal) BracketedPaste() bool {
+	return t.bracketedPaste
+}
+
+func (t *Terminal) AlternateScreen() bool {
+	return t.alternateScreen
+}
+
+// Title is the window title the program set
+func (t *Terminal) Title() string {
+	return t.title
+}
+
+// Resize changes the size of the screen. When it gets shorter the lines above the cursor are dropped so it stays on the screen
+func (t *Terminal) Resize(width, height int) {
+	width, height = utils.Max(width, 1), utils.Max(height, 1)
+	if width == t.width && height == t.height {
+		return
+	}
+
+	shift := utils.Max(t.cursor.y-height+1, 0)
+	if !t.alternateScreen {
+		for _, line := range t.primary[:utils.Min(shift, len(t.primary))] {
+			t.pushScrollback(line)
+		}
+	}
+	t.primary = resizeGrid(t.primary, width, height, shift)
+	t.alternate = resizeGrid(t.alternate, width, height, shift)
+	t.cursor.y -= shift
+	t.saved.y = utils.Max(t.saved.y-shift, 0)
+
+	t.cells = t.primary
+	if t.alternateScreen {
+		t.cells = t.alternate
+	}
+
+	oldWidth := t.width
+	t.width, t.height = width, height
+	t.top, t.bottom = 0, height-1
+
+	tabStops := make([]bool, width)
+	copy(tabStops, t.tabStops)
+	t.tabStops = tabStops
+	if width > oldWidth {
+		t.resetTabStops(oldWidth)
+	}
+
+	t.cursor.x = utils.Min(t.cursor.x, width-1)
+	t.cursor.y = utils.Min(t.cursor.y, height-1)
+	t.saved.x = utils.Min(t.saved.x, width-1)
+	t.saved.y = utils.Min(t.saved.y, height-1)
+	t.wrapNext = false
+}
+
+func resizeGrid(grid [][]Cell, width, height, shift int) [][]Cell {
+	grid = grid[utils.Min(shift, len(grid)):]
+
+	resized := make([][]Cell, height)
+	for y := range resized {
+		row := newRow(width)
+		if y < len(grid) {
+			copy(row, grid[y])
+		}
+		resized[y] = row
+	}
+	return resized
+}
+
+// The cell left behind when text is erased, it keeps the background color like xterm does
+func (t *Terminal) blank() Cell {
+	cell := blankCell
+	cell.Bg = t.cursor.pen.Bg
+	return cell
+}
+
+func (t *Terminal) reply(text string) {
+	if t.Output == nil {
+		return
+	}
+	_, _ = io.WriteString(t.Output, text)
+}
+
+func clamp(value, low, high int) int {
+	return utils.Max(low, utils.Min(value, high))
+}
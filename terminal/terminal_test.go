@@ -0,0 +1,259 @@
+package terminal
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Returns the text of the rows of the screen, without the scrollback
+func screenText(t *Terminal) []string {
+	_, height := t.Size()
+	offset := t.Lines() - height
+	lines := make([]string, height)
+	for y := range lines {
+		lines[y] = t.LineText(offset + y)
+	}
+	return lines
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		input         string
+		screen        []string
+		x, y          int
+	}{
+		{"text", 10, 3, "hello", []string{"hello", "", ""}, 5, 0},
+		{"newline", 10, 3, "ab\r\ncd", []string{"ab", "cd", ""}, 2, 1},
+		{"line feed keeps column", 10, 3, "ab\ncd", []string{"ab", "  cd", ""}, 4, 1},
+		{"backspace", 10, 2, "abc\bX", []string{"abX", ""}, 3, 0},
+		{"tab", 20, 1, "a\tb", []string{"a       b"}, 9, 0},
+		{"auto wrap", 4, 3, "abcdef", []string{"abcd", "ef", ""}, 2, 1},
+		{"last column waits", 4, 2, "abcd", []string{"abcd", ""}, 3, 0},
+		{"no auto wrap", 4, 2, "\x1b[?7labcdef", []string{"abcf", ""}, 3, 0},
+		{"scroll at bottom", 5, 2, "a\r\nb\r\nc", []string{"b", "c"}, 1, 1},
+		{"utf-8", 10, 1, "h\xc3\xa9llo", []string{"héllo"}, 5, 0},
+		{"line drawing charset", 10, 1, "\x1b(0qx\x1b(Bq", []string{"─│q"}, 3, 0},
+
+		{"cursor position", 10, 3, "\x1b[2;3HX", []string{"", "  X", ""}, 3, 1},
+		{"cursor position defaults", 10, 3, "abc\x1b[HX", []string{"Xbc", "", ""}, 1, 0},
+		{"cursor position clamped", 5, 2, "\x1b[9;9HX", []string{"", "    X"}, 4, 1},
+		{"cursor up and down", 10, 3, "\x1b[3;1H\x1b[2Aa\x1b[Bb", []string{"a", " b", ""}, 2, 1},
+		{"cursor forward and back", 10, 1, "\x1b[5Ca\x1b[3Db", []string{"   b a"}, 4, 0},
+		{"column", 10, 1, "abc\x1b[6GX", []string{"abc  X"}, 6, 0},
+		{"line", 10, 3, "ab\x1b[3dX", []string{"ab", "", "  X"}, 3, 2},
+		{"next and previous line", 10, 3, "ab\x1b[2Ec\x1b[Fd", []string{"ab", "d", "c"}, 1, 1},
+		{"save and restore", 10, 2, "ab\x1b7\x1b[2;5Hcd\x1b8X", []string{"abX", "    cd"}, 3, 0},
+
+		{"erase to end of line", 10, 1, "abcdef\x1b[4G\x1b[K", []string{"abc"}, 3, 0},
+		{"erase to start of line", 10, 1, "abcdef\x1b[3G\x1b[1K", []string{"   def"}, 2, 0},
+		{"erase line", 10, 1, "abcdef\x1b[2K", []string{""}, 6, 0},
+		{"erase below", 10, 3, "aa\r\nbb\r\ncc\x1b[2;2H\x1b[J", []string{"aa", "b", ""}, 1, 1},
+		{"erase above", 10, 3, "aa\r\nbb\r\ncc\x1b[2;1H\x1b[1J", []string{"", " b", "cc"}, 0, 1},
+		{"erase display", 10, 2, "aa\r\nbb\x1b[2J", []string{"", ""}, 2, 1},
+		{"erase characters", 10, 1, "abcdef\x1b[2G\x1b[2X", []string{"a  def"}, 1, 0},
+		{"delete characters", 10, 1, "abcdef\x1b[2G\x1b[2P", []string{"adef"}, 1, 0},
+		{"insert characters", 10, 1, "abc\x1b[2G\x1b[2@", []string{"a  bc"}, 1, 0},
+		{"insert mode", 10, 1, "abc\x1b[2G\x1b[4hXY", []string{"aXYbc"}, 3, 0},
+		{"repeat", 10, 1, "a\x1b[3b", []string{"aaaa"}, 4, 0},
+
+		{"insert lines", 5, 3, "a\r\nb\r\nc\x1b[2;1H\x1b[L", []string{"a", "", "b"}, 0, 1},
+		{"delete lines", 5, 3, "a\r\nb\r\nc\x1b[1;1H\x1b[M", []string{"b", "c", ""}, 0, 0},
+		{"scroll up", 5, 3, "a\r\nb\r\nc\x1b[S", []string{"b", "c", ""}, 1, 2},
+		{"scroll down", 5, 3, "a\r\nb\r\nc\x1b[T", []string{"", "a", "b"}, 1, 2},
+		{"reverse index at top", 5, 2, "a\x1b[H\x1bMb", []string{"b", "a"}, 1, 0},
+
+		{"scroll region", 5, 4, "1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[3;1H\nx", []string{"1", "3", "x", "4"}, 1, 2},
+		{"scroll region keeps lines below", 5, 4, "1\r\n2\r\n3\r\n4\x1b[1;2r\x1b[2;1H\n\n", []string{"", "", "3", "4"}, 0, 1},
+		{"origin mode", 5, 4, "\x1b[2;3r\x1b[?6h\x1b[1;1HX", []string{"", "X", "", ""}, 1, 1},
+		{"reset scroll region", 5, 3, "\x1b[2;3r\x1b[r\x1b[3;1H\nx", []string{"", "", "x"}, 1, 2},
+
+		{"alternate screen", 10, 2, "main\x1b[?1049hfull", []string{"    full", ""}, 8, 0},
+		{"leave alternate screen", 10, 2, "main\x1b[?1049hfull\x1b[?1049l", []string{"main", ""}, 4, 0},
+
+		{"unknown sequence ignored", 10, 1, "a\x1b[99zb", []string{"ab"}, 2, 0},
+		{"title is not shown", 10, 1, "\x1b]0;title\x07ab", []string{"ab"}, 2, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			term := New(test.width, test.height)
+			_, err := term.Write([]byte(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if screen := screenText(term); !reflect.DeepEqual(screen, test.screen) {
+				t.Errorf("screen is %q, want %q", screen, test.screen)
+			}
+			if x, y := term.Cursor(); x != test.x || y != test.y {
+				t.Errorf("cursor is at %d,%d, want %d,%d", x, y, test.x, test.y)
+			}
+		})
+	}
+}
+
+// Sequences can be cut anywhere between writes, like they are when read from a pty
+func TestWriteSplit(t *testing.T) {
+	input := "\x1b[2;3H\x1b[1;31mh\xc3\xa9\x1b]2;title\x07"
+	for i := 0; i <= len(input); i++ {
+		term := New(10, 3)
+		_, _ = term.Write([]byte(input[:i]))
+		_, _ = term.Write([]byte(input[i:]))
+
+		if text := term.LineText(1); text != "  hé" {
+			t.Errorf("split at %d: line is %q", i, text)
+		}
+		if title := term.Title(); title != "title" {
+			t.Errorf("split at %d: title is %q", i, title)
+		}
+	}
+}
+
+func TestGraphics(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		cell  Cell
+	}{
+		{"default", "a", Cell{Char: 'a', Fg: DefaultColor, Bg: DefaultColor}},
+		{"bold and underline", "\x1b[1;4ma", Cell{Char: 'a', Fg: DefaultColor, Bg: DefaultColor, Attributes: Bold | Underline}},
+		{"attributes off", "\x1b[1;4;7m\x1b[22;27ma", Cell{Char: 'a', Fg: DefaultColor, Bg: DefaultColor, Attributes: Underline}},
+		{"ansi colors", "\x1b[31;42ma", Cell{Char: 'a', Fg: 1, Bg: 2}},
+		{"bright colors", "\x1b[91;102ma", Cell{Char: 'a', Fg: 9, Bg: 10}},
+		{"256 colors", "\x1b[38;5;200;48;5;17ma", Cell{Char: 'a', Fg: 200, Bg: 17}},
+		{"true color", "\x1b[38;2;255;0;0ma", Cell{Char: 'a', Fg: RGB(255, 0, 0), Bg: DefaultColor}},
+		{"default colors", "\x1b[31;42m\x1b[39;49ma", Cell{Char: 'a', Fg: DefaultColor, Bg: DefaultColor}},
+		{"reset", "\x1b[1;31m\x1b[ma", Cell{Char: 'a', Fg: DefaultColor, Bg: DefaultColor}},
+		{"erase keeps background", "\x1b[44m\x1b[K", Cell{Char: ' ', Fg: DefaultColor, Bg: 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			term := New(10, 1)
+			_, _ = term.Write([]byte(test.input))
+			if cell := term.Cell(0, 0); cell != test.cell {
+				t.Errorf("cell is %+v, want %+v", cell, test.cell)
+			}
+		})
+	}
+}
+
+func TestScrollback(t *testing.T) {
+	term := New(5, 2)
+	term.ScrollbackLimit = 3
+	_, _ = term.Write([]byte("1\r\n2\r\n3\r\n4\r\n5\r\n6"))
+
+	lines := make([]string, term.Lines())
+	for y := range lines {
+		lines[y] = term.LineText(y)
+	}
+	want := []string{"2", "3", "4", "5", "6"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines are %q, want %q", lines, want)
+	}
+	if scrolled := term.Scrolled(); scrolled != 4 {
+		t.Errorf("scrolled %d lines, want 4", scrolled)
+	}
+
+	// Full screen programs don't fill the scrollback
+	_, _ = term.Write([]byte("\x1b[?1049h\r\na\r\nb\r\nc\x1b[?1049l"))
+	if scrolled := term.Scrolled(); scrolled != 4 {
+		t.Errorf("scrolled %d lines on the alternate screen, want 4", scrolled)
+	}
+
+	term.ClearScrollback()
+	if lines := term.Lines(); lines != 2 {
+		t.Errorf("%d lines after clearing the scrollback, want 2", lines)
+	}
+}
+
+func TestResize(t *testing.T) {
+	term := New(5, 3)
+	_, _ = term.Write([]byte("abcde\r\nfg\r\nhi"))
+
+	term.Resize(3, 2)
+	if screen := screenText(term); !reflect.DeepEqual(screen, []string{"fg", "hi"}) {
+		t.Errorf("screen is %q after shrinking", screen)
+	}
+	if x, y := term.Cursor(); x != 2 || y != 1 {
+		t.Errorf("cursor is at %d,%d after shrinking, want 2,1", x, y)
+	}
+	if text := term.LineText(0); text != "abcde" {
+		t.Errorf("line above the screen is %q, want it in the scrollback", text)
+	}
+
+	term.Resize(12, 4)
+	if screen := screenText(term); !reflect.DeepEqual(screen, []string{"fg", "hi", "", ""}) {
+		t.Errorf("screen is %q after growing", screen)
+	}
+
+	// Tab stops are added to the new columns
+	_, _ = term.Write([]byte("\r\tx"))
+	if text := term.LineText(term.Lines() - 3); text != "hi      x" {
+		t.Errorf("line is %q after tabbing on the grown screen", text)
+	}
+}
+
+func TestReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		reply string
+	}{
+		{"cursor position", "\x1b[3;5H\x1b[6n", "\x1b[3;5R"},
+		{"cursor position in origin mode", "\x1b[2;4r\x1b[?6h\x1b[2;1H\x1b[6n", "\x1b[2;1R"},
+		{"status", "\x1b[5n", "\x1b[0n"},
+		{"device attributes", "\x1b[c", "\x1b[?1;2c"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			term := New(10, 5)
+			output := &bytes.Buffer{}
+			term.Output = output
+			_, _ = term.Write([]byte(test.input))
+			if reply := output.String(); reply != test.reply {
+				t.Errorf("reply is %q, want %q", reply, test.reply)
+			}
+		})
+	}
+}
+
+func TestModes(t *testing.T) {
+	term := New(10, 2)
+	_, _ = term.Write([]byte("\x1b[?1h\x1b[?2004h\x1b[?25l"))
+	if !term.ApplicationCursorKeys() || !term.BracketedPaste() || term.CursorVisible() {
+		t.Error("modes weren't set")
+	}
+
+	_, _ = term.Write([]byte("\x1b[?1l\x1b[?2004l\x1b[?25h"))
+	if term.ApplicationCursorKeys() || term.BracketedPaste() || !term.CursorVisible() {
+		t.Error("modes weren't reset")
+	}
+}
+
+func TestScrollbackFromOutputOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		scrolled int
+	}{
+		{"line feed", "1\r\n2\r\n3\r\n4", 1},
+		{"scroll up", "1\r\n2\x1b[2S", 2},
+		{"delete lines at the top", "1\r\n2\r\n3\x1b[H\x1b[2M", 0},
+		{"line feed in a scroll region", "\x1b[1;2r\x1b[2H\n\n", 0},
+		{"scroll up in a scroll region", "\x1b[2;3r\x1b[S", 0},
+		{"line feed after resetting the region", "\x1b[1;2r\x1b[r\x1b[3H\n", 1},
+	}
+
+	for _, test := range tests {
+		term := New(5, 3)
+		_, _ = term.Write([]byte(test.input))
+		if scrolled := term.Scrolled(); scrolled != test.scrolled {
+			t.Errorf("%s: scrolled %d lines, want %d", test.name, scrolled, test.scrolled)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/jonasfreyr/gim/terminal"
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const TERMINAL_TYPE = "xterm-256color" // what the shell is told the terminal is, the escape codes it uses are emulated
+const TERMINAL_LEAVE_KEY = 20          // Ctrl+T, goes back to the editor from the terminal
+
+// When text sent to the terminal is marked as pasted
+const (
+	BRACKETED_PASTE_AUTO   = "auto" // when the program running asked for it
+	BRACKETED_PASTE_ALWAYS = "always"
+	BRACKETED_PASTE_NEVER  = "never"
+)
+
+// What the keys ncurses turns escape codes into are sent as
+var terminalKeySequences = map[gc.Key]string{
+	gc.KEY_ENTER:     "\r",
+	gc.KEY_RETURN:    "\r",
+	gc.KEY_BACKSPACE: "\x7f",
+	gc.KEY_ESC:       "\x1b",
+	gc.KEY_HOME:      "\x1b[H",
+	gc.KEY_END:       "\x1b[F",
+	gc.KEY_IC:        "\x1b[2~",
+	gc.KEY_DC:        "\x1b[3~",
+	gc.KEY_PAGEUP:    "\x1b[5~",
+	gc.KEY_PAGEDOWN:  "\x1b[6~",
+	gc.KEY_BTAB:      "\x1b[Z",
+	gc.KEY_F1:        "\x1bOP",
+	gc.KEY_F2:        "\x1bOQ",
+	gc.KEY_F3:        "\x1bOR",
+	gc.KEY_F4:        "\x1bOS",
+	gc.KEY_F5:        "\x1b[15~",
+	gc.KEY_F6:        "\x1b[17~",
+	gc.KEY_F7:        "\x1b[18~",
+	gc.KEY_F8:        "\x1b[19~",
+	gc.KEY_F9:        "\x1b[20~",
+	gc.KEY_F10:       "\x1b[21~",
+	gc.KEY_F11:       "\x1b[23~",
+	gc.KEY_F12:       "\x1b[24~",
+}
+
+var terminalArrowKeys = map[gc.Key]string{
+	gc.KEY_UP:    "A",
+	gc.KEY_DOWN:  "B",
+	gc.KEY_RIGHT: "C",
+	gc.KEY_LEFT:  "D",
+}
+
+// Returns what the terminal sends the shell for the key, nothing for keys it doesn't know
+func getTerminalKeySequence(key gc.Key, applicationCursorKeys bool) []byte {
+	if arrow, ok := terminalArrowKeys[key]; ok {
+		if applicationCursorKeys {
+			return []byte("\x1bO" + arrow)
+		}
+		return []byte("\x1b[" + arrow)
+	}
+
+	if sequence, ok := terminalKeySequences[key]; ok {
+		return []byte(sequence)
+	}
+
+	// Characters and control keys, the bytes of utf-8 characters come one at a time
+	if key >= 0 && key < 256 {
+		return []byte{byte(key)}
+	}
+	return nil
+}
+
+func (e *Editor) writeToTerminal(data []byte) {
+	if len(data) == 0 || !e.terminalTab.alive {
+		return
+	}
+
+	_, err := e.terminalTab.pty.Write(data)
+	if err != nil {
+		e.debugLog("failed to write to terminal:", err)
+	}
+}
+
+// Sends pasted text to the shell, marked as pasted if the program running wants it or mode says so
+func (e *Editor) pasteToTerminal(text, mode string) {
+	e.terminalLock.RLock()
+	bracketed := e.terminalTab.terminal.BracketedPaste()
+	e.terminalLock.RUnlock()
+
+	// Terminals send new lines as carriage returns
+	text = strings.ReplaceAll(text, "\n", "\r")
+
+	if mode == BRACKETED_PASTE_ALWAYS || mode != BRACKETED_PASTE_NEVER && bracketed {
+		text = "\x1b" + PASTE_START + text + PASTE_END
+	}
+	e.writeToTerminal([]byte(text))
+}
+
+// Runs the selection or the current line in the terminal, the pane is opened if it is closed
+func (e *Editor) sendToTerminal() {
+	text := e.selected
+	if text == "" {
+		text = e.lines[e.y]
+	}
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return
+	}
+
+	if !e.terminalOpened {
+		e.resizeWindows()
+	}
+
+	if !e.terminalTab.alive {
+		err := e.initTerminal()
+		if err != nil {
+			e.debugLog(err)
+			return
+		}
+	}
+
+	e.scrollTerminal(-e.terminalTab.scroll)
+	e.pasteToTerminal(text, GetEditorConfig().TerminalBracketedPaste)
+	e.writeToTerminal([]byte("\r"))
+	e.drawTerminal()
+}
+
+// Fits the terminal of every tab to the pane
+func (e *Editor) resizeTerminal() {
+	height, width := e.getTerminalSize()
+
+	e.terminalLock.Lock()
+	for _, tab := range e.terminalTabs {
+		tab.terminal.Resize(width, height)
+		tab.clampScroll()
+	}
+	e.terminalLock.Unlock()
+
+	for _, tab := range e.terminalTabs {
+		if !tab.alive {
+			continue
+		}
+
+		err := e.resizePty(tab)
+		if err != nil {
+			e.debugLog("failed to resize terminal:", err)
+		}
+	}
+}
+
+func getTerminalAttributes(cell terminal.Cell) gc.Char {
+	attributes := gc.Char(gc.A_NORMAL)
+	if cell.Attributes&terminal.Bold != 0 {
+		attributes |= gc.A_BOLD
+	}
+	if cell.Attributes&terminal.Dim != 0 {
+		attributes |= gc.A_DIM
+	}
+	if cell.Attributes&terminal.Underline != 0 {
+		attributes |= gc.A_UNDERLINE
+	}
+	if cell.Attributes&terminal.Blink != 0 {
+		attributes |= gc.A_BLINK
+	}
+	if cell.Attributes&terminal.Reverse != 0 {
+		attributes |= gc.A_REVERSE
+	}
+	if cell.Attributes&terminal.Hidden != 0 {
+		attributes |= gc.A_INVIS
+	}
+	return attributes | gc.ColorPair(getColorPair(int16(cell.Fg), int16(cell.Bg)))
+}
+
+// Returns the cell of the line of the tab, blank past the end of lines from the scrollback
+func getTerminalCell(tab *TerminalTab, line []terminal.Cell, lineNr, x int) terminal.Cell {
+	if x >= len(line) {
+		return terminal.Cell{Char: ' ', Fg: terminal.DefaultColor, Bg: terminal.DefaultColor}
+	}
+
+	cell := line[x]
+	if lineNr == tab.matchLine && x >= tab.matchX && x < tab.matchX+tab.matchLength {
+		cell.Attributes ^= terminal.Reverse
+	}
+	return cell
+}
+
+// Draws the lines of the shown tab below the tabs and to the right of the border, scrolled back into the scrollback
+// if it is scrolled. Characters that look the same are printed together
+func (e *Editor) drawTerminalCells() {
+	tab := e.terminalTab
+	t := tab.terminal
+
+	width, height := t.Size()
+	maxY, maxX := e.terminalscr.MaxYX()
+	width, height = utils.Min(width, maxX-1), utils.Min(height, maxY-TERMINAL_HEADER_HEIGHT)
+	top := t.Lines() - height - tab.scroll
+
+	for y := 0; y < height; y++ {
+		line := t.Line(top + y)
+		for x := 0; x < width; {
+			cell := getTerminalCell(tab, line, top+y, x)
+			attributes := getTerminalAttributes(cell)
+
+			run := []rune{cell.Char}
+			end := x + 1
+			for ; end < width; end++ {
+				next := getTerminalCell(tab, line, top+y, end)
+				if getTerminalAttributes(next) != attributes {
+					break
+				}
+				run = append(run, next.Char)
+			}
+
+			err := e.terminalscr.AttrSet(attributes)
+			if err != nil {
+				log.Println(err) // The terminal is locked, debugLog would write to it
+			}
+			e.terminalscr.MovePrint(y+TERMINAL_HEADER_HEIGHT, x+1, string(run))
+			x = end
+		}
+	}
+
+	_ = e.terminalscr.AttrSet(gc.A_NORMAL)
+}
+
+func init() {
+	registerCommand("send_to_terminal", "run the selection or the current line in the terminal", func(e *Editor, c *CommandContext) {
+		e.sendToTerminal()
+		c.resetSelected = false
+	})
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/terminal"
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const TERMINAL_HEADER_HEIGHT = 2 // the tabs and a line below them
+
+// TerminalTab is a shell in the terminal pane, every tab has its own shell, directory and scrollback
+type TerminalTab struct {
+	name string
+	dir  string
+
+	terminal *terminal.Terminal
+	pty      *os.File
+	process  *os.Process
+	alive    bool
+
+	scroll   int // lines scrolled back into the scrollback, 0 follows the output
+	scrolled int // lines the terminal had scrolled when scroll was last kept in place
+
+	matchText                      string
+	matchLine, matchX, matchLength int // where matchText was last found
+}
+
+func NewTerminalTab(dir string, width, height int) *TerminalTab {
+	t := terminal.New(width, height)
+	t.ScrollbackLimit = GetEditorConfig().TerminalScrollback
+
+	return &TerminalTab{
+		name:      filepath.Base(dir),
+		dir:       dir,
+		terminal:  t,
+		matchLine: -1,
+	}
+}
+
+// Returns the command starting the shell, the one in the config or else $SHELL
+func getShell() []string {
+	shell := strings.Fields(GetEditorConfig().Shell)
+	if len(shell) > 0 {
+		return shell
+	}
+
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return []string{shell}
+	}
+	return []string{"sh"}
+}
+
+// Returns the rows and columns left for the terminal in the pane
+func (e *Editor) getTerminalSize() (int, int) {
+	height, width := e.terminalscr.MaxYX()
+	return utils.Max(height-TERMINAL_HEADER_HEIGHT, 1), utils.Max(width-1, 1)
+}
+
+// Keeps the lines being looked at in the scrollback in place while more output comes
+func (t *TerminalTab) keepScroll() {
+	scrolled := t.terminal.Scrolled()
+	if t.scroll > 0 {
+		t.scroll += scrolled - t.scrolled
+		t.clampScroll()
+	}
+	t.scrolled = scrolled
+}
+
+func (t *TerminalTab) clampScroll() {
+	_, height := t.terminal.Size()
+	t.scroll = utils.Max(utils.Min(t.scroll, t.terminal.Lines()-height), 0)
+}
+
+func (t *TerminalTab) kill() error {
+	if t.process == nil || !t.alive {
+		return nil
+	}
+	return t.process.Kill()
+}
+
+// Opens a new tab with a shell in dir and shows it
+func (e *Editor) addTerminalTab(dir string) {
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+
+	height, width := e.getTerminalSize()
+	tab := NewTerminalTab(dir, width, height)
+	e.terminalTabs = append(e.terminalTabs, tab)
+	e.terminalTab = tab
+}
+
+// Kills the shell of the shown tab and closes it, the last tab is replaced with a new one
+func (e *Editor) closeTerminalTab() {
+	tab := e.terminalTab
+	err := tab.kill()
+	if err != nil {
+		e.debugLog("failed to kill terminal:", err)
+	}
+
+	index := utils.Index(e.terminalTabs, tab)
+	e.terminalTabs = append(e.terminalTabs[:index], e.terminalTabs[index+1:]...)
+	if len(e.terminalTabs) == 0 {
+		e.addTerminalTab(tab.dir)
+		return
+	}
+	e.terminalTab = e.terminalTabs[utils.Min(index, len(e.terminalTabs)-1)]
+}
+
+func (e *Editor) switchTerminalTab(delta int) {
+	index := utils.Index(e.terminalTabs, e.terminalTab) + delta
+	index = (index%len(e.terminalTabs) + len(e.terminalTabs)) % len(e.terminalTabs)
+	e.terminalTab = e.terminalTabs[index]
+}
+
+// Scrolls the shown tab back into its scrollback by delta lines, negative goes towards the output
+func (e *Editor) scrollTerminal(delta int) {
+	e.terminalLock.Lock()
+	defer e.terminalLock.Unlock()
+
+	tab := e.terminalTab
+	tab.scroll += delta
+	tab.clampScroll()
+	tab.scrolled = tab.terminal.Scrolled()
+}
+
+// Finds text in the scrollback and on the screen, going back from the last match. It is scrolled to so it can be seen
+func (e *Editor) findInTerminal(text string) bool {
+	e.terminalLock.Lock()
+	defer e.terminalLock.Unlock()
+
+	tab := e.terminalTab
+	t := tab.terminal
+	_, height := t.Size()
+	text = strings.ToLower(text)
+
+	// Searching for the same text again finds the one before
+	start := tab.matchLine
+	if text != tab.matchText || start == -1 || start >= t.Lines() {
+		start = t.Lines()
+	}
+	tab.matchText = text
+
+	for line := start - 1; line >= 0; line-- {
+		lineText := strings.ToLower(t.LineText(line))
+		index := strings.Index(lineText, text)
+		if index == -1 {
+			continue
+		}
+
+		tab.matchLine, tab.matchX, tab.matchLength = line, len([]rune(lineText[:index])), len([]rune(text))
+
+		// Shows the match in the middle if it isn't on the screen
+		top := t.Lines() - height - tab.scroll
+		if line < top || line >= top+height {
+			tab.scroll = t.Lines() - height - line + height/2
+			tab.clampScroll()
+		}
+		tab.scrolled = t.Scrolled()
+		return true
+	}
+
+	tab.matchLine = -1
+	return false
+}
+
+// Returns the text of the last lines shown in the pane, or the whole screen when lines is 0
+func (e *Editor) getTerminalText(lines int) string {
+	e.terminalLock.RLock()
+	defer e.terminalLock.RUnlock()
+
+	t := e.terminalTab.terminal
+	_, height := t.Size()
+	if lines <= 0 {
+		lines = height
+	}
+
+	bottom := t.Lines() - e.terminalTab.scroll
+	// The blank lines below the prompt are not copied
+	for bottom > 0 && t.LineText(bottom-1) == "" {
+		bottom--
+	}
+
+	text := make([]string, 0, lines)
+	for line := utils.Max(bottom-lines, 0); line < bottom; line++ {
+		text = append(text, t.LineText(line))
+	}
+	return strings.Join(text, "\n")
+}
+
+// Draws the names of the tabs above the terminal, the shown one is highlighted
+func (e *Editor) drawTerminalTabs() {
+	_, maxX := e.terminalscr.MaxYX()
+
+	x := 1
+	for i, tab := range e.terminalTabs {
+		name := " " + strconv.Itoa(i+1) + ":" + tab.name
+		if tab.process != nil && !tab.alive {
+			name += " (exited)"
+		}
+		name += " "
+
+		if x+len(name) > maxX {
+			name = name[:utils.Max(maxX-x, 0)]
+		}
+
+		if tab == e.terminalTab {
+			e.terminalscr.AttrOn(gc.A_REVERSE)
+			e.terminalscr.MovePrint(0, x, name)
+			e.terminalscr.AttrOff(gc.A_REVERSE)
+		} else {
+			e.terminalscr.MovePrint(0, x, name)
+		}
+		x += len(name)
+	}
+
+	e.terminalscr.HLine(1, 1, 0, maxX-1)
+}
+
+func init() {
+	registerCommand("new_terminal", "open a terminal tab with a new shell, in the directory given or the one gim was started in", func(e *Editor, c *CommandContext) {
+		if !e.terminalOpened {
+			e.resizeWindows()
+		}
+		e.addTerminalTab(strings.TrimSpace(strings.Join(c.args, " ")))
+		e.runTerminal()
+	})
+	registerCommand("close_terminal", "kill the shell of the terminal tab and close it", func(e *Editor, c *CommandContext) {
+		e.closeTerminalTab()
+		if e.terminalOpened {
+			e.drawTerminal()
+		}
+	})
+	registerCommand("next_terminal", "show the next terminal tab", func(e *Editor, c *CommandContext) {
+		e.switchTerminalTab(1)
+		if e.terminalOpened {
+			e.drawTerminal()
+		}
+	})
+	registerCommand("previous_terminal", "show the previous terminal tab", func(e *Editor, c *CommandContext) {
+		e.switchTerminalTab(-1)
+		if e.terminalOpened {
+			e.drawTerminal()
+		}
+	})
+	registerCommand("rename_terminal", "rename the terminal tab", func(e *Editor, c *CommandContext) {
+		name := strings.TrimSpace(e.getCommandInput(c, "rename terminal to"))
+		if name == "" {
+			return
+		}
+		e.terminalTab.name = name
+		if e.terminalOpened {
+			e.drawTerminal()
+		}
+	})
+	registerCommand("find_in_terminal", "find text in the output of the terminal, going further back each time", func(e *Editor, c *CommandContext) {
+		text := e.getCommandInput(c, "find in terminal")
+		if text == "" {
+			return
+		}
+
+		if !e.terminalOpened {
+			e.resizeWindows()
+		}
+		if !e.findInTerminal(text) {
+			e.showMessage("Not found in terminal: " + text)
+		}
+		e.drawTerminal()
+	})
+	registerCommand("copy_terminal", "copy the lines shown in the terminal, or the number of last lines given", func(e *Editor, c *CommandContext) {
+		lines := 0
+		if len(c.args) > 0 {
+			lines, _ = strconv.Atoi(c.args[0])
+		}
+
+		text := e.getTerminalText(lines)
+		if text == "" {
+			return
+		}
+		e.registers.set("+", Register{text: text, linewise: true}, true)
+		e.showMessage("Copied " + strconv.Itoa(strings.Count(text, "\n")+1) + " lines from the terminal")
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const (
+	TERMINFO_MAGIC       = 0432  // numbers are 16 bit
+	TERMINFO_MAGIC_32BIT = 01036 // numbers are 32 bit
+
+	EXTENDED_KEY_BASE = 0777 // KEY_MAX, ncurses numbers the extended strings after it
+)
+
+// Names of the keys in the extended terminfo keys, kUP5 is Ctrl+Up
+var terminfoKeyNames = map[string]string{
+	"kDC":  "Delete",
+	"kDN":  "Down",
+	"kEND": "End",
+	"kHOM": "Home",
+	"kIC":  "Insert",
+	"kLFT": "Left",
+	"kNXT": "PageDown",
+	"kPRV": "PageUp",
+	"kRIT": "Right",
+	"kUP":  "Up",
+}
+
+// Modifiers of the extended terminfo keys from the number after their name, starting at 2
+var terminfoModifiers = []string{"Shift", "Alt", "Alt+Shift", "Ctrl", "Ctrl+Shift", "Ctrl+Alt", "Ctrl+Alt+Shift"}
+
+// Returns the compiled terminfo entry of the terminal, from the same folders ncurses looks in
+func readTerminfo(term string) ([]byte, error) {
+	if term == "" || strings.ContainsAny(term, "/\\") {
+		return nil, fmt.Errorf("invalid terminal name %q", term)
+	}
+
+	dirs := make([]string, 0)
+	if dir := os.Getenv("TERMINFO"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".terminfo"))
+	}
+	for _, dir := range strings.Split(os.Getenv("TERMINFO_DIRS"), ":") {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	dirs = append(dirs, "/etc/terminfo", "/lib/terminfo", "/usr/share/terminfo", "/usr/lib/terminfo")
+
+	for _, dir := range dirs {
+		// Folders are named after the first letter, or its hex code on case insensitive file systems
+		for _, sub := range []string{term[:1], strconv.FormatInt(int64(term[0]), 16)} {
+			data, err := os.ReadFile(filepath.Join(dir, sub, term))
+			if err == nil {
+				return data, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no terminfo entry for %q", term)
+}
+
+// Returns the names of the extended strings of a compiled terminfo entry, with their values, in the order ncurses numbers them
+func parseTerminfoExtendedStrings(data []byte) ([]string, []string, error) {
+	errTruncated := errors.New("terminfo entry is truncated")
+	offset := 0
+	readShorts := func(n int) ([]int, bool) {
+		if n < 0 || offset+2*n > len(data) {
+			return nil, false
+		}
+		shorts := make([]int, n)
+		for i := range shorts {
+			shorts[i] = int(int16(binary.LittleEndian.Uint16(data[offset+2*i:])))
+		}
+		offset += 2 * n
+		return shorts, true
+	}
+
+	header, ok := readShorts(6)
+	if !ok {
+		return nil, nil, errTruncated
+	}
+
+	numberSize := 2
+	switch header[0] {
+	case TERMINFO_MAGIC:
+	case TERMINFO_MAGIC_32BIT:
+		numberSize = 4
+	default:
+		return nil, nil, errors.New("not a compiled terminfo entry")
+	}
+
+	// The standard capabilities, only skipped
+	offset += header[1] + header[2]
+	offset += offset % 2
+	offset += header[3]*numberSize + header[4]*2 + header[5]
+	offset += offset % 2
+
+	extendedHeader, ok := readShorts(5)
+	if !ok {
+		return nil, nil, errors.New("terminfo entry has no extended capabilities")
+	}
+	booleans, numbers, strs := extendedHeader[0], extendedHeader[1], extendedHeader[2]
+
+	offset += booleans
+	offset += offset % 2
+	offset += numbers * numberSize
+
+	valueOffsets, ok := readShorts(strs)
+	if !ok {
+		return nil, nil, errTruncated
+	}
+	nameOffsets, ok := readShorts(booleans + numbers + strs)
+	if !ok {
+		return nil, nil, errTruncated
+	}
+	table := data[offset:]
+
+	readString := func(at int) (string, bool) {
+		if at < 0 || at >= len(table) {
+			return "", false
+		}
+		end := strings.IndexByte(string(table[at:]), 0)
+		if end == -1 {
+			return "", false
+		}
+		return string(table[at : at+end]), true
+	}
+
+	// The names come after the values in the string table
+	values := make([]string, strs)
+	namesStart := 0
+	for i, at := range valueOffsets {
+		value, ok := readString(at)
+		if !ok {
+			continue // absent or cancelled
+		}
+		values[i] = value
+		namesStart = utils.Max(namesStart, at+len(value)+1)
+	}
+
+	names := make([]string, strs)
+	for i, at := range nameOffsets[booleans+numbers:] {
+		name, ok := readString(namesStart + at)
+		if !ok {
+			return nil, nil, errTruncated
+		}
+		names[i] = name
+	}
+	return names, values, nil
+}
+
+// Returns the names of the modified keys ncurses reads for the terminal, by the key codes it gives them
+func getTerminfoKeyNames(term string) (map[gc.Key]string, error) {
+	data, err := readTerminfo(term)
+	if err != nil {
+		return nil, err
+	}
+
+	names, values, err := parseTerminfoExtendedStrings(data)
+	if err != nil {
+		return nil, err
+	}
+
+	keyNames := make(map[gc.Key]string)
+	for i, name := range names {
+		if values[i] == "" {
+			continue
+		}
+
+		cut := strings.IndexAny(name, "0123456789")
+		if cut == -1 {
+			continue
+		}
+		key, ok := terminfoKeyNames[name[:cut]]
+		modifier, err := strconv.Atoi(name[cut:])
+		if !ok || err != nil || modifier < 2 || modifier-2 >= len(terminfoModifiers) {
+			continue
+		}
+		keyNames[gc.Key(EXTENDED_KEY_BASE+i)] = terminfoModifiers[modifier-2] + "+" + key
+	}
+	return keyNames, nil
+}
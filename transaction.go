@@ -29,6 +29,9 @@ type Transactions struct {
 	currentTransaction Transaction
 	transactions       []Transaction
 	undoIndex          int
+
+	groups        int // while any group is open every action goes into one transaction
+	groupLocation Location
 }
 
 func NewTransactions() *Transactions {
@@ -40,7 +43,7 @@ func NewTransactions() *Transactions {
 }
 
 func (t *Transactions) submit(y, x int) {
-	if len(t.currentTransaction.actions) == 0 {
+	if len(t.currentTransaction.actions) == 0 || t.groups > 0 {
 		return
 	}
 
@@ -80,3 +83,29 @@ func (t *Transactions) pop() (bool, Transaction) {
 	t.undoIndex--
 	return true, ta
 }
+
+// Starts collecting every action into one transaction until endGroup, y and x are where undoing it puts the cursor.
+// Groups can be nested, the transaction is submitted when the outermost one ends
+func (t *Transactions) startGroup(y, x int) {
+	t.groups++
+	if t.groups > 1 {
+		return
+	}
+
+	t.groupLocation = Location{line: y, col: x}
+}
+
+func (t *Transactions) endGroup() {
+	if t.groups == 0 {
+		return
+	}
+
+	t.groups--
+	if t.groups == 0 {
+		t.submit(t.groupLocation.line, t.groupLocation.col)
+	}
+}
+
+func (t *Transactions) actionCount() int {
+	return len(t.currentTransaction.actions)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const MIN_VIEW_SIZE = 3 // rows or columns a view can be resized down to
+
+// Buffer is the text of an open file with its undo history, views showing the same file share it so edits show up in all of them
+type Buffer struct {
+	lines        []string
+	transactions *Transactions
+}
+
+// View shows a buffer in a part of the screen with its own cursor and scroll
+type View struct {
+	*Buffer
+
+	stdscr    *gc.Window
+	lineNrscr *gc.Window
+	barscr    *gc.Window // the name of the file below the view, only there when there is more than one view
+
+	maxX, maxY int
+
+	x, y int
+	visX int
+
+	inlinePosition int
+
+	printLineStartIndex int
+	printLinesIndex     int
+
+	lexer *Lexer
+
+	selectedXStart, selectedYStart int
+	selectedXEnd, selectedYEnd     int
+	selected                       string
+
+	path string
+}
+
+// Layout splits the screen between views. Leaves hold a view, the others split their space between their children
+type Layout struct {
+	parent   *Layout
+	children []*Layout
+	vertical bool // the children are side by side instead of on top of each other
+
+	weight float64 // share of the space of the parent, the weights of the children of a layout add up to 1
+	size   int     // rows or columns it got from the parent when last laid out
+
+	view *View
+}
+
+func NewLayout(view *View) *Layout {
+	return &Layout{view: view, weight: 1}
+}
+
+func (l *Layout) find(view *View) *Layout {
+	if l.view == view {
+		return l
+	}
+
+	for _, child := range l.children {
+		if found := child.find(view); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Returns the views from the top left to the bottom right
+func (l *Layout) getViews() []*View {
+	if l.view != nil {
+		return []*View{l.view}
+	}
+
+	views := make([]*View, 0)
+	for _, child := range l.children {
+		views = append(views, child.getViews()...)
+	}
+	return views
+}
+
+// Splits the space of the leaf in two, the new view gets the right or bottom half
+func (l *Layout) split(view *View, vertical bool) {
+	parent := l.parent
+	if parent == nil || parent.vertical != vertical {
+		// The leaf becomes a layout holding the old view and the new one
+		l.children = []*Layout{
+			{parent: l, view: l.view, weight: 0.5},
+			{parent: l, view: view, weight: 0.5},
+		}
+		l.view = nil
+		l.vertical = vertical
+		return
+	}
+
+	l.weight /= 2
+	index := utils.Index(parent.children, l)
+	added := &Layout{parent: parent, view: view, weight: l.weight}
+	parent.children = append(parent.children[:index+1], append([]*Layout{added}, parent.children[index+1:]...)...)
+}
+
+// Removes the leaf, its space goes to the neighbour
+func (l *Layout) remove() {
+	parent := l.parent
+	if parent == nil {
+		return
+	}
+
+	index := utils.Index(parent.children, l)
+	parent.children = append(parent.children[:index], parent.children[index+1:]...)
+	parent.children[utils.Min(index, len(parent.children)-1)].weight += l.weight
+
+	if len(parent.children) > 1 {
+		return
+	}
+
+	// A layout with one child is replaced by it
+	child := parent.children[0]
+	parent.view = child.view
+	parent.vertical = child.vertical
+	parent.children = child.children
+	for _, grandChild := range parent.children {
+		grandChild.parent = parent
+	}
+}
+
+// Grows the leaf by delta rows or columns in the direction its parent splits, taking the space from a neighbour
+func (l *Layout) resize(delta int) {
+	parent := l.parent
+	if parent == nil {
+		return
+	}
+
+	total := 0
+	for _, child := range parent.children {
+		total += child.size
+	}
+
+	index := utils.Index(parent.children, l)
+	neighbour := index + 1
+	if neighbour == len(parent.children) {
+		neighbour = index - 1
+	}
+	other := parent.children[neighbour]
+
+	delta = utils.Min(delta, other.size-MIN_VIEW_SIZE)
+	delta = utils.Max(delta, MIN_VIEW_SIZE-l.size)
+	if delta == 0 || total == 0 {
+		return
+	}
+
+	shift := float64(delta) / float64(total)
+	l.weight += shift
+	other.weight -= shift
+}
+
+// Returns where the views go, below the header, above the status line and to the left of the terminal when it is open
+func (e *Editor) getViewArea() (int, int, int, int) {
+	maxY, maxX := gc.StdScr().MaxYX()
+	if e.terminalOpened {
+		_, width := e.terminalscr.MaxYX()
+		maxX -= width
+	}
+	if e.statusLine.isShown() {
+		maxY--
+	}
+
+	headerHeight, _ := e.headerscr.MaxYX()
+	return headerHeight, 0, maxY - headerHeight, maxX
+}
+
+// Gives every view its part of the screen
+func (e *Editor) layoutViews() {
+	y, x, height, width := e.getViewArea()
+
+	headerHeight, _ := e.headerscr.MaxYX()
+	e.headerscr.Resize(headerHeight, width)
+
+	if e.statusLine.isShown() {
+		var err error
+		e.statusLine.stdscr, err = placeWindow(e.statusLine.stdscr, 1, width, y+height, x)
+		if err != nil {
+			e.debugLog("failed to place status line:", err)
+		}
+	} else if e.statusLine.stdscr != nil {
+		_ = e.statusLine.stdscr.Delete()
+		e.statusLine.stdscr = nil
+	}
+
+	e.placeLayout(e.layout, y, x, height, width)
+}
+
+func (e *Editor) placeLayout(l *Layout, y, x, height, width int) {
+	if l.view != nil {
+		e.placeView(l.view, y, x, height, width)
+		return
+	}
+
+	total := height
+	if l.vertical {
+		total = width
+	}
+
+	offset := 0
+	for i, child := range l.children {
+		size := int(child.weight*float64(total) + 0.5)
+		if i == len(l.children)-1 {
+			size = total - offset
+		}
+		child.size = size
+
+		if l.vertical {
+			e.placeLayout(child, y, x+offset, height, size)
+		} else {
+			e.placeLayout(child, y+offset, x, size, width)
+		}
+		offset += size
+	}
+}
+
+func (e *Editor) placeView(v *View, y, x, height, width int) {
+	config := GetEditorConfig()
+
+	var err error
+	if len(e.views) > 1 {
+		height--
+		v.barscr, err = placeWindow(v.barscr, 1, width, y+height, x)
+		if err != nil {
+			e.debugLog("failed to place view:", err)
+		}
+	} else if v.barscr != nil {
+		_ = v.barscr.Delete()
+		v.barscr = nil
+	}
+
+	height = utils.Max(height, 1)
+	v.lineNrscr, err = placeWindow(v.lineNrscr, height, config.LineNumberWidth, y, x)
+	if err != nil {
+		e.debugLog("failed to place view:", err)
+	}
+
+	v.stdscr, err = placeWindow(v.stdscr, height, utils.Max(width-config.LineNumberWidth, 1), y, x+config.LineNumberWidth)
+	if err != nil {
+		e.debugLog("failed to place view:", err)
+	}
+
+	v.maxY, v.maxX = v.stdscr.MaxYX()
+}
+
+// Creates the window, or moves and resizes it if it exists
+func placeWindow(window *gc.Window, height, width, y, x int) (*gc.Window, error) {
+	if window == nil {
+		window, err := gc.NewWindow(height, width, y, x)
+		if err != nil {
+			return nil, err
+		}
+		return window, window.Keypad(true)
+	}
+
+	// Shrunk first so it is never moved partly off the screen
+	oldHeight, oldWidth := window.MaxYX()
+	window.Resize(utils.Min(height, oldHeight), utils.Min(width, oldWidth))
+	window.MoveWindow(y, x)
+	window.Resize(height, width)
+	return window, nil
+}
+
+// Returns the buffer of another view showing the file
+func (e *Editor) getSharedBuffer(path string) (*Buffer, bool) {
+	for _, v := range e.views {
+		if v != e.View && v.path == path {
+			return v.Buffer, true
+		}
+	}
+	return nil, false
+}
+
+// Keeps the cursors of other views on the buffer on the same lines when lines are added or deleted
+func (e *Editor) shiftViews(y, delta int) {
+	for _, v := range e.views {
+		if v == e.View || v.Buffer != e.Buffer {
+			continue
+		}
+
+		if v.y >= y {
+			v.y = utils.Max(v.y+delta, y)
+		}
+		if v.printLinesIndex > y {
+			v.printLinesIndex = utils.Max(v.printLinesIndex+delta, y)
+		}
+	}
+}
+
+// Makes sure the cursor and selection of the view are inside its buffer, it can have been changed by another view
+func (e *Editor) clampView() {
+	last := utils.Max(len(e.lines)-1, 0)
+	e.y = utils.Min(e.y, last)
+	e.x = utils.Min(e.x, len(e.lines[e.y]))
+	e.printLinesIndex = utils.Min(e.printLinesIndex, last)
+
+	if e.selectedYStart > last || e.selectedYEnd > last {
+		e.selectedYStart, e.selectedXStart = e.y, e.x
+		e.selectedYEnd, e.selectedXEnd = e.y, e.x
+	}
+	e.selectedXStart = utils.Min(e.selectedXStart, len(e.lines[e.selectedYStart]))
+	e.selectedXEnd = utils.Min(e.selectedXEnd, len(e.lines[e.selectedYEnd]))
+}
+
+func (e *Editor) drawViewBar(focused bool) {
+	if e.barscr == nil {
+		return
+	}
+
+	name := e.openPathsToNames[e.path]
+	if e.modified[e.path] {
+		name = "*" + name
+	}
+	position := strconv.Itoa(e.y+1) + ":" + strconv.Itoa(e.x+1)
+
+	_, width := e.barscr.MaxYX()
+	bar := " " + name + strings.Repeat(" ", utils.Max(width-len(name)-len(position)-2, 1)) + position + " "
+
+	e.barscr.Erase()
+	if focused {
+		e.barscr.AttrOn(gc.A_REVERSE)
+	}
+	e.barscr.MovePrint(0, 0, bar[:utils.Min(len(bar), width)])
+	if focused {
+		e.barscr.AttrOff(gc.A_REVERSE)
+	}
+	e.barscr.Refresh()
+}
+
+// Splits the focused view in two showing the same buffer, the new one gets focus
+func (e *Editor) splitView(vertical bool) {
+	lexer := *e.lexer
+	view := *e.View
+	view.lexer = &lexer
+	view.stdscr, view.lineNrscr, view.barscr = nil, nil, nil
+
+	e.layout.find(e.View).split(&view, vertical)
+	e.views = e.layout.getViews()
+	e.View = &view
+	e.layoutViews()
+}
+
+// Closes the focused view, the file stays open
+func (e *Editor) closeView() {
+	if len(e.views) == 1 {
+		return
+	}
+
+	// Keep changes of a buffer no other view shows like when switching files
+	if _, ok := e.getSharedBuffer(e.path); !ok {
+		err := e.saveTempFile()
+		if err != nil {
+			e.debugLog("failed to save view:", err)
+		}
+	}
+	e.tempFilePos[e.path] = Location{col: e.x, line: e.y}
+
+	closed := e.View
+	index := utils.Index(e.views, closed)
+
+	e.layout.find(closed).remove()
+	e.views = e.layout.getViews()
+
+	for _, window := range []*gc.Window{closed.stdscr, closed.lineNrscr, closed.barscr} {
+		if window != nil {
+			_ = window.Delete()
+		}
+	}
+
+	e.focusView(e.views[utils.Min(index, len(e.views)-1)])
+	e.layoutViews()
+}
+
+func (e *Editor) focusView(view *View) {
+	e.View = view
+	e.clampView()
+	e.current = utils.Index(e.openedFiles, e.path)
+	e.calculateHeaderOffset()
+}
+
+func (e *Editor) focusNextView(delta int) {
+	index := utils.Index(e.views, e.View) + delta
+	index = (index%len(e.views) + len(e.views)) % len(e.views)
+	e.focusView(e.views[index])
+}
+
+func (e *Editor) resizeView(delta int) {
+	e.layout.find(e.View).resize(delta)
+	e.layoutViews()
+}
+
+// Shows path in another view, used when the file it showed was closed
+func (e *Editor) loadInView(v *View, path string) {
+	focused := e.View
+	e.View = v
+	err := e.Load(path)
+	if err != nil {
+		e.debugLog(err)
+	}
+	e.View = focused
+	e.current = utils.Index(e.openedFiles, e.path)
+}
+
+func init() {
+	registerCommand("split", "show the file in a new view below the current one", func(e *Editor, c *CommandContext) {
+		e.splitView(false)
+	})
+	registerCommand("vsplit", "show the file in a new view to the right of the current one", func(e *Editor, c *CommandContext) {
+		e.splitView(true)
+	})
+	registerCommand("close_view", "close the current view, the file stays open", func(e *Editor, c *CommandContext) {
+		e.closeView()
+	})
+	registerCommand("next_view", "move to the next view", func(e *Editor, c *CommandContext) {
+		e.focusNextView(1)
+	})
+	registerCommand("previous_view", "move to the previous view", func(e *Editor, c *CommandContext) {
+		e.focusNextView(-1)
+	})
+	registerCommand("resize_view", "grow or shrink the current view by rows or columns, like resize_view -5", func(e *Editor, c *CommandContext) {
+		str := e.getCommandInput(c, "resize view by")
+		delta, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(str), "+"))
+		if err != nil {
+			return
+		}
+		e.resizeView(delta)
+	})
+}
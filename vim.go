@@ -0,0 +1,1298 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jonasfreyr/gim/utils"
+	gc "github.com/rthornton128/goncurses"
+)
+
+const (
+	NORMAL_MODE       = "NORMAL"
+	INSERT_MODE       = "INSERT"
+	VISUAL_MODE       = "VISUAL"
+	VISUAL_LINE_MODE  = "V-LINE"
+	COMMAND_LINE_MODE = "COMMAND"
+)
+
+type VimParseResult int
+
+const (
+	VIM_INCOMPLETE VimParseResult = iota
+	VIM_COMPLETE
+	VIM_INVALID
+)
+
+const vimNormalActions = "iaIAoOxXpPuJDCYsSr~.:vV/\x12"
+const vimVisualActions = "dcyxXsSDCYRJpPuU~o:vV"
+const vimMotions = "hjklwbeWBE0^$G;,{} "
+const vimTextObjects = "wW()b{}B[]<>\"'`"
+
+var vimBrackets = map[byte][2]byte{
+	'(': {'(', ')'}, ')': {'(', ')'}, 'b': {'(', ')'},
+	'{': {'{', '}'}, '}': {'{', '}'}, 'B': {'{', '}'},
+	'[': {'[', ']'}, ']': {'[', ']'},
+	'<': {'<', '>'}, '>': {'<', '>'},
+}
+
+type Vim struct {
+	enabled bool
+	mode    string
+
+	keys      []gc.Key // keys of the command typed so far
+	keyString string   // the same keys as characters, arrows become hjkl
+
+	change        []gc.Key      // keys of the change being made, it goes on until insert mode is left
+	changeHistory *Transactions // the undo history the change is grouped in, the file can be switched before it ends
+	lastChange    []gc.Key      // replayed by .
+	repeating     bool
+
+	visualY, visualX int // where the visual selection started
+
+	lastFind string // the last f, F, t or T with its character, for ; and ,
+}
+
+// VimCommand is a parsed normal or visual mode command like "a3dw"
+type VimCommand struct {
+	register string
+	count    int // 0 when no count was typed
+	operator string
+	motion   string // a motion or text object, the operator again for dd, cc and yy
+	action   string
+}
+
+// VimRange is the text an operator works on, the end is not included
+type VimRange struct {
+	startY, startX int
+	endY, endX     int
+	linewise       bool
+}
+
+func NewVim(enabled bool) *Vim {
+	return &Vim{
+		enabled: enabled,
+		mode:    NORMAL_MODE,
+	}
+}
+
+func (v *Vim) isVisual() bool {
+	return v.mode == VISUAL_MODE || v.mode == VISUAL_LINE_MODE
+}
+
+func (v *Vim) getPending() string {
+	return v.keyString
+}
+
+// Returns the key as the character vim commands are made of
+func getVimChar(key gc.Key) (byte, bool) {
+	switch key {
+	case gc.KEY_LEFT, gc.KEY_BACKSPACE, 127:
+		return 'h', true
+	case gc.KEY_RIGHT:
+		return 'l', true
+	case gc.KEY_UP:
+		return 'k', true
+	case gc.KEY_DOWN, gc.KEY_RETURN, gc.KEY_ENTER:
+		return 'j', true
+	case gc.KEY_HOME:
+		return '0', true
+	case gc.KEY_END:
+		return '$', true
+	case 18: // CTRL + R
+		return 18, true
+	}
+
+	if key >= 32 && key < 127 {
+		return byte(key), true
+	}
+	return 0, false
+}
+
+func parseVimCount(keys string, i int) (int, int) {
+	start := i
+	for i < len(keys) && keys[i] >= '0' && keys[i] <= '9' && (i > start || keys[i] != '0') {
+		i++
+	}
+
+	count, _ := strconv.Atoi(keys[start:i])
+	return count, i
+}
+
+func parseVimMotion(keys string, textObjects bool) (string, VimParseResult) {
+	motion := ""
+	switch c := keys[0]; {
+	case strings.IndexByte(vimMotions, c) != -1:
+		motion = keys[:1]
+	case c == 'g' || strings.IndexByte("fFtT", c) != -1 || textObjects && (c == 'i' || c == 'a'):
+		if len(keys) < 2 {
+			return "", VIM_INCOMPLETE
+		}
+		motion = keys[:2]
+
+		if c == 'g' && keys[1] != 'g' || (c == 'i' || c == 'a') && strings.IndexByte(vimTextObjects, keys[1]) == -1 {
+			return "", VIM_INVALID
+		}
+	default:
+		return "", VIM_INVALID
+	}
+
+	if len(motion) != len(keys) {
+		return "", VIM_INVALID
+	}
+	return motion, VIM_COMPLETE
+}
+
+// Parses commands like "\"a3dw", in visual mode operators work on the selection and don't take a motion
+func parseVimCommand(keys string, visual bool) (VimCommand, VimParseResult) {
+	command := VimCommand{}
+
+	i := 0
+	if keys[0] == '"' {
+		if len(keys) < 2 {
+			return command, VIM_INCOMPLETE
+		}
+		command.register = keys[1:2]
+		i = 2
+	}
+
+	command.count, i = parseVimCount(keys, i)
+	if i >= len(keys) {
+		return command, VIM_INCOMPLETE
+	}
+
+	c := keys[i]
+	rest := keys[i:]
+
+	actions := vimNormalActions
+	if visual {
+		actions = vimVisualActions
+	}
+
+	switch {
+	case !visual && strings.IndexByte("dcy", c) != -1:
+		command.operator = string(c)
+
+		count, j := parseVimCount(keys, i+1)
+		if count > 0 {
+			command.count = utils.Max(command.count, 1) * count
+		}
+		if j >= len(keys) {
+			return command, VIM_INCOMPLETE
+		}
+
+		if keys[j] == c {
+			command.motion = string(c)
+			if j != len(keys)-1 {
+				return command, VIM_INVALID
+			}
+			return command, VIM_COMPLETE
+		}
+
+		var result VimParseResult
+		command.motion, result = parseVimMotion(keys[j:], true)
+		return command, result
+	case !visual && c == 'r':
+		if len(rest) < 2 {
+			return command, VIM_INCOMPLETE
+		}
+		command.action = rest
+	case visual && (c == 'i' || c == 'a'):
+		var result VimParseResult
+		command.motion, result = parseVimMotion(rest, true)
+		return command, result
+	case strings.IndexByte(actions, c) != -1:
+		command.action = rest
+	default:
+		var result VimParseResult
+		command.motion, result = parseVimMotion(rest, false)
+		return command, result
+	}
+
+	if len(command.action) != len(rest) || len(rest) > 2 || len(rest) == 2 && c != 'r' {
+		return command, VIM_INVALID
+	}
+	return command, VIM_COMPLETE
+}
+
+// Handles the key if it is part of a vim command, keys that aren't go through the keymap
+func (e *Editor) handleVimKey(key gc.Key) (handled bool, exit bool) {
+	v := e.vim
+	c := newCommandContext(nil)
+	beforeY, beforeX := e.y, e.x
+
+	if v.mode == INSERT_MODE {
+		if !v.repeating {
+			v.change = append(v.change, key)
+		}
+		if key != gc.KEY_ESC {
+			return false, false
+		}
+
+		e.exitInsertMode()
+		e.finishVimKey(c, beforeY, beforeX)
+		return true, false
+	}
+
+	if key == gc.KEY_ESC {
+		if len(v.keys) == 0 && v.isVisual() {
+			v.mode = NORMAL_MODE
+		}
+		v.keys = nil
+		v.keyString = ""
+		e.finishVimKey(c, beforeY, beforeX)
+		return true, false
+	}
+
+	chr, ok := getVimChar(key)
+	if !ok {
+		if len(v.keys) > 0 {
+			v.keys = nil
+			v.keyString = ""
+			if !macros.replaying {
+				e.drawHeader()
+			}
+			return true, false
+		}
+		return false, false
+	}
+
+	v.keys = append(v.keys, key)
+	v.keyString += string(chr)
+
+	command, result := parseVimCommand(v.keyString, v.isVisual())
+	if result == VIM_INCOMPLETE {
+		if !macros.replaying {
+			e.drawHeader()
+		}
+		return true, false
+	}
+
+	keys := v.keys
+	v.keys = nil
+	v.keyString = ""
+	if result == VIM_INVALID {
+		if !macros.replaying {
+			e.drawHeader()
+		}
+		return true, false
+	}
+
+	if v.isVisual() {
+		e.runVisualCommand(command, c)
+	} else {
+		e.runVimCommand(command, keys, c)
+	}
+
+	if c.exit {
+		return true, true
+	}
+	e.finishVimKey(c, beforeY, beforeX)
+	return true, false
+}
+
+func (e *Editor) finishVimKey(c *CommandContext, beforeY, beforeX int) {
+	v := e.vim
+
+	// The cursor is on a character in normal mode, not after the last one
+	if v.mode != INSERT_MODE && e.x > 0 && e.x >= len(e.lines[e.y]) {
+		e.x = len(e.lines[e.y]) - 1
+	}
+
+	if v.isVisual() {
+		c.resetSelected = false
+		e.updateVisualSelection()
+	}
+
+	e.finishKey(c, beforeY, beforeX)
+}
+
+func (e *Editor) enterInsertMode() {
+	e.vim.mode = INSERT_MODE
+}
+
+func (e *Editor) exitInsertMode() {
+	e.vim.mode = NORMAL_MODE
+	if e.x > 0 {
+		e.x--
+	}
+	e.endVimChange()
+}
+
+// Starts a change, it is one undo step together with what is typed in insert mode after it
+func (e *Editor) startVimChange(keys []gc.Key) {
+	if !e.vim.repeating {
+		e.vim.change = append([]gc.Key{}, keys...)
+	}
+	e.vim.changeHistory = e.transactions
+	e.vim.changeHistory.startGroup(e.y, e.x)
+}
+
+func (e *Editor) endVimChange() {
+	v := e.vim
+	if !v.repeating && v.change != nil {
+		v.lastChange = v.change
+	}
+	v.change = nil
+	if v.changeHistory != nil {
+		v.changeHistory.endGroup()
+	}
+}
+
+func (e *Editor) repeatVimChange(count int) {
+	v := e.vim
+	if len(v.lastChange) == 0 || v.repeating {
+		return
+	}
+
+	transactions := e.transactions
+	v.repeating = true
+	transactions.startGroup(e.y, e.x)
+	defer func() {
+		v.repeating = false
+		transactions.endGroup()
+	}()
+
+	for i := 0; i < count; i++ {
+		for _, key := range v.lastChange {
+			e.handleKey(key)
+		}
+	}
+}
+
+func (e *Editor) setCursor(y, x int) {
+	e.moveYto(y)
+	e.moveXto(utils.Max(utils.Min(x, len(e.lines[e.y])), 0))
+}
+
+func (e *Editor) getFirstNonBlank(y int) int {
+	return len(getIndentation(e.lines[y]))
+}
+
+func (e *Editor) runVimCommand(command VimCommand, keys []gc.Key, c *CommandContext) {
+	v := e.vim
+	count := utils.Max(command.count, 1)
+
+	if command.operator == "" && command.action == "" {
+		e.moveVimMotion(command.motion, command.count, c)
+		return
+	}
+
+	switch command.action {
+	case ".":
+		e.repeatVimChange(count)
+		return
+	case ":":
+		e.runVimCommandLine(c)
+		return
+	case "/":
+		e.runCommand("find", c)
+		return
+	case "v", "V":
+		v.mode = VISUAL_MODE
+		if command.action == "V" {
+			v.mode = VISUAL_LINE_MODE
+		}
+		v.visualY, v.visualX = e.y, e.x
+		return
+	case "u":
+		for i := 0; i < count; i++ {
+			e.undoTransaction()
+		}
+		return
+	case "\x12":
+		for i := 0; i < count; i++ {
+			e.redoTransaction()
+		}
+		return
+	}
+
+	if command.operator == "y" {
+		e.runVimOperator(command)
+		return
+	}
+
+	e.startVimChange(keys)
+	if command.operator != "" {
+		e.runVimOperator(command)
+	} else {
+		e.runVimAction(command)
+	}
+
+	if v.mode != INSERT_MODE {
+		e.endVimChange()
+	}
+}
+
+func (e *Editor) runVimAction(command VimCommand) {
+	count := utils.Max(command.count, 1)
+	line := e.lines[e.y]
+
+	// Shorthands for an operator and a motion
+	shorthands := map[string][2]string{
+		"x": {"d", "l"},
+		"X": {"d", "h"},
+		"D": {"d", "$"},
+		"C": {"c", "$"},
+		"s": {"c", "l"},
+		"S": {"c", "c"},
+	}
+	if shorthand, ok := shorthands[command.action]; ok {
+		command.operator, command.motion = shorthand[0], shorthand[1]
+		e.runVimOperator(command)
+		return
+	}
+
+	switch command.action {
+	case "i":
+	case "a":
+		if len(line) > 0 {
+			e.x++
+		}
+	case "I":
+		e.setCursor(e.y, e.getFirstNonBlank(e.y))
+	case "A":
+		e.setCursor(e.y, len(line))
+	case "o", "O":
+		y := e.y + 1
+		if command.action == "O" {
+			y = e.y
+		}
+		indentation := getIndentation(line)
+		e.addLines(y, []string{indentation})
+		e.setCursor(y, len(indentation))
+	case "p", "P":
+		e.vimPaste(command.register, count, command.action == "P")
+		return
+	case "J":
+		for i := 0; i < utils.Max(count-1, 1); i++ {
+			e.joinLines()
+		}
+		return
+	case "~":
+		end := utils.Min(e.x+count, len(line))
+		e.changeVimCase(VimRange{startY: e.y, startX: e.x, endY: e.y, endX: end}, toggleCase)
+		e.setCursor(e.y, end)
+		return
+	default:
+		if command.action[0] == 'r' && e.x+count <= len(line) {
+			e.remove(e.y, e.x+count, count)
+			e.insert(e.y, e.x, strings.Repeat(command.action[1:], count))
+			e.setCursor(e.y, e.x+count-1)
+		}
+		return
+	}
+
+	e.enterInsertMode()
+}
+
+func (e *Editor) runVimOperator(command VimCommand) {
+	count := utils.Max(command.count, 1)
+
+	var r VimRange
+	ok := true
+	if command.motion == command.operator {
+		r = VimRange{startY: e.y, endY: utils.Min(e.y+count-1, len(e.lines)-1), linewise: true}
+	} else if len(command.motion) == 2 && (command.motion[0] == 'i' || command.motion[0] == 'a') {
+		r, ok = e.getVimTextObject(command.motion)
+	} else {
+		motion := command.motion
+		// Like in vim, cw changes to the end of the word
+		if command.operator == "c" && (motion == "w" || motion == "W") && e.getVimCharClass(e.y, e.x, false) != 0 {
+			motion = strings.Replace(motion, "w", "e", 1)
+			motion = strings.Replace(motion, "W", "E", 1)
+		}
+		r, ok = e.getVimMotionRange(motion, command.count)
+	}
+
+	if ok {
+		e.applyVimOperator(command.operator, command.register, r)
+	}
+}
+
+func (e *Editor) getRangeText(r VimRange) string {
+	if r.linewise {
+		return strings.Join(e.lines[r.startY:r.endY+1], "\n")
+	}
+	return e.getText(r.startY, r.startX, r.endY, r.endX)
+}
+
+func (e *Editor) applyVimOperator(operator, register string, r VimRange) {
+	e.registers.set(register, Register{text: e.getRangeText(r), linewise: r.linewise}, operator == "y")
+
+	switch operator {
+	case "y":
+		if r.linewise {
+			e.moveYto(r.startY)
+		} else {
+			e.setCursor(r.startY, r.startX)
+		}
+	case "d":
+		e.deleteVimRange(r)
+	case "c":
+		if r.linewise {
+			indentation := getIndentation(e.lines[r.startY])
+			e.replaceLines(r.startY, r.endY, []string{indentation})
+			e.setCursor(r.startY, len(indentation))
+		} else {
+			e.deleteVimRange(r)
+		}
+		e.enterInsertMode()
+	}
+}
+
+func (e *Editor) deleteVimRange(r VimRange) {
+	if !r.linewise {
+		e.selectedYStart, e.selectedXStart = r.startY, r.startX
+		e.selectedYEnd, e.selectedXEnd = r.endY, r.endX
+		e.removeSelection()
+		return
+	}
+
+	if r.endY-r.startY+1 >= len(e.lines) {
+		e.replaceLines(0, len(e.lines)-1, []string{""})
+	} else {
+		e.deleteLines(r.startY, r.endY-r.startY+1)
+	}
+
+	y := utils.Min(r.startY, len(e.lines)-1)
+	e.setCursor(y, e.getFirstNonBlank(y))
+}
+
+func (e *Editor) vimPaste(register string, count int, before bool) {
+	r := e.registers.get(register)
+	if r.text == "" {
+		return
+	}
+
+	if r.linewise {
+		lines := make([]string, 0)
+		for i := 0; i < count; i++ {
+			lines = append(lines, strings.Split(r.text, "\n")...)
+		}
+
+		y := e.y + 1
+		if before {
+			y = e.y
+		}
+		e.addLines(y, lines)
+		e.setCursor(y, e.getFirstNonBlank(y))
+		return
+	}
+
+	x := e.x
+	if !before && len(e.lines[e.y]) > 0 {
+		x++
+	}
+	y, endX := e.insertString(e.y, x, strings.Repeat(r.text, count))
+	e.setCursor(y, endX-1)
+}
+
+func toggleCase(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, text)
+}
+
+func (e *Editor) changeVimCase(r VimRange, change func(string) string) {
+	for y := r.startY; y <= r.endY; y++ {
+		startX, endX := 0, len(e.lines[y])
+		if !r.linewise && y == r.startY {
+			startX = r.startX
+		}
+		if !r.linewise && y == r.endY {
+			endX = utils.Min(r.endX, endX)
+		}
+
+		text := e.lines[y][startX:endX]
+		changed := change(text)
+		if changed != text {
+			e.remove(y, endX, endX-startX)
+			e.insert(y, startX, changed)
+		}
+	}
+}
+
+// 0 is whitespace and line ends, 1 word characters, 2 other characters and 3 empty lines.
+// Big words are anything that isn't whitespace
+func (e *Editor) getVimCharClass(y, x int, bigWord bool) int {
+	line := e.lines[y]
+	if x >= len(line) {
+		if len(line) == 0 {
+			return 3
+		}
+		return 0
+	}
+
+	c := rune(line[x])
+	switch {
+	case c == ' ' || c == '\t':
+		return 0
+	case bigWord || unicode.IsLetter(c) || unicode.IsNumber(c) || c == '_':
+		return 1
+	}
+	return 2
+}
+
+// Returns the next position in the file, line ends are positions too
+func (e *Editor) nextVimPosition(y, x int) (int, int, bool) {
+	if x < len(e.lines[y]) {
+		return y, x + 1, true
+	}
+	if y+1 < len(e.lines) {
+		return y + 1, 0, true
+	}
+	return y, x, false
+}
+
+func (e *Editor) previousVimPosition(y, x int) (int, int, bool) {
+	if x > 0 {
+		return y, x - 1, true
+	}
+	if y > 0 {
+		return y - 1, len(e.lines[y-1]), true
+	}
+	return y, x, false
+}
+
+func (e *Editor) vimWordForward(y, x int, bigWord bool) (int, int) {
+	class := e.getVimCharClass(y, x, bigWord)
+	ok := true
+	if class == 1 || class == 2 {
+		for ok && e.getVimCharClass(y, x, bigWord) == class {
+			y, x, ok = e.nextVimPosition(y, x)
+		}
+	} else if class == 3 {
+		y, x, ok = e.nextVimPosition(y, x)
+	}
+
+	for ok && e.getVimCharClass(y, x, bigWord) == 0 {
+		y, x, ok = e.nextVimPosition(y, x)
+	}
+	return y, x
+}
+
+func (e *Editor) vimWordEnd(y, x int, bigWord bool) (int, int) {
+	y, x, ok := e.nextVimPosition(y, x)
+	for ok && (e.getVimCharClass(y, x, bigWord) == 0 || e.getVimCharClass(y, x, bigWord) == 3) {
+		y, x, ok = e.nextVimPosition(y, x)
+	}
+
+	class := e.getVimCharClass(y, x, bigWord)
+	for {
+		nextY, nextX, ok := e.nextVimPosition(y, x)
+		if !ok || e.getVimCharClass(nextY, nextX, bigWord) != class {
+			return y, x
+		}
+		y, x = nextY, nextX
+	}
+}
+
+func (e *Editor) vimWordBackward(y, x int, bigWord bool) (int, int) {
+	y, x, ok := e.previousVimPosition(y, x)
+	for ok && e.getVimCharClass(y, x, bigWord) == 0 {
+		y, x, ok = e.previousVimPosition(y, x)
+	}
+
+	class := e.getVimCharClass(y, x, bigWord)
+	if class == 3 {
+		return y, x
+	}
+	for {
+		previousY, previousX, ok := e.previousVimPosition(y, x)
+		if !ok || e.getVimCharClass(previousY, previousX, bigWord) != class {
+			return y, x
+		}
+		y, x = previousY, previousX
+	}
+}
+
+// Finds the count-th ch on the current line for f, F, t and T, repeat is for ; and , so t doesn't get stuck
+func (e *Editor) findVimChar(kind, ch byte, count int, repeat bool) (int, bool) {
+	line := e.lines[e.y]
+	forward := kind == 'f' || kind == 't'
+	till := kind == 't' || kind == 'T'
+
+	x := e.x
+	if repeat && till {
+		if forward {
+			x++
+		} else {
+			x--
+		}
+	}
+
+	for ; count > 0; count-- {
+		if forward {
+			start := utils.Min(x+1, len(line))
+			i := strings.IndexByte(line[start:], ch)
+			if i == -1 {
+				return 0, false
+			}
+			x = start + i
+		} else {
+			if x <= 0 {
+				return 0, false
+			}
+			i := strings.LastIndexByte(line[:utils.Min(x, len(line))], ch)
+			if i == -1 {
+				return 0, false
+			}
+			x = i
+		}
+	}
+
+	if till && forward {
+		x--
+	} else if till {
+		x++
+	}
+	return x, true
+}
+
+// Moves over count paragraphs, which are separated by blank lines
+func (e *Editor) findVimParagraph(delta, count int) (int, int) {
+	y := e.y
+	for ; count > 0; count-- {
+		y += delta
+		for y >= 0 && y < len(e.lines) && strings.TrimSpace(e.lines[y]) == "" {
+			y += delta
+		}
+		for y >= 0 && y < len(e.lines) && strings.TrimSpace(e.lines[y]) != "" {
+			y += delta
+		}
+	}
+
+	if y < 0 {
+		return 0, 0
+	}
+	if y >= len(e.lines) {
+		return len(e.lines) - 1, len(e.lines[len(e.lines)-1])
+	}
+	return y, 0
+}
+
+// Returns where the motion goes, whether it is linewise and whether the character it ends on is included
+func (e *Editor) getVimMotionTarget(motion string, count int) (y, x int, linewise, inclusive, ok bool) {
+	n := utils.Max(count, 1)
+	y, x = e.y, e.x
+	line := e.lines[e.y]
+
+	switch motion {
+	case "h":
+		x = utils.Max(x-n, 0)
+	case "l", " ":
+		x = utils.Min(x+n, len(line))
+	case "j":
+		y = utils.Min(y+n, len(e.lines)-1)
+		linewise = true
+	case "k":
+		y = utils.Max(y-n, 0)
+		linewise = true
+	case "0":
+		x = 0
+	case "^":
+		x = e.getFirstNonBlank(y)
+	case "$":
+		y = utils.Min(y+n-1, len(e.lines)-1)
+		x = len(e.lines[y])
+	case "w", "W", "b", "B", "e", "E":
+		bigWord := motion == "W" || motion == "B" || motion == "E"
+		for i := 0; i < n; i++ {
+			switch motion {
+			case "w", "W":
+				y, x = e.vimWordForward(y, x, bigWord)
+			case "b", "B":
+				y, x = e.vimWordBackward(y, x, bigWord)
+			default:
+				y, x = e.vimWordEnd(y, x, bigWord)
+			}
+		}
+		inclusive = motion == "e" || motion == "E"
+	case "G", "gg":
+		y = len(e.lines) - 1
+		if motion == "gg" {
+			y = 0
+		}
+		if count > 0 {
+			y = utils.Min(count-1, len(e.lines)-1)
+		}
+		x = e.getFirstNonBlank(y)
+		linewise = true
+	case "{":
+		y, x = e.findVimParagraph(-1, n)
+	case "}":
+		y, x = e.findVimParagraph(1, n)
+	case ";", ",":
+		find := e.vim.lastFind
+		if find == "" {
+			return y, x, false, false, false
+		}
+
+		kind := find[0]
+		if motion == "," {
+			kind = map[byte]byte{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[kind]
+		}
+		x, ok = e.findVimChar(kind, find[1], n, true)
+		return y, x, false, kind == 'f' || kind == 't', ok
+	default:
+		if len(motion) == 2 && strings.IndexByte("fFtT", motion[0]) != -1 {
+			e.vim.lastFind = motion
+			x, ok = e.findVimChar(motion[0], motion[1], n, false)
+			return y, x, false, motion[0] == 'f' || motion[0] == 't', ok
+		}
+		return y, x, false, false, false
+	}
+
+	return y, x, linewise, inclusive, true
+}
+
+// Returns the text between the cursor and where the motion goes
+func (e *Editor) getVimMotionRange(motion string, count int) (VimRange, bool) {
+	y, x, linewise, inclusive, ok := e.getVimMotionTarget(motion, count)
+	if !ok {
+		return VimRange{}, false
+	}
+
+	if linewise {
+		return VimRange{startY: utils.Min(e.y, y), endY: utils.Max(e.y, y), linewise: true}, true
+	}
+
+	startY, startX, endY, endX := e.y, e.x, y, x
+	if endY < startY || endY == startY && endX < startX {
+		startY, startX, endY, endX = endY, endX, startY, startX
+	}
+
+	if inclusive {
+		endX = utils.Min(endX+1, len(e.lines[endY]))
+	} else if endX == 0 && endY > startY {
+		// Like in vim, a motion ending at the start of a line stops at the end of the line before
+		endY--
+		endX = len(e.lines[endY])
+	}
+
+	return VimRange{startY: startY, startX: startX, endY: endY, endX: endX}, true
+}
+
+func (e *Editor) moveVimMotion(motion string, count int, c *CommandContext) {
+	n := utils.Max(count, 1)
+	switch motion {
+	case "j":
+		e.moveCursorY(n)
+		c.updateLengthIndex = false
+		return
+	case "k":
+		e.moveCursorY(-n)
+		c.updateLengthIndex = false
+		return
+	}
+
+	y, x, _, _, ok := e.getVimMotionTarget(motion, count)
+	if !ok {
+		return
+	}
+	e.setCursor(y, x)
+
+	if motion == "$" { // Stays at the end of the lines when moving up and down
+		c.updateLengthIndex = false
+		e.inlinePosition = math.MaxInt32
+	}
+}
+
+func (e *Editor) getVimTextObject(object string) (VimRange, bool) {
+	inner := object[0] == 'i'
+
+	switch object[1] {
+	case 'w', 'W':
+		return e.getVimWordObject(inner, object[1] == 'W')
+	case '"', '\'', '`':
+		return e.getVimQuoteObject(inner, object[1])
+	}
+
+	brackets := vimBrackets[object[1]]
+	return e.getVimBracketObject(inner, brackets[0], brackets[1])
+}
+
+func (e *Editor) getVimWordObject(inner, bigWord bool) (VimRange, bool) {
+	line := e.lines[e.y]
+	if len(line) == 0 {
+		return VimRange{}, false
+	}
+
+	x := utils.Min(e.x, len(line)-1)
+	class := e.getVimCharClass(e.y, x, bigWord)
+
+	start, end := x, x+1
+	for start > 0 && e.getVimCharClass(e.y, start-1, bigWord) == class {
+		start--
+	}
+	for end < len(line) && e.getVimCharClass(e.y, end, bigWord) == class {
+		end++
+	}
+
+	if !inner {
+		// The whitespace after the word, or before it if there is none after
+		trailing := end
+		for trailing < len(line) && e.getVimCharClass(e.y, trailing, bigWord) == 0 {
+			trailing++
+		}
+		if trailing > end {
+			end = trailing
+		} else if class != 0 {
+			for start > 0 && e.getVimCharClass(e.y, start-1, bigWord) == 0 {
+				start--
+			}
+		}
+	}
+
+	return VimRange{startY: e.y, startX: start, endY: e.y, endX: end}, true
+}
+
+func (e *Editor) getVimQuoteObject(inner bool, quote byte) (VimRange, bool) {
+	line := e.lines[e.y]
+
+	quotes := make([]int, 0)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == quote {
+			quotes = append(quotes, i)
+		}
+	}
+
+	// The string the cursor is in, or the first one after it
+	for i := 0; i+1 < len(quotes); i += 2 {
+		start, end := quotes[i], quotes[i+1]
+		if end < e.x {
+			continue
+		}
+
+		if inner {
+			return VimRange{startY: e.y, startX: start + 1, endY: e.y, endX: end}, true
+		}
+
+		end++
+		for end < len(line) && (line[end] == ' ' || line[end] == '\t') {
+			end++
+		}
+		return VimRange{startY: e.y, startX: start, endY: e.y, endX: end}, true
+	}
+	return VimRange{}, false
+}
+
+func (e *Editor) getVimCharAt(y, x int) byte {
+	if x >= len(e.lines[y]) {
+		return '\n'
+	}
+	return e.lines[y][x]
+}
+
+func (e *Editor) getVimBracketObject(inner bool, open, close byte) (VimRange, bool) {
+	// Finds the opener around the cursor by going back until one isn't closed
+	openY, openX := e.y, e.x
+	ok := true
+	if chr := e.getVimCharAt(openY, openX); chr != open {
+		depth := 0
+		if chr == close {
+			depth = -1
+		}
+		for ok {
+			chr = e.getVimCharAt(openY, openX)
+			if chr == close {
+				depth++
+			} else if chr == open {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+			openY, openX, ok = e.previousVimPosition(openY, openX)
+		}
+		if !ok {
+			return VimRange{}, false
+		}
+	}
+
+	closeY, closeX, ok := e.nextVimPosition(openY, openX)
+	depth := 0
+	for ok {
+		chr := e.getVimCharAt(closeY, closeX)
+		if chr == open {
+			depth++
+		} else if chr == close {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		closeY, closeX, ok = e.nextVimPosition(closeY, closeX)
+	}
+	if !ok {
+		return VimRange{}, false
+	}
+
+	if !inner {
+		return VimRange{startY: openY, startX: openX, endY: closeY, endX: closeX + 1}, true
+	}
+
+	// A block with the brackets on their own lines is the lines between them
+	if openX == len(e.lines[openY])-1 && closeX == e.getFirstNonBlank(closeY) && closeY > openY+1 {
+		return VimRange{startY: openY + 1, endY: closeY - 1, linewise: true}, true
+	}
+	return VimRange{startY: openY, startX: openX + 1, endY: closeY, endX: closeX}, true
+}
+
+// Returns the selected text of visual mode, the character under the cursor is included
+func (e *Editor) getVisualRange(linewise bool) VimRange {
+	v := e.vim
+	v.visualY = utils.Min(v.visualY, len(e.lines)-1)
+	v.visualX = utils.Min(v.visualX, len(e.lines[v.visualY]))
+
+	startY, startX, endY, endX := v.visualY, v.visualX, e.y, e.x
+	if endY < startY || endY == startY && endX < startX {
+		startY, startX, endY, endX = endY, endX, startY, startX
+	}
+
+	if linewise || v.mode == VISUAL_LINE_MODE {
+		return VimRange{startY: startY, endY: endY, linewise: true}
+	}
+
+	endX++
+	if endX > len(e.lines[endY]) {
+		if endY+1 < len(e.lines) {
+			endY++
+			endX = 0
+		} else {
+			endX = len(e.lines[endY])
+		}
+	}
+	return VimRange{startY: startY, startX: startX, endY: endY, endX: endX}
+}
+
+func (e *Editor) updateVisualSelection() {
+	r := e.getVisualRange(false)
+	if r.linewise {
+		r.startX = 0
+		r.endX = len(e.lines[r.endY])
+	}
+
+	e.selectedYStart, e.selectedXStart = r.startY, r.startX
+	e.selectedYEnd, e.selectedXEnd = r.endY, r.endX
+}
+
+func (e *Editor) runVisualCommand(command VimCommand, c *CommandContext) {
+	v := e.vim
+
+	if command.motion != "" {
+		if len(command.motion) == 2 && (command.motion[0] == 'i' || command.motion[0] == 'a') {
+			r, ok := e.getVimTextObject(command.motion)
+			if ok {
+				if r.linewise {
+					r.startX, r.endX = 0, len(e.lines[r.endY])+1
+				}
+				v.visualY, v.visualX = r.startY, r.startX
+				e.setCursor(r.endY, r.endX-1)
+			}
+			return
+		}
+
+		e.moveVimMotion(command.motion, command.count, c)
+		return
+	}
+
+	switch command.action {
+	case "v", "V":
+		mode := VISUAL_MODE
+		if command.action == "V" {
+			mode = VISUAL_LINE_MODE
+		}
+
+		if v.mode == mode {
+			v.mode = NORMAL_MODE
+		} else {
+			v.mode = mode
+		}
+		return
+	case "o":
+		v.visualY, v.visualX, e.y, e.x = e.y, e.x, v.visualY, v.visualX
+		e.setCursor(e.y, e.x)
+		return
+	case ":":
+		v.mode = NORMAL_MODE
+		e.runVimCommandLine(c)
+		return
+	}
+
+	r := e.getVisualRange(false)
+	lines := e.getVisualRange(true)
+
+	e.startVimChange(nil)
+	v.mode = NORMAL_MODE
+
+	switch command.action {
+	case "y":
+		e.applyVimOperator("y", command.register, r)
+	case "Y":
+		e.applyVimOperator("y", command.register, lines)
+	case "d", "x":
+		e.applyVimOperator("d", command.register, r)
+	case "D", "X":
+		e.applyVimOperator("d", command.register, lines)
+	case "c", "s":
+		e.applyVimOperator("c", command.register, r)
+	case "C", "S", "R":
+		e.applyVimOperator("c", command.register, lines)
+	case "J":
+		e.joinLines()
+	case "p", "P":
+		register := e.registers.get(command.register)
+		e.applyVimOperator("d", "_", r)
+		e.registers.registers[UNNAMED_REGISTER] = register
+		// Goes where the deleted text was, after the last line if the lines were at the end
+		e.vimPaste("", 1, !r.linewise || r.startY < len(e.lines))
+	case "~":
+		e.changeVimCase(r, toggleCase)
+		e.setCursor(r.startY, r.startX)
+	case "u":
+		e.changeVimCase(r, strings.ToLower)
+		e.setCursor(r.startY, r.startX)
+	case "U":
+		e.changeVimCase(r, strings.ToUpper)
+		e.setCursor(r.startY, r.startX)
+	}
+
+	if v.mode != INSERT_MODE {
+		e.endVimChange()
+	}
+}
+
+func (e *Editor) runVimCommandLine(c *CommandContext) {
+	e.vim.mode = COMMAND_LINE_MODE
+	e.drawHeader()
+
+	str := e.miniWindow.whileRun(true, ":")
+	e.vim.mode = NORMAL_MODE
+	e.runExCommand(str, c)
+}
+
+// Closes the current file, or the editor if it is the last one
+func (e *Editor) vimQuit(force bool, c *CommandContext) {
+	if e.modified[e.path] && !force {
+		e.showMessage("No write since last change (add ! to override)")
+		return
+	}
+
+	if len(e.openedFiles) <= 1 {
+		c.exit = true
+		return
+	}
+	e.exitFile(e.path)
+}
+
+// Runs commands typed after :, the names of the editor commands work too like ":lines sort"
+func (e *Editor) runExCommand(line string, c *CommandContext) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	name, args := fields[0], fields[1:]
+	force := strings.HasSuffix(name, "!")
+	name = strings.TrimSuffix(name, "!")
+
+	if lineNr, err := strconv.Atoi(name); err == nil {
+		e.setCursor(utils.Max(lineNr-1, 0), 0)
+		e.setCursor(e.y, e.getFirstNonBlank(e.y))
+		return
+	}
+
+	save := func() bool {
+		path := e.path
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		// An unnamed file is given the name it is written to, so it can't be one that is open
+		naming := e.unnamed[e.path] && path != e.path
+		if naming {
+			path = e.getOpenedPath(path)
+			if _, ok := e.openPathsToNames[path]; ok {
+				e.showMessage(path + " is open already")
+				return false
+			}
+		}
+
+		err := e.Save(path)
+		if errors.Is(err, ErrReadOnly) {
+			e.showMessage(e.openPathsToNames[e.path] + " is read-only, write it to another file with :w {file}")
+			return false
+		} else if errors.Is(err, ErrUnnamed) {
+			e.showMessage(e.openPathsToNames[e.path] + " has no name, write it to a file with :w {file}")
+			return false
+		} else if err != nil {
+			log.Println(err)
+			e.popupWindow.pop("Failed to save!")
+			return false
+		}
+
+		if naming {
+			e.nameFile(path)
+			e.drawHeader()
+		}
+		return true
+	}
+
+	switch name {
+	case "w", "write":
+		save()
+	case "q", "quit", "close":
+		e.vimQuit(force, c)
+	case "wq", "x", "exit":
+		if save() {
+			e.vimQuit(force, c)
+		}
+	case "qa", "qall", "quitall":
+		if !force {
+			for _, modified := range e.modified {
+				if modified {
+					e.showMessage("No write since last change (add ! to override)")
+					return
+				}
+			}
+		}
+		c.exit = true
+	case "e", "edit":
+		e.runCommand("open", newCommandContext(args))
+	case "bn", "bnext":
+		e.switchFile(1)
+	case "bp", "bprevious":
+		e.switchFile(-1)
+	default:
+		if _, ok := getCommand(name); !ok {
+			e.showMessage("Not an editor command: " + name)
+			return
+		}
+
+		commandContext := newCommandContext(args)
+		e.runCommand(name, commandContext)
+		c.exit = commandContext.exit
+	}
+}
+
+func init() {
+	registerCommand("toggle_vim_mode", "turn vim style modal editing on or off", func(e *Editor, c *CommandContext) {
+		e.vim.enabled = !e.vim.enabled
+		e.vim.mode = NORMAL_MODE
+		e.vim.keys = nil
+		e.vim.keyString = ""
+	})
+}